@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"lab-inv/internal/auth"
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// roles lists every role, from the one allowed least to the one allowed most
+var roles = []string{model.RoleViewer, model.RoleMember, model.RoleManager, model.RoleAdmin}
+
+// routeCases lists every API route with each method its handler serves,
+// and the least role allowed to make the request
+var routeCases = func() []struct{ method, path, role string } {
+	id := primitive.NewObjectID().Hex()
+	return []struct{ method, path, role string }{
+		{http.MethodGet, "/api/items", model.RoleViewer},
+		{http.MethodPost, "/api/items", model.RoleMember},
+		{http.MethodGet, "/api/items/" + id, model.RoleViewer},
+		{http.MethodPut, "/api/items/" + id, model.RoleMember},
+		{http.MethodDelete, "/api/items/" + id, model.RoleManager},
+		{http.MethodGet, "/api/items/" + id + "/movements", model.RoleViewer},
+		{http.MethodPost, "/api/items/" + id + "/movements", model.RoleMember},
+		{http.MethodPost, "/api/items/" + id + "/adjust", model.RoleMember},
+		{http.MethodPost, "/api/items/import", model.RoleManager},
+		{http.MethodGet, "/api/locations", model.RoleViewer},
+		{http.MethodPost, "/api/locations", model.RoleManager},
+		{http.MethodGet, "/api/locations/" + id, model.RoleViewer},
+		{http.MethodPut, "/api/locations/" + id, model.RoleManager},
+		{http.MethodDelete, "/api/locations/" + id, model.RoleManager},
+		{http.MethodGet, "/api/locations/" + id + "/items", model.RoleViewer},
+		{http.MethodPost, "/api/locations/" + id + "/move", model.RoleManager},
+		{http.MethodGet, "/api/search", model.RoleViewer},
+		{http.MethodGet, "/api/items-with-locations", model.RoleViewer},
+		{http.MethodGet, "/api/export", model.RoleViewer},
+		{http.MethodPost, "/api/import", model.RoleManager},
+		{http.MethodGet, "/api/alerts/low-stock", model.RoleViewer},
+		{http.MethodGet, "/api/events", model.RoleViewer},
+		{http.MethodGet, "/api/audit", model.RoleManager},
+		{http.MethodGet, "/api/trash", model.RoleManager},
+		{http.MethodPost, "/api/trash/" + id + "/restore", model.RoleManager},
+		{http.MethodDelete, "/api/trash/" + id, model.RoleManager},
+		{http.MethodGet, "/api/webhooks", model.RoleAdmin},
+		{http.MethodPost, "/api/webhooks", model.RoleAdmin},
+		{http.MethodDelete, "/api/webhooks/" + id, model.RoleAdmin},
+		{http.MethodGet, "/api/webhooks/" + id + "/deliveries", model.RoleAdmin},
+		{http.MethodGet, "/api/me", model.RoleViewer},
+		{http.MethodPut, "/api/me/password", model.RoleViewer},
+		{http.MethodGet, "/api/users", model.RoleAdmin},
+		{http.MethodPost, "/api/users", model.RoleAdmin},
+		{http.MethodPut, "/api/users/" + id, model.RoleAdmin},
+		{http.MethodDelete, "/api/users/" + id, model.RoleAdmin},
+		{http.MethodGet, "/api/tokens", model.RoleViewer},
+		{http.MethodPost, "/api/tokens", model.RoleViewer},
+		{http.MethodDelete, "/api/tokens/" + id, model.RoleViewer},
+	}
+}()
+
+func TestRequiredRole(t *testing.T) {
+	for _, tt := range routeCases {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredRole(r); got != tt.role {
+			t.Errorf("%s %s needs %q, want %q", tt.method, tt.path, got, tt.role)
+		}
+	}
+}
+
+func TestRouteRolesCovered(t *testing.T) {
+	// Every rule applies to some route, so none is left over from a route
+	// that no longer exists
+	for _, rule := range routeRoles {
+		covered := false
+		for _, tt := range routeCases {
+			if ok, _ := path.Match(rule.pattern, tt.path); ok && (rule.method == "" || rule.method == tt.method) {
+				covered = true
+			}
+		}
+		if !covered {
+			t.Errorf("no route case for rule %s %s", rule.method, rule.pattern)
+		}
+	}
+}
+
+func TestAuthorizeRoles(t *testing.T) {
+	// Roles are unset for users stored before roles existed; they are viewers
+	for _, role := range append([]string{""}, roles...) {
+		user := model.User{ID: primitive.NewObjectID(), Username: "someone", Role: role}
+
+		for _, tt := range routeCases {
+			name := userRole(user) + " " + tt.method + " " + tt.path
+			allowed := user.HasRole(tt.role)
+
+			reached := false
+			handler := authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+
+			if reached != allowed {
+				t.Errorf("%s: reached handler = %v, want %v", name, reached, allowed)
+				continue
+			}
+			if allowed {
+				continue
+			}
+
+			var body forbiddenError
+			if w.Code != http.StatusForbidden || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+				t.Errorf("%s: got %d %q, want 403 with a JSON error", name, w.Code, w.Body.String())
+				continue
+			}
+			if body.RequiredRole != tt.role || body.Error == "" {
+				t.Errorf("%s: got %+v, want required_role %q", name, body, tt.role)
+			}
+		}
+	}
+}
+
+func TestAuthorizePassesPublicAndPreflightRequests(t *testing.T) {
+	viewer := model.User{ID: primitive.NewObjectID(), Role: model.RoleViewer}
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/users", nil)
+
+	tests := []struct {
+		name string
+		r    *http.Request
+	}{
+		{"no user", httptest.NewRequest(http.MethodPost, "/api/login", nil)},
+		{"preflight", preflight.WithContext(auth.WithUser(preflight.Context(), viewer))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true })).ServeHTTP(httptest.NewRecorder(), tt.r)
+			if !reached {
+				t.Fatal("request did not reach the handler")
+			}
+		})
+	}
+}
+
+func TestOnlyManagersChangePrices(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	shelf := api.addLocation("Shelf", "")
+	item := api.addItem(model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10})
+	itemPath := "/api/items/" + item.ID.Hex()
+
+	member := api.userWithRole(model.RoleMember)
+	manager := api.userWithRole(model.RoleManager)
+
+	// A member may change everything but the price
+	var updated model.Item
+	update := model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 12}
+	decodeJSON(t, api.do(member, http.MethodPut, itemPath, update), http.StatusOK, &updated)
+	if updated.Name != "Nitrile gloves" || updated.Number != 12 {
+		t.Fatalf("member update = %+v", updated)
+	}
+
+	var body forbiddenError
+	update.Price = 1
+	decodeJSON(t, api.do(member, http.MethodPut, itemPath, update), http.StatusForbidden, &body)
+	if body.RequiredRole != model.RoleManager {
+		t.Fatalf("member price change refused with %+v", body)
+	}
+
+	decodeJSON(t, api.do(manager, http.MethodPut, itemPath, update), http.StatusOK, &updated)
+	if updated.Price != 1 {
+		t.Fatalf("manager update = %+v", updated)
+	}
+
+	// Nor may members set a price on the items they create, or import priced items
+	create := model.CreateItem{Name: "Goggles", LocationID: shelf.ID.Hex(), Number: 2}
+	var created model.Item
+	decodeJSON(t, api.do(member, http.MethodPost, "/api/items", create), http.StatusOK, &created)
+	if created.Price != 0 {
+		t.Fatalf("member created %+v", created)
+	}
+	create.Price = 9
+	decodeJSON(t, api.do(member, http.MethodPost, "/api/items", create), http.StatusForbidden, &body)
+	if body.RequiredRole != model.RoleManager {
+		t.Fatalf("member priced create refused with %+v", body)
+	}
+	decodeJSON(t, api.do(manager, http.MethodPost, "/api/items", create), http.StatusOK, &created)
+	if created.Price != 9 {
+		t.Fatalf("manager created %+v", created)
+	}
+	decodeJSON(t, api.do(member, http.MethodPost, "/api/items/import", nil), http.StatusForbidden, &body)
+
+	// Deleting needs a manager too
+	decodeJSON(t, api.do(member, http.MethodDelete, itemPath, nil), http.StatusForbidden, &body)
+	expectStatus(t, api.do(manager, http.MethodDelete, itemPath, nil), http.StatusNoContent)
+}
+
+func TestAdminOnlyRoutes(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	manager := api.userWithRole(model.RoleManager)
+
+	routes := []struct {
+		method string
+		path   string
+		body   interface{}
+		status int // For an admin
+	}{
+		{http.MethodGet, "/api/users", nil, http.StatusOK},
+		{http.MethodPost, "/api/users", model.CreateUser{Username: "student", Password: testPassword}, http.StatusOK},
+		{http.MethodGet, "/api/webhooks", nil, http.StatusOK},
+		{http.MethodPost, "/api/webhooks", model.CreateWebhook{URL: "http://localhost:9/hook", Events: []string{"item.created"}}, http.StatusOK},
+	}
+	for _, tt := range routes {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var body forbiddenError
+			decodeJSON(t, api.do(manager, tt.method, tt.path, tt.body), http.StatusForbidden, &body)
+			if body.RequiredRole != model.RoleAdmin {
+				t.Fatalf("manager refused with %+v", body)
+			}
+			expectStatus(t, api.do(api.admin, tt.method, tt.path, tt.body), tt.status)
+		})
+	}
+
+	// Admins cannot lock themselves out
+	var me model.User
+	decodeJSON(t, api.do(api.admin, http.MethodGet, "/api/me", nil), http.StatusOK, &me)
+	resp := api.do(api.admin, http.MethodPut, "/api/users/"+me.ID.Hex(), model.UpdateUser{Role: model.RoleViewer})
+	expectStatus(t, resp, http.StatusBadRequest)
+	expectStatus(t, api.do(api.admin, http.MethodDelete, "/api/users/"+me.ID.Hex(), nil), http.StatusBadRequest)
+}
+
+func TestRequiredScope(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	tests := []struct{ method, path, scope string }{
+		{http.MethodGet, "/api/items", model.ScopeReadOnly},
+		{http.MethodHead, "/api/items/" + id, model.ScopeReadOnly},
+		{http.MethodGet, "/api/users", model.ScopeReadOnly},
+		{http.MethodPost, "/api/items/" + id + "/adjust", model.ScopeStockAdjust},
+		{http.MethodPost, "/api/items/" + id + "/movements", model.ScopeStockAdjust},
+		{http.MethodPost, "/api/items", model.ScopeFull},
+		{http.MethodPut, "/api/items/" + id, model.ScopeFull},
+		{http.MethodDelete, "/api/items/" + id, model.ScopeFull},
+		{http.MethodPost, "/api/locations/" + id + "/move", model.ScopeFull},
+		{http.MethodPost, "/api/import", model.ScopeFull},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredScope(r); got != tt.scope {
+			t.Errorf("%s %s needs scope %q, want %q", tt.method, tt.path, got, tt.scope)
+		}
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	shelf := api.addLocation("Shelf", "")
+	item := api.addItem(model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10})
+	itemPath := "/api/items/" + item.ID.Hex()
+
+	member := api.userWithRole(model.RoleMember)
+	token := func(scope string) string {
+		var created model.NewAPITokenResult
+		resp := api.do(member, http.MethodPost, "/api/tokens", model.CreateAPIToken{Name: scope, Scope: scope})
+		decodeJSON(t, resp, http.StatusOK, &created)
+		return "Bearer " + created.Token
+	}
+	readOnly, stockAdjust, full := token(model.ScopeReadOnly), token(model.ScopeStockAdjust), token(model.ScopeFull)
+
+	adjust := model.AdjustStock{Delta: -1}
+	update := model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10}
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   interface{}
+		status int
+		scope  string // Named in the 403, if refused for the token's scope
+		role   string // Named in the 403, if refused for the user's role
+	}{
+		{"read-only reads", readOnly, http.MethodGet, itemPath, nil, http.StatusOK, "", ""},
+		{"read-only adjusts", readOnly, http.MethodPost, itemPath + "/adjust", adjust, http.StatusForbidden, model.ScopeStockAdjust, ""},
+		{"read-only updates", readOnly, http.MethodPut, itemPath, update, http.StatusForbidden, model.ScopeFull, ""},
+		{"stock-adjust adjusts", stockAdjust, http.MethodPost, itemPath + "/adjust", adjust, http.StatusOK, "", ""},
+		{"stock-adjust updates", stockAdjust, http.MethodPut, itemPath, update, http.StatusForbidden, model.ScopeFull, ""},
+		{"full updates", full, http.MethodPut, itemPath, update, http.StatusOK, "", ""},
+		{"full cannot exceed role", full, http.MethodDelete, itemPath, nil, http.StatusForbidden, "", model.RoleManager},
+		{"full cannot create tokens", full, http.MethodPost, "/api/tokens", model.CreateAPIToken{Name: "x", Scope: model.ScopeFull}, http.StatusForbidden, "", ""},
+		{"full cannot change password", full, http.MethodPut, "/api/me/password", model.ChangePassword{CurrentPassword: testPassword, NewPassword: "another password"}, http.StatusForbidden, "", ""},
+		{"full lists tokens", full, http.MethodGet, "/api/tokens", nil, http.StatusOK, "", ""},
+		{"malformed header", "Token " + full[len("Bearer "):], http.MethodGet, itemPath, nil, http.StatusUnauthorized, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.do(http.DefaultClient, tt.method, tt.path, tt.body, "Authorization", tt.token)
+			if tt.status != http.StatusForbidden {
+				expectStatus(t, resp, tt.status)
+				return
+			}
+			var body forbiddenError
+			decodeJSON(t, resp, http.StatusForbidden, &body)
+			if body.RequiredScope != tt.scope || body.RequiredRole != tt.role {
+				t.Fatalf("refused with %+v", body)
+			}
+		})
+	}
+}
+
+func TestRevokedTokens(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	member := api.userWithRole(model.RoleMember)
+
+	var created model.NewAPITokenResult
+	resp := api.do(member, http.MethodPost, "/api/tokens", model.CreateAPIToken{Name: "script", Scope: model.ScopeFull})
+	decodeJSON(t, resp, http.StatusOK, &created)
+	header := "Bearer " + created.Token
+	expectStatus(t, api.do(http.DefaultClient, http.MethodGet, "/api/items", nil, "Authorization", header), http.StatusOK)
+
+	// Listing never shows the token or its hash again
+	var tokens []model.APIToken
+	decodeJSON(t, api.do(member, http.MethodGet, "/api/tokens", nil), http.StatusOK, &tokens)
+	if len(tokens) != 1 || tokens[0].Hash != "" || tokens[0].LastUsed == nil {
+		t.Fatalf("listed tokens = %+v", tokens)
+	}
+
+	// A revoked token stops working at once
+	var revoked model.NewAPITokenResult
+	resp = api.do(member, http.MethodPost, "/api/tokens", model.CreateAPIToken{Name: "old script", Scope: model.ScopeFull})
+	decodeJSON(t, resp, http.StatusOK, &revoked)
+	expectStatus(t, api.do(member, http.MethodDelete, "/api/tokens/"+revoked.ID.Hex(), nil), http.StatusNoContent)
+	resp = api.do(http.DefaultClient, http.MethodGet, "/api/items", nil, "Authorization", "Bearer "+revoked.Token)
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	// Deleting the user revokes their tokens
+	var me model.User
+	decodeJSON(t, api.do(member, http.MethodGet, "/api/me", nil), http.StatusOK, &me)
+	expectStatus(t, api.do(api.admin, http.MethodDelete, "/api/users/"+me.ID.Hex(), nil), http.StatusNoContent)
+	expectStatus(t, api.do(http.DefaultClient, http.MethodGet, "/api/items", nil, "Authorization", header), http.StatusUnauthorized)
+}
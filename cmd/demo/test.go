@@ -27,8 +27,14 @@ func main() {
 	fmt.Println("Data directory:", dataDir)
 
 	// Show inventory summary
-	items := fileStore.GetAllItems()
-	locations := fileStore.GetAllLocations()
+	items, err := fileStore.GetAllItems()
+	if err != nil {
+		log.Fatalf("Failed to load items: %v", err)
+	}
+	locations, err := fileStore.GetAllLocations()
+	if err != nil {
+		log.Fatalf("Failed to load locations: %v", err)
+	}
 
 	fmt.Printf("Total items: %d\n", len(items))
 	fmt.Printf("Total locations: %d\n", len(locations))
@@ -84,7 +90,11 @@ func main() {
 
 // listAllItems displays all items with their locations
 func listAllItems(fileStore *storage.FileStore) {
-	items := fileStore.GetItemsWithLocations()
+	items, err := fileStore.GetItemsWithLocations()
+	if err != nil {
+		fmt.Printf("Failed to load items: %v\n", err)
+		return
+	}
 
 	if len(items) == 0 {
 		fmt.Println("No items found")
@@ -92,18 +102,22 @@ func listAllItems(fileStore *storage.FileStore) {
 	}
 
 	fmt.Println("\nAll Items:")
-	fmt.Printf("%-5s | %-30s | %-20s | %-10s\n", "ID", "Name", "Location", "Price")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-24s | %-30s | %-20s | %-10s\n", "ID", "Name", "Location", "Price")
+	fmt.Println(strings.Repeat("-", 90))
 	
 	for _, item := range items {
-		fmt.Printf("%-5d | %-30s | %-20s | $%.2f\n", 
-			item.ID, item.Name, item.Location, item.Price)
+		fmt.Printf("%-24s | %-30s | %-20s | $%.2f\n", 
+			item.ID.Hex(), item.Name, item.Location, item.Price)
 	}
 }
 
 // listAllLocations displays all locations
 func listAllLocations(fileStore *storage.FileStore) {
-	locations := fileStore.GetAllLocations()
+	locations, err := fileStore.GetAllLocations()
+	if err != nil {
+		fmt.Printf("Failed to load locations: %v\n", err)
+		return
+	}
 
 	if len(locations) == 0 {
 		fmt.Println("No locations found")
@@ -111,18 +125,22 @@ func listAllLocations(fileStore *storage.FileStore) {
 	}
 
 	fmt.Println("\nAll Locations:")
-	fmt.Printf("%-5s | %-30s\n", "ID", "Name")
-	fmt.Println(strings.Repeat("-", 40))
+	fmt.Printf("%-24s | %-30s\n", "ID", "Name")
+	fmt.Println(strings.Repeat("-", 60))
 	
 	for _, location := range locations {
-		fmt.Printf("%-5d | %-30s\n", location.ID, location.Name)
+		fmt.Printf("%-24s | %-30s\n", location.ID.Hex(), location.Name)
 	}
 }
 
 // addNewItem adds a new item to the inventory
 func addNewItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 	// List available locations first
-	locations := fileStore.GetAllLocations()
+	locations, err := fileStore.GetAllLocations()
+	if err != nil {
+		fmt.Printf("Failed to load locations: %v\n", err)
+		return
+	}
 	if len(locations) == 0 {
 		fmt.Println("No locations available. Please add a location first.")
 		return
@@ -130,13 +148,14 @@ func addNewItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 
 	fmt.Println("\nAvailable Locations:")
 	for _, loc := range locations {
-		fmt.Printf("%d. %s\n", loc.ID, loc.Name)
+		fmt.Printf("%s. %s\n", loc.ID.Hex(), loc.Name)
 	}
 
 	// Get item details
 	var name string
-	var locationID uint
+	var locationID string
 	var price float64
+	var number int
 
 	fmt.Print("\nEnter item name: ")
 	scanner.Scan()
@@ -148,18 +167,12 @@ func addNewItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 
 	fmt.Print("Enter location ID: ")
 	scanner.Scan()
-	locIDStr := scanner.Text()
-	locID, err := strconv.ParseUint(locIDStr, 10, 64)
-	if err != nil {
-		fmt.Println("Invalid location ID")
-		return
-	}
-	locationID = uint(locID)
+	locationID = strings.TrimSpace(scanner.Text())
 
 	// Verify location exists
 	locationExists := false
 	for _, loc := range locations {
-		if loc.ID == locationID {
+		if loc.ID.Hex() == locationID {
 			locationExists = true
 			break
 		}
@@ -178,11 +191,20 @@ func addNewItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 		return
 	}
 
+	fmt.Print("Enter quantity: ")
+	scanner.Scan()
+	number, err = strconv.Atoi(scanner.Text())
+	if err != nil {
+		fmt.Println("Invalid quantity")
+		return
+	}
+
 	// Create the item
 	newItem := model.CreateItem{
 		Name:       name,
 		LocationID: locationID,
 		Price:      price,
+		Number:     number,
 	}
 
 	item, err := fileStore.AddItem(newItem)
@@ -191,7 +213,7 @@ func addNewItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 		return
 	}
 
-	fmt.Printf("Item added successfully with ID %d\n", item.ID)
+	fmt.Printf("Item added successfully with ID %s\n", item.ID.Hex())
 }
 
 // addNewLocation adds a new location
@@ -216,7 +238,7 @@ func addNewLocation(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 		return
 	}
 
-	fmt.Printf("Location added successfully with ID %d\n", location.ID)
+	fmt.Printf("Location added successfully with ID %s\n", location.ID.Hex())
 }
 
 // searchItems searches for items by name
@@ -225,26 +247,30 @@ func searchItems(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 	scanner.Scan()
 	query := scanner.Text()
 
-	items := fileStore.SearchItems(query)
+	items, err := fileStore.SearchItems(query)
+	if err != nil {
+		fmt.Printf("Search failed: %v\n", err)
+		return
+	}
 	if len(items) == 0 {
 		fmt.Println("No items found matching your search")
 		return
 	}
 
 	fmt.Printf("\nFound %d items:\n", len(items))
-	fmt.Printf("%-5s | %-30s | %-20s | %-10s\n", "ID", "Name", "Location", "Price")
-	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-24s | %-30s | %-20s | %-10s\n", "ID", "Name", "Location", "Price")
+	fmt.Println(strings.Repeat("-", 90))
 	
 	for _, item := range items {
 		// Get location name
-		location, err := fileStore.GetLocationByID(item.LocationID)
+		location, err := fileStore.GetLocationByID(item.LocationID.Hex())
 		locationName := "Unknown"
 		if err == nil {
 			locationName = location.Name
 		}
 
-		fmt.Printf("%-5d | %-30s | %-20s | $%.2f\n", 
-			item.ID, item.Name, locationName, item.Price)
+		fmt.Printf("%-24s | %-30s | %-20s | $%.2f\n", 
+			item.ID.Hex(), item.Name, locationName, item.Price)
 	}
 }
 
@@ -252,10 +278,8 @@ func searchItems(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 func deleteItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 	fmt.Print("\nEnter item ID to delete: ")
 	scanner.Scan()
-	idStr := scanner.Text()
-	
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
+	id := strings.TrimSpace(scanner.Text())
+	if id == "" {
 		fmt.Println("Invalid item ID")
 		return
 	}
@@ -270,7 +294,7 @@ func deleteItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 		return
 	}
 
-	err = fileStore.DeleteItem(uint(id))
+	err := fileStore.DeleteItem(id, storage.AnyVersion, "demo")
 	if err != nil {
 		fmt.Printf("Failed to delete item: %v\n", err)
 		return
@@ -283,10 +307,8 @@ func deleteItem(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 func deleteLocation(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 	fmt.Print("\nEnter location ID to delete: ")
 	scanner.Scan()
-	idStr := scanner.Text()
-	
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
+	id := strings.TrimSpace(scanner.Text())
+	if id == "" {
 		fmt.Println("Invalid location ID")
 		return
 	}
@@ -301,7 +323,7 @@ func deleteLocation(fileStore *storage.FileStore, scanner *bufio.Scanner) {
 		return
 	}
 
-	err = fileStore.DeleteLocation(uint(id))
+	err := fileStore.DeleteLocation(id, false, storage.AnyVersion, "demo")
 	if err != nil {
 		fmt.Printf("Failed to delete location: %v\n", err)
 		return
@@ -0,0 +1,36 @@
+// Command mockoidc is a minimal OpenID Connect provider for trying out and
+// testing lab-inv's single sign-on locally. Its login page signs on anyone
+// as whatever user name and groups are typed in. Never use it for real.
+//
+//	go run ./cmd/mockoidc -addr :9000
+//
+// and start lab-inv with
+//
+//	LAB_INV_OIDC_ISSUER=http://localhost:9000 LAB_INV_OIDC_CLIENT_ID=lab-inv \
+//	LAB_INV_OIDC_CLIENT_SECRET=secret \
+//	LAB_INV_OIDC_REDIRECT_URL=http://localhost:8080/api/oidc/callback
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"lab-inv/internal/auth/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "HTTP listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, as lab-inv reaches this server")
+	clientID := flag.String("client-id", "lab-inv", "client ID lab-inv is configured with")
+	clientSecret := flag.String("client-secret", "secret", "client secret lab-inv is configured with")
+	flag.Parse()
+
+	provider, err := oidctest.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Failed to set up the provider: %v", err)
+	}
+
+	log.Printf("Mock OIDC provider %s for client %q on %s", *issuer, *clientID, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"lab-inv/internal/config"
+	"lab-inv/internal/export"
+)
+
+// runExport implements "lab-inv export": it writes items with their
+// locations from the configured store as CSV or XLSX
+func runExport(args []string) {
+	fs := flag.NewFlagSet("lab-inv export", flag.ContinueOnError)
+	format := fs.String("format", export.FormatCSV, "output format: csv or xlsx")
+	columnSpec := fs.String("columns", export.DefaultColumns, "comma-separated columns: id,name,location,number,total,price,value,modified")
+	output := fs.String("o", "", "output file (default stdout)")
+
+	cfg, err := config.Load(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	columns, err := export.ParseColumns(*columnSpec)
+	if err != nil {
+		log.Fatalf("Invalid columns: %v", err)
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s store: %v", cfg.Store, err)
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := export.WriteItems(w, *format, columns, store.EachItemWithLocation); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package alerts watches item stock against each item's minimum quantity
+package alerts
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LowStock returns an alert for every item below its minimum, sorted by name
+func LowStock(items []model.Item) []model.LowStockAlert {
+	alerts := []model.LowStockAlert{}
+	for _, item := range items {
+		if item.LowStock() {
+			alerts = append(alerts, model.NewLowStockAlert(item))
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Name < alerts[j].Name })
+	return alerts
+}
+
+// ItemLister is the part of the store the checker reads items from
+type ItemLister interface {
+	GetAllItems() ([]model.Item, error)
+}
+
+// Checker follows item events and publishes alert.low_stock when an item
+// drops below its minimum, and alert.restocked when it gets back to it
+type Checker struct {
+	bus   *events.Bus
+	items ItemLister
+
+	mu  sync.Mutex
+	low map[primitive.ObjectID]bool // Items currently below their minimum
+}
+
+// NewChecker creates a checker publishing on bus. Items that are already
+// low when it starts do not raise an alert until they recover and drop again.
+func NewChecker(bus *events.Bus, items ItemLister) (*Checker, error) {
+	c := &Checker{bus: bus, items: items}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load takes the low items from the store, without raising alerts
+func (c *Checker) load() error {
+	items, err := c.items.GetAllItems()
+	if err != nil {
+		return err
+	}
+
+	low := make(map[primitive.ObjectID]bool)
+	for _, item := range items {
+		if item.LowStock() {
+			low[item.ID] = true
+		}
+	}
+
+	c.mu.Lock()
+	c.low = low
+	c.mu.Unlock()
+	return nil
+}
+
+// Start runs the checker in the background until the returned function is called
+func (c *Checker) Start() (stop func()) {
+	ch, cancel := c.bus.Subscribe("low-stock checker", 256)
+	go func() {
+		for event := range ch {
+			c.handle(event)
+		}
+	}()
+	return cancel
+}
+
+// handle checks one event for a threshold crossing
+func (c *Checker) handle(event events.Event) {
+	switch event.Type {
+	case events.ItemCreated, events.ItemUpdated, events.ItemRestored:
+		c.check(*event.Item)
+	case events.ItemDeleted:
+		c.mu.Lock()
+		delete(c.low, event.Item.ID)
+		c.mu.Unlock()
+	case events.InventoryImported:
+		// An import changes items wholesale; start again from what is stored
+		if err := c.load(); err != nil {
+			log.Printf("Low-stock checker failed to reload items: %v", err)
+		}
+	}
+}
+
+// check publishes an alert if item crossed its minimum since it was last seen
+func (c *Checker) check(item model.Item) {
+	c.mu.Lock()
+	wasLow := c.low[item.ID]
+	isLow := item.LowStock()
+	if isLow {
+		c.low[item.ID] = true
+	} else {
+		delete(c.low, item.ID)
+	}
+	c.mu.Unlock()
+
+	alert := model.NewLowStockAlert(item)
+	switch {
+	case isLow && !wasLow:
+		log.Printf("Low stock: %s has %d, minimum %d", item.Name, item.Number, item.MinQuantity)
+		c.bus.Publish(events.Event{Type: events.LowStock, Item: &item, Alert: &alert})
+	case !isLow && wasLow:
+		log.Printf("Restocked: %s has %d, minimum %d", item.Name, item.Number, item.MinQuantity)
+		c.bus.Publish(events.Event{Type: events.Restocked, Item: &item, Alert: &alert})
+	}
+}
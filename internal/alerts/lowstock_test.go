@@ -0,0 +1,188 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// itemList serves a fixed set of items to the checker
+type itemList []model.Item
+
+func (l *itemList) GetAllItems() ([]model.Item, error) {
+	return *l, nil
+}
+
+// drain returns the types of the events waiting on ch
+func drain(ch <-chan events.Event) []string {
+	var types []string
+	for {
+		select {
+		case event := <-ch:
+			types = append(types, event.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestLowStock(t *testing.T) {
+	items := []model.Item{
+		{Name: "Tips", Number: 2, MinQuantity: 5},
+		{Name: "Agar", Number: 0, MinQuantity: 1},
+		{Name: "Gloves", Number: 5, MinQuantity: 5},
+		{Name: "Beakers", Number: 0},
+	}
+
+	alerts := LowStock(items)
+	var names []string
+	for _, alert := range alerts {
+		if !alert.Low {
+			t.Errorf("alert %+v is not low", alert)
+		}
+		names = append(names, alert.Name)
+	}
+	if strings.Join(names, ",") != "Agar,Tips" {
+		t.Errorf("low items %v, want Agar and Tips", names)
+	}
+	if alerts := LowStock(nil); alerts == nil || len(alerts) != 0 {
+		t.Errorf("LowStock(nil) = %#v, want an empty list", alerts)
+	}
+}
+
+func TestCheckerTransitions(t *testing.T) {
+	id := primitive.NewObjectID()
+	item := func(number, minimum int) *model.Item {
+		return &model.Item{ID: id, Name: "Pipette tips", Number: number, MinQuantity: minimum, ReorderQuantity: 50}
+	}
+
+	tests := []struct {
+		name   string
+		stored itemList // What the store holds when the checker starts
+		events []events.Event
+		want   []string // Alerts published, in order
+	}{
+		{"drops below minimum", nil, []events.Event{
+			{Type: events.ItemCreated, Item: item(10, 5)},
+			{Type: events.ItemUpdated, Item: item(4, 5)},
+		}, []string{events.LowStock}},
+		{"created low", nil, []events.Event{
+			{Type: events.ItemCreated, Item: item(1, 5)},
+		}, []string{events.LowStock}},
+		{"alerts once while low", nil, []events.Event{
+			{Type: events.ItemUpdated, Item: item(4, 5)},
+			{Type: events.ItemUpdated, Item: item(3, 5)},
+			{Type: events.ItemUpdated, Item: item(0, 5)},
+		}, []string{events.LowStock}},
+		{"reaching the minimum restocks", nil, []events.Event{
+			{Type: events.ItemUpdated, Item: item(4, 5)},
+			{Type: events.ItemUpdated, Item: item(5, 5)},
+			{Type: events.ItemUpdated, Item: item(20, 5)},
+		}, []string{events.LowStock, events.Restocked}},
+		{"drops again after restocking", nil, []events.Event{
+			{Type: events.ItemUpdated, Item: item(4, 5)},
+			{Type: events.ItemUpdated, Item: item(9, 5)},
+			{Type: events.ItemUpdated, Item: item(2, 5)},
+		}, []string{events.LowStock, events.Restocked, events.LowStock}},
+		{"minimum raised above stock", nil, []events.Event{
+			{Type: events.ItemUpdated, Item: item(10, 5)},
+			{Type: events.ItemUpdated, Item: item(10, 20)},
+			{Type: events.ItemUpdated, Item: item(10, 0)},
+		}, []string{events.LowStock, events.Restocked}},
+		{"no minimum", nil, []events.Event{
+			{Type: events.ItemUpdated, Item: item(0, 0)},
+		}, nil},
+		{"already low at start", itemList{*item(1, 5)}, []events.Event{
+			{Type: events.ItemUpdated, Item: item(0, 5)},
+			{Type: events.ItemUpdated, Item: item(6, 5)},
+		}, []string{events.Restocked}},
+		{"deleted while low", nil, []events.Event{
+			{Type: events.ItemUpdated, Item: item(1, 5)},
+			{Type: events.ItemDeleted, Item: item(1, 5)},
+			{Type: events.ItemRestored, Item: item(1, 5)},
+		}, []string{events.LowStock, events.LowStock}},
+		{"other events", nil, []events.Event{
+			{Type: events.LocationCreated},
+			{Type: events.ItemUpdated, Item: item(1, 5)},
+		}, []string{events.LowStock}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := events.NewBus()
+			published, cancel := bus.Subscribe("test", 16)
+			defer cancel()
+
+			c, err := NewChecker(bus, &tt.stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, event := range tt.events {
+				c.handle(event)
+			}
+
+			if got := drain(published); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("published %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckerReloadsOnImport(t *testing.T) {
+	id := primitive.NewObjectID()
+	low := model.Item{ID: id, Name: "Agar", Number: 1, MinQuantity: 5}
+
+	bus := events.NewBus()
+	published, cancel := bus.Subscribe("test", 16)
+	defer cancel()
+
+	stored := itemList{}
+	c, err := NewChecker(bus, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The import brought the item in low; that is taken as the starting point
+	stored = itemList{low}
+	c.handle(events.Event{Type: events.InventoryImported})
+	c.handle(events.Event{Type: events.ItemUpdated, Item: &low})
+	if got := drain(published); len(got) != 0 {
+		t.Fatalf("published %v after an import, want nothing", got)
+	}
+
+	restocked := low
+	restocked.Number = 5
+	c.handle(events.Event{Type: events.ItemUpdated, Item: &restocked})
+	if got := drain(published); strings.Join(got, ",") != events.Restocked {
+		t.Fatalf("published %v, want %s", got, events.Restocked)
+	}
+}
+
+func TestCheckerPublishesAlert(t *testing.T) {
+	bus := events.NewBus()
+	published, cancel := bus.Subscribe("test", 16)
+	defer cancel()
+
+	c, err := NewChecker(bus, &itemList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := c.Start()
+	defer stop()
+
+	item := model.Item{ID: primitive.NewObjectID(), Name: "Tips", Number: 3, MinQuantity: 10, ReorderQuantity: 100}
+	bus.Publish(events.Event{Type: events.ItemUpdated, Item: &item})
+
+	// The test subscriber sees the update first, then the alert
+	<-published
+	event := <-published
+	if event.Type != events.LowStock || event.Alert == nil {
+		t.Fatalf("got %+v, want a low-stock alert", event)
+	}
+	if want := model.NewLowStockAlert(item); *event.Alert != want {
+		t.Errorf("alert %+v, want %+v", *event.Alert, want)
+	}
+}
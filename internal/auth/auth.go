@@ -0,0 +1,385 @@
+// Package auth logs users in with a password or through OpenID Connect single
+// sign-on and keeps them logged in with a session cookie, accepts personal
+// API tokens from scripts, and guards the API so that only logged-in users
+// reach it
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CookieName is the name of the session cookie
+const CookieName = "lab_inv_session"
+
+// TokenPrefix starts every API token, so that leaked tokens are easy to
+// recognize; tokenPrefixLength characters are kept to tell tokens apart
+const (
+	TokenPrefix       = "labinv_"
+	tokenPrefixLength = len(TokenPrefix) + 6
+)
+
+// adminPasswordFileName is the file in the data directory a generated admin
+// password is saved in
+const adminPasswordFileName = "admin-password.txt"
+
+// lastUsedInterval is how stale a token's last use may get before it is
+// written again, so that a busy script does not write on every request
+const lastUsedInterval = time.Minute
+
+// ErrInvalidCredentials is returned by Login for an unknown user or a wrong
+// password; which of the two is deliberately not revealed
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// publicPaths can be reached without logging in
+var publicPaths = map[string]bool{
+	"/api/login":         true,
+	"/api/logout":        true,
+	"/api/oidc/login":    true,
+	"/api/oidc/callback": true,
+}
+
+// Store is the part of the store that holds users, sessions and API tokens
+type Store interface {
+	GetUsers() ([]model.User, error)
+	GetUserByID(id string) (model.User, error)
+	GetUserByUsername(username string) (model.User, error)
+	AddUser(createUser model.CreateUser) (model.User, error)
+	UpdateUser(id string, updateUser model.UpdateUser) (model.User, error)
+	AddSession(session model.Session) error
+	GetSession(id string) (model.Session, error)
+	DeleteSession(id string) error
+	DeleteExpiredSessions(now time.Time) error
+	GetAPITokenByHash(hash string) (model.APIToken, error)
+	TouchAPIToken(id string, lastUsed time.Time) error
+}
+
+// Manager creates and checks sessions
+type Manager struct {
+	store  Store
+	ttl    time.Duration
+	secure bool
+
+	// dummyHash is compared against when a user does not exist, so that
+	// a login takes as long for an unknown user as for a wrong password
+	dummyHash []byte
+}
+
+// New creates a session manager from the auth configuration
+func New(store Store, cfg model.AuthConfig) (*Manager, error) {
+	ttl, err := time.ParseDuration(cfg.SessionTTL)
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("invalid session TTL %q", cfg.SessionTTL)
+	}
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{store: store, ttl: ttl, secure: cfg.SecureCookies, dummyHash: dummyHash}, nil
+}
+
+// EnsureAdmin makes sure someone can administer the inventory. It creates an
+// "admin" user when there are no users at all, so a fresh install can be
+// logged in to, and gives the "admin" user the admin role if nobody has it,
+// as happens to users stored before roles existed. Without a configured
+// password a random one is generated and written to a file in dataDir that
+// only the server's user can read; only the file's path is logged.
+func EnsureAdmin(store Store, password string, dataDir string) error {
+	users, err := store.GetUsers()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Role == model.RoleAdmin {
+			return nil
+		}
+	}
+	for _, user := range users {
+		if user.Username == "admin" {
+			log.Println("Nobody had the admin role; gave it to user \"admin\"")
+			_, err := store.UpdateUser(user.ID.Hex(), model.UpdateUser{Role: model.RoleAdmin})
+			return err
+		}
+	}
+	if len(users) > 0 {
+		log.Println("Warning: no user has the admin role, so nobody can manage users")
+		return nil
+	}
+
+	if password != "" {
+		if _, err := store.AddUser(model.CreateUser{Username: "admin", Password: password, Role: model.RoleAdmin}); err != nil {
+			return err
+		}
+		log.Println("Created user \"admin\" with the configured admin password")
+		return nil
+	}
+
+	if password, err = randomToken(12); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir, adminPasswordFileName)
+	if err := os.WriteFile(path, []byte(password+"\n"), 0o600); err != nil {
+		return fmt.Errorf("saving the generated admin password: %w", err)
+	}
+	if _, err := store.AddUser(model.CreateUser{Username: "admin", Password: password, Role: model.RoleAdmin}); err != nil {
+		os.Remove(path)
+		return err
+	}
+	log.Printf("Created user \"admin\" with a generated password, saved in %s; change it after logging in and delete the file", path)
+	return nil
+}
+
+// Login checks the credentials and starts a session, setting its cookie on w
+func (m *Manager) Login(w http.ResponseWriter, r *http.Request, login model.Login) (model.User, error) {
+	user, err := m.store.GetUserByUsername(login.Username)
+	if err != nil {
+		bcrypt.CompareHashAndPassword(m.dummyHash, []byte(login.Password))
+		return model.User{}, ErrInvalidCredentials
+	}
+	if !CheckPassword(user, login.Password) {
+		return model.User{}, ErrInvalidCredentials
+	}
+
+	if err := m.StartSession(w, r, user); err != nil {
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// CheckPassword reports whether password is user's password. Single sign-on
+// users have none.
+func CheckPassword(user model.User, password string) bool {
+	return user.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// StartSession starts a session for user, setting its cookie on w
+func (m *Manager) StartSession(w http.ResponseWriter, r *http.Request, user model.User) error {
+	// Take the chance to clear out sessions nobody will use again
+	now := time.Now()
+	if err := m.store.DeleteExpiredSessions(now); err != nil {
+		log.Printf("Failed to delete expired sessions: %v", err)
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	session := model.Session{
+		ID:      sessionID(token),
+		UserID:  user.ID,
+		Created: now,
+		Expires: now.Add(m.ttl),
+	}
+	if err := m.store.AddSession(session); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, m.cookie(r, token, int(m.ttl.Seconds())))
+	return nil
+}
+
+// Logout ends the request's session, if it has one, and clears its cookie
+func (m *Manager) Logout(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, m.cookie(r, "", -1))
+
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil
+	}
+	return m.store.DeleteSession(sessionID(cookie.Value))
+}
+
+// NewAPIToken creates a token for user; the result holds the token itself,
+// while the APIToken in it, which holds only its hash, is what gets stored
+func NewAPIToken(user model.User, create model.CreateAPIToken) (model.NewAPITokenResult, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return model.NewAPITokenResult{}, err
+	}
+	token := TokenPrefix + secret
+
+	now := time.Now()
+	apiToken := model.APIToken{
+		ID:      primitive.NewObjectID(),
+		UserID:  user.ID,
+		Name:    strings.TrimSpace(create.Name),
+		Scope:   create.Scope,
+		Prefix:  token[:tokenPrefixLength],
+		Hash:    sessionID(token),
+		Created: now,
+	}
+	if create.ExpiresInDays > 0 {
+		expires := now.AddDate(0, 0, create.ExpiresInDays)
+		apiToken.Expires = &expires
+	}
+
+	return model.NewAPITokenResult{APIToken: apiToken, Token: token}, nil
+}
+
+// Authenticate returns the user whose session cookie or API token came with
+// the request, and the token if it was one
+func (m *Manager) Authenticate(r *http.Request) (model.User, *model.APIToken, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		user, token, err := m.authenticateToken(header)
+		if err != nil {
+			return model.User{}, nil, err
+		}
+		return user, &token, nil
+	}
+
+	user, err := m.authenticateSession(r)
+	return user, nil, err
+}
+
+// authenticateToken checks a "Bearer <token>" Authorization header and
+// records that the token was used
+func (m *Manager) authenticateToken(header string) (model.User, model.APIToken, error) {
+	scheme, value, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(value, TokenPrefix) {
+		return model.User{}, model.APIToken{}, errors.New("invalid authorization header")
+	}
+
+	token, err := m.store.GetAPITokenByHash(sessionID(strings.TrimSpace(value)))
+	if err != nil {
+		return model.User{}, model.APIToken{}, errors.New("invalid API token")
+	}
+	now := time.Now()
+	if token.Expired(now) {
+		return model.User{}, model.APIToken{}, errors.New("API token expired")
+	}
+
+	user, err := m.store.GetUserByID(token.UserID.Hex())
+	if err != nil {
+		return model.User{}, model.APIToken{}, err
+	}
+
+	if token.LastUsed == nil || now.Sub(*token.LastUsed) > lastUsedInterval {
+		if err := m.store.TouchAPIToken(token.ID.Hex(), now); err != nil {
+			log.Printf("Failed to record use of API token %s: %v", token.Prefix, err)
+		}
+		token.LastUsed = &now
+	}
+	return user, token, nil
+}
+
+// authenticateSession returns the user whose session cookie came with the request
+func (m *Manager) authenticateSession(r *http.Request) (model.User, error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil || cookie.Value == "" {
+		return model.User{}, errors.New("not logged in")
+	}
+
+	session, err := m.store.GetSession(sessionID(cookie.Value))
+	if err != nil {
+		return model.User{}, errors.New("not logged in")
+	}
+	if time.Now().After(session.Expires) {
+		return model.User{}, errors.New("session expired")
+	}
+
+	return m.store.GetUserByID(session.UserID.Hex())
+}
+
+// Middleware rejects API requests that are not from a logged-in user, and
+// makes the user of the others available through UserFrom, and the API
+// token they used, if any, through TokenFrom. Static files, the login and
+// logout endpoints and CORS preflight requests pass freely.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || publicPaths[r.URL.Path] || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, token, err := m.Authenticate(r)
+		if err != nil {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		ctx := WithUser(r.Context(), user)
+		if token != nil {
+			ctx = WithToken(ctx, *token)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// cookie builds the session cookie; it is only sent over HTTPS when the
+// server is configured or reached that way
+func (m *Manager) cookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   m.secure || r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// contextKey keys the user in a request context, tokenContextKey the API token
+type (
+	contextKey      struct{}
+	tokenContextKey struct{}
+)
+
+// WithUser returns a copy of ctx carrying user
+func WithUser(ctx context.Context, user model.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFrom returns the logged-in user Middleware put in ctx
+func UserFrom(ctx context.Context) (model.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(model.User)
+	return user, ok
+}
+
+// WithToken returns a copy of ctx carrying the API token a request came with
+func WithToken(ctx context.Context, token model.APIToken) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// TokenFrom returns the API token Middleware put in ctx; there is none for
+// requests from a browser session
+func TokenFrom(ctx context.Context) (model.APIToken, bool) {
+	token, ok := ctx.Value(tokenContextKey{}).(model.APIToken)
+	return token, ok
+}
+
+// randomToken returns n random bytes, base64 encoded for use in a cookie
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionID is what a session is stored under: a hash of its cookie token.
+// API tokens are stored under the same hash.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
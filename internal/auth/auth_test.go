@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lab-inv/internal/model"
+	"lab-inv/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestManager returns a session manager over an empty MemoryStore
+// holding one user
+func newTestManager(t *testing.T) (*Manager, *storage.MemoryStore, model.User) {
+	t.Helper()
+
+	store := storage.NewMemoryStore(model.Inventory{})
+	user, err := store.AddUser(model.CreateUser{Username: "alice", Password: "correct horse", Role: model.RoleMember})
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	manager, err := New(store, model.AuthConfig{SessionTTL: "1h"})
+	if err != nil {
+		t.Fatalf("creating manager: %v", err)
+	}
+	return manager, store, user
+}
+
+// addToken creates and stores an API token for user
+func addToken(t *testing.T, store storage.Store, user model.User, create model.CreateAPIToken) model.NewAPITokenResult {
+	t.Helper()
+
+	created, err := NewAPIToken(user, create)
+	if err != nil {
+		t.Fatalf("creating token: %v", err)
+	}
+	if err := store.AddAPIToken(created.APIToken); err != nil {
+		t.Fatalf("storing token: %v", err)
+	}
+	return created
+}
+
+// bearer returns a request carrying an Authorization header
+func bearer(header string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	r.Header.Set("Authorization", header)
+	return r
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	manager, store, user := newTestManager(t)
+	created := addToken(t, store, user, model.CreateAPIToken{Name: "label printer", Scope: model.ScopeReadOnly, ExpiresInDays: 30})
+
+	if created.Hash == created.Token || created.Hash != sessionID(created.Token) {
+		t.Fatal("token is not stored hashed")
+	}
+	if created.Prefix != created.Token[:tokenPrefixLength] {
+		t.Fatalf("prefix %q does not start token", created.Prefix)
+	}
+
+	got, token, err := manager.Authenticate(bearer("Bearer " + created.Token))
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got.ID != user.ID || token == nil || token.ID != created.ID || token.Scope != model.ScopeReadOnly {
+		t.Fatalf("got user %+v, token %+v", got, token)
+	}
+
+	stored, err := store.GetAPITokenByHash(created.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.LastUsed == nil || time.Since(*stored.LastUsed) > time.Minute {
+		t.Fatalf("last use not recorded: %v", stored.LastUsed)
+	}
+
+	// The scheme is case-insensitive
+	if _, _, err := manager.Authenticate(bearer("bearer " + created.Token)); err != nil {
+		t.Fatalf("lower-case scheme: %v", err)
+	}
+}
+
+func TestAuthenticateTokenRejected(t *testing.T) {
+	manager, store, user := newTestManager(t)
+	valid := addToken(t, store, user, model.CreateAPIToken{Name: "script", Scope: model.ScopeFull})
+
+	expired, err := NewAPIToken(user, model.CreateAPIToken{Name: "old", Scope: model.ScopeFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	expired.Expires = &past
+	if err := store.AddAPIToken(expired.APIToken); err != nil {
+		t.Fatal(err)
+	}
+
+	// A token left behind by a user who no longer exists
+	orphan := addToken(t, store, model.User{ID: primitive.NewObjectID()}, model.CreateAPIToken{Name: "orphan", Scope: model.ScopeFull})
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"no scheme", valid.Token},
+		{"basic scheme", "Basic " + valid.Token},
+		{"empty bearer", "Bearer "},
+		{"missing prefix", "Bearer " + valid.Token[len(TokenPrefix):]},
+		{"unknown token", "Bearer " + TokenPrefix + "not-a-real-token"},
+		{"expired", "Bearer " + expired.Token},
+		{"user gone", "Bearer " + orphan.Token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if user, _, err := manager.Authenticate(bearer(tt.header)); err == nil {
+				t.Fatalf("authenticated as %+v", user)
+			}
+		})
+	}
+}
+
+func TestDeletingUserRevokesTokens(t *testing.T) {
+	manager, store, user := newTestManager(t)
+	created := addToken(t, store, user, model.CreateAPIToken{Name: "script", Scope: model.ScopeFull})
+
+	if err := store.DeleteUser(user.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := manager.Authenticate(bearer("Bearer " + created.Token)); err == nil {
+		t.Fatal("token of a deleted user still authenticates")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	manager, store, user := newTestManager(t)
+	created := addToken(t, store, user, model.CreateAPIToken{Name: "script", Scope: model.ScopeStockAdjust})
+
+	var (
+		gotUser  model.User
+		gotToken model.APIToken
+		hasToken bool
+	)
+	handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = UserFrom(r.Context())
+		gotToken, hasToken = TokenFrom(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, bearer("Bearer "+created.Token))
+	if w.Code != http.StatusOK || gotUser.ID != user.ID || !hasToken || gotToken.ID != created.ID {
+		t.Fatalf("got %d, user %+v, token %+v", w.Code, gotUser, gotToken)
+	}
+
+	tests := []struct {
+		name string
+		r    *http.Request
+		code int
+	}{
+		{"malformed header", bearer("Token " + created.Token), http.StatusUnauthorized},
+		{"no credentials", httptest.NewRequest(http.MethodGet, "/api/items", nil), http.StatusUnauthorized},
+		{"public path", httptest.NewRequest(http.MethodPost, "/api/login", nil), http.StatusOK},
+		{"static file", httptest.NewRequest(http.MethodGet, "/index.html", nil), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.r)
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestEnsureAdmin(t *testing.T) {
+	t.Run("configured password", func(t *testing.T) {
+		store := storage.NewMemoryStore(model.Inventory{})
+		dataDir := t.TempDir()
+		if err := EnsureAdmin(store, "correct horse", dataDir); err != nil {
+			t.Fatal(err)
+		}
+		admin, err := store.GetUserByUsername("admin")
+		if err != nil || admin.Role != model.RoleAdmin || !CheckPassword(admin, "correct horse") {
+			t.Fatalf("admin %+v, err %v", admin, err)
+		}
+		if _, err := os.Stat(filepath.Join(dataDir, adminPasswordFileName)); !os.IsNotExist(err) {
+			t.Fatalf("password file written for a configured password: %v", err)
+		}
+	})
+
+	t.Run("generated password", func(t *testing.T) {
+		store := storage.NewMemoryStore(model.Inventory{})
+		dataDir := t.TempDir()
+		var logged bytes.Buffer
+		log.SetOutput(&logged)
+		defer log.SetOutput(os.Stderr)
+
+		if err := EnsureAdmin(store, "", dataDir); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dataDir, adminPasswordFileName)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("password file mode %v, want 0600", info.Mode().Perm())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		password := strings.TrimSpace(string(data))
+
+		admin, err := store.GetUserByUsername("admin")
+		if err != nil || !CheckPassword(admin, password) {
+			t.Fatalf("saved password does not log in as admin: %v", err)
+		}
+		if strings.Contains(logged.String(), password) {
+			t.Fatalf("password written to the log: %s", logged.String())
+		}
+		if !strings.Contains(logged.String(), path) {
+			t.Fatalf("log does not say where the password is: %s", logged.String())
+		}
+	})
+
+	t.Run("existing users", func(t *testing.T) {
+		_, store, user := newTestManager(t)
+		dataDir := t.TempDir()
+		if err := EnsureAdmin(store, "", dataDir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetUserByUsername("admin"); err == nil {
+			t.Fatal("admin created although users exist")
+		}
+		if got, _ := store.GetUserByID(user.ID.Hex()); got.Role != model.RoleMember {
+			t.Fatalf("existing user's role changed to %q", got.Role)
+		}
+	})
+}
@@ -0,0 +1,454 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+const (
+	// oidcCookieName holds the state, nonce and PKCE verifier of a sign-on
+	// in progress, for oidcCookieTTL
+	oidcCookieName = "lab_inv_oidc"
+	oidcCookieTTL  = 10 * time.Minute
+
+	// clockSkew is how far the provider's clock may be ahead of ours
+	clockSkew = time.Minute
+)
+
+// ErrNoRole is returned by Provision for a user none of whose groups maps
+// to a role, when there is no default role
+var ErrNoRole = errors.New("none of your groups is allowed to use the inventory")
+
+// Identity is who the provider says signed on
+type Identity struct {
+	Subject  string
+	Username string
+	Groups   []string
+}
+
+// providerMetadata is the part of the provider's discovery document in use
+type providerMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// OIDC logs users in through an OpenID Connect provider with the
+// authorization code flow, using PKCE and checking the signed ID token
+type OIDC struct {
+	cfg    model.OIDCConfig
+	secure bool
+	client *http.Client
+
+	mu       sync.Mutex
+	provider *providerMetadata         // Discovered on first use, so the provider may be down at start
+	keys     map[string]*rsa.PublicKey // The provider's signing keys by key ID
+}
+
+// NewOIDC creates the single sign-on client from the auth configuration
+func NewOIDC(cfg model.AuthConfig) *OIDC {
+	return &OIDC{
+		cfg:    cfg.OIDC,
+		secure: cfg.SecureCookies,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Redirect starts a sign-on, sending the browser to the provider
+func (o *OIDC) Redirect(w http.ResponseWriter, r *http.Request) error {
+	provider, err := o.discover()
+	if err != nil {
+		return err
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = randomToken(32); err != nil {
+			return err
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+	http.SetCookie(w, o.cookie(r, state+"."+nonce+"."+verifier, int(oidcCookieTTL.Seconds())))
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.cfg.ClientID},
+		"redirect_uri":          {o.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, o.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+separator+query.Encode(), http.StatusFound)
+	return nil
+}
+
+// Callback finishes a sign-on when the provider sends the browser back,
+// exchanging the code for an ID token and returning who it identifies
+func (o *OIDC) Callback(w http.ResponseWriter, r *http.Request) (Identity, error) {
+	cookie, err := r.Cookie(oidcCookieName)
+	http.SetCookie(w, o.cookie(r, "", -1))
+	if err != nil {
+		return Identity{}, errors.New("the sign-on took too long or was not started here; try again")
+	}
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return Identity{}, errors.New("invalid sign-on cookie")
+	}
+	state, nonce, verifier := parts[0], parts[1], parts[2]
+
+	query := r.URL.Query()
+	if code := query.Get("error"); code != "" {
+		if description := query.Get("error_description"); description != "" {
+			code = description
+		}
+		return Identity{}, fmt.Errorf("the identity provider refused: %s", code)
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		return Identity{}, errors.New("sign-on state does not match; try again")
+	}
+	code := query.Get("code")
+	if code == "" {
+		return Identity{}, errors.New("the identity provider sent no code")
+	}
+
+	provider, err := o.discover()
+	if err != nil {
+		return Identity{}, err
+	}
+	idToken, err := o.exchange(provider, code, verifier)
+	if err != nil {
+		return Identity{}, err
+	}
+	claims, err := o.verify(provider, idToken, nonce)
+	if err != nil {
+		return Identity{}, err
+	}
+	return o.identity(claims)
+}
+
+// Provision returns the user for identity, creating it on their first
+// sign-on, and gives them the role their groups map to
+func (o *OIDC) Provision(store Store, identity Identity) (model.User, error) {
+	role := o.role(identity.Groups)
+	if role == "" {
+		return model.User{}, ErrNoRole
+	}
+
+	user, err := store.GetUserByUsername(identity.Username)
+	if err != nil {
+		createUser := model.CreateUser{Username: identity.Username, Role: role, OIDCSubject: identity.Subject}
+		createUser.Normalize()
+		if err := createUser.Validate(); err != nil {
+			return model.User{}, err
+		}
+		return store.AddUser(createUser)
+	}
+
+	// A local user, or another provider account, of the same name keeps it
+	if user.OIDCSubject != identity.Subject {
+		return model.User{}, fmt.Errorf("the user name %q belongs to another account", identity.Username)
+	}
+	if user.Role != role {
+		return store.UpdateUser(user.ID.Hex(), model.UpdateUser{Role: role})
+	}
+	return user, nil
+}
+
+// role returns the highest role the groups map to, or the default role
+func (o *OIDC) role(groups []string) string {
+	roles := []string{}
+	for _, group := range groups {
+		if role, ok := o.cfg.GroupRoles[group]; ok {
+			roles = append(roles, role)
+		}
+	}
+	if role := model.HighestRole(roles); role != "" {
+		return role
+	}
+	return o.cfg.DefaultRole
+}
+
+// discover reads the provider's discovery document, once it succeeds
+func (o *OIDC) discover() (providerMetadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.provider != nil {
+		return *o.provider, nil
+	}
+
+	var provider providerMetadata
+	if err := o.getJSON(strings.TrimSuffix(o.cfg.Issuer, "/")+"/.well-known/openid-configuration", &provider); err != nil {
+		return providerMetadata{}, fmt.Errorf("failed to discover the identity provider: %w", err)
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != strings.TrimSuffix(o.cfg.Issuer, "/") {
+		return providerMetadata{}, fmt.Errorf("identity provider reports issuer %q, not %q", provider.Issuer, o.cfg.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return providerMetadata{}, errors.New("identity provider discovery document is incomplete")
+	}
+
+	o.provider = &provider
+	return provider, nil
+}
+
+// exchange trades the authorization code for an ID token
+func (o *OIDC) exchange(provider providerMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+
+	// Client secrets go in a Basic header unless the provider only takes
+	// them in the form; public clients have none
+	basic := o.cfg.ClientSecret != "" && len(provider.TokenAuthMethods) == 0
+	for _, method := range provider.TokenAuthMethods {
+		basic = basic || (o.cfg.ClientSecret != "" && method == "client_secret_basic")
+	}
+	if !basic {
+		form.Set("client_id", o.cfg.ClientID)
+		if o.cfg.ClientSecret != "" {
+			form.Set("client_secret", o.cfg.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach the identity provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("identity provider refused the code: %s", strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return "", errors.New("identity provider sent no ID token")
+	}
+	return tokens.IDToken, nil
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and
+// nonce, and returns its claims
+func (o *OIDC) verify(provider providerMetadata, idToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed ID token header")
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+	key, err := o.key(provider, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed ID token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("ID token signature is invalid")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed ID token claims")
+	}
+	if claims["iss"] != provider.Issuer {
+		return nil, errors.New("ID token is from another issuer")
+	}
+	if !hasAudience(claims["aud"], o.cfg.ClientID) {
+		return nil, errors.New("ID token is for another client")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Now().After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, errors.New("ID token has expired")
+	}
+	if value, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(value), []byte(nonce)) != 1 {
+		return nil, errors.New("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// key returns the provider's signing key with the given ID, fetching the
+// keys again when it is not known, as happens after the provider rotates them
+func (o *OIDC) key(provider providerMetadata, kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if key, ok := o.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(provider.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch the identity provider's keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || jwk.Use == "enc" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	o.keys = keys
+
+	key, ok := keys[kid]
+	if !ok && kid == "" && len(keys) == 1 {
+		// A token without a key ID is signed with the only key there is
+		for _, only := range keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown ID token signing key %q", kid)
+	}
+	return key, nil
+}
+
+// identity reads the subject, user name and groups out of the ID token claims
+func (o *OIDC) identity(claims map[string]interface{}) (Identity, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Identity{}, errors.New("ID token has no subject")
+	}
+	username, _ := claims[o.cfg.UsernameClaim].(string)
+	if username = model.NormalizeUsername(username); username == "" {
+		return Identity{}, fmt.Errorf("ID token has no %q claim to use as user name", o.cfg.UsernameClaim)
+	}
+
+	// Groups come as a list, or as a single string from some providers
+	groups := []string{}
+	switch value := claims[o.cfg.GroupsClaim].(type) {
+	case string:
+		groups = append(groups, value)
+	case []interface{}:
+		for _, group := range value {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+	}
+
+	return Identity{Subject: subject, Username: username, Groups: groups}, nil
+}
+
+// getJSON fetches address and decodes its JSON body into v
+func (o *OIDC) getJSON(address string, v interface{}) error {
+	resp, err := o.client.Get(address)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", address, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// cookie builds the cookie that carries a sign-on in progress. Unlike the
+// session cookie it must be sent when the provider redirects back, so it is
+// SameSite Lax, and it only goes to the sign-on endpoints.
+func (o *OIDC) cookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     "/api/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   o.secure || r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// decodeSegment decodes one base64url part of a JWT as JSON into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// hasAudience reports whether the aud claim, a string or a list, names clientID
+func hasAudience(aud interface{}, clientID string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == clientID
+	case []interface{}:
+		for _, audience := range value {
+			if audience == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
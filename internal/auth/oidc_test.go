@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"lab-inv/internal/auth/oidctest"
+	"lab-inv/internal/model"
+	"lab-inv/internal/storage"
+)
+
+// testRedirectURL is where the provider sends browsers back to
+const testRedirectURL = "http://lab-inv.test/api/oidc/callback"
+
+// newTestOIDC starts a mock provider under httptest and returns it with a
+// client configured for it
+func newTestOIDC(t *testing.T) (*OIDC, *oidctest.Provider) {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(nil)
+	provider, err := oidctest.New("http://"+server.Listener.Addr().String(), "lab-inv", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Config.Handler = provider
+	server.Start()
+	t.Cleanup(server.Close)
+
+	o := NewOIDC(model.AuthConfig{OIDC: model.OIDCConfig{
+		Issuer:        server.URL,
+		ClientID:      "lab-inv",
+		ClientSecret:  "secret",
+		RedirectURL:   testRedirectURL,
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupRoles:    map[string]string{"lab-members": model.RoleMember, "lab-managers": model.RoleManager},
+	}})
+	return o, provider
+}
+
+// signOn goes through a whole sign-on as a browser would, letting tamper
+// change the callback the provider sends the browser back to
+func signOn(t *testing.T, o *OIDC, username, groups string, tamper func(callback url.Values)) (Identity, error) {
+	t.Helper()
+
+	// lab-inv sends the browser to the provider, with the sign-on in a cookie
+	w := httptest.NewRecorder()
+	if err := o.Redirect(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil)); err != nil {
+		t.Fatalf("Redirect: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	authorize, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || len(cookies) != 1 {
+		t.Fatalf("Redirect sent %q with cookies %v", w.Header().Get("Location"), cookies)
+	}
+
+	// The user signs on at the provider, which sends them back with a code
+	form := authorize.Query()
+	form.Set("username", username)
+	form.Set("groups", groups)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.PostForm(authorize.Scheme+"://"+authorize.Host+authorize.Path, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("provider answered %d, redirecting to %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	query := callback.Query()
+	if tamper != nil {
+		tamper(query)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+query.Encode(), nil)
+	r.AddCookie(cookies[0])
+	return o.Callback(httptest.NewRecorder(), r)
+}
+
+func TestOIDCSignOn(t *testing.T) {
+	o, _ := newTestOIDC(t)
+
+	identity, err := signOn(t, o, "Alice", "lab-members, chemistry", nil)
+	if err != nil {
+		t.Fatalf("sign-on failed: %v", err)
+	}
+	if identity.Subject != "mock-Alice" || identity.Username != "alice" {
+		t.Fatalf("identity = %+v", identity)
+	}
+	if strings.Join(identity.Groups, ",") != "lab-members,chemistry" {
+		t.Fatalf("groups = %v", identity.Groups)
+	}
+}
+
+func TestOIDCRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims map[string]interface{})
+		forge  bool
+		tamper func(callback url.Values)
+		want   string
+	}{
+		{name: "bad state", tamper: func(callback url.Values) { callback.Set("state", "forged") }, want: "state does not match"},
+		{name: "missing code", tamper: func(callback url.Values) { callback.Del("code") }, want: "no code"},
+		{name: "provider error", tamper: func(callback url.Values) { callback.Set("error", "access_denied") }, want: "access_denied"},
+		{name: "bad nonce", claims: func(claims map[string]interface{}) { claims["nonce"] = "replayed" }, want: "nonce does not match"},
+		{name: "wrong audience", claims: func(claims map[string]interface{}) { claims["aud"] = "another-app" }, want: "another client"},
+		{name: "wrong issuer", claims: func(claims map[string]interface{}) { claims["iss"] = "https://evil.example" }, want: "another issuer"},
+		{name: "expired", claims: func(claims map[string]interface{}) {
+			claims["exp"] = time.Now().Add(-clockSkew - time.Minute).Unix()
+		}, want: "expired"},
+		{name: "no user name", claims: func(claims map[string]interface{}) { delete(claims, "preferred_username") }, want: "user name"},
+		{name: "bad signature", forge: true, want: "signature is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, provider := newTestOIDC(t)
+			provider.SetClaims(tt.claims)
+			if err := provider.ForgeSignatures(tt.forge); err != nil {
+				t.Fatal(err)
+			}
+
+			identity, err := signOn(t, o, "alice", "lab-members", tt.tamper)
+			if err == nil {
+				t.Fatalf("signed on as %+v", identity)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCAudienceList(t *testing.T) {
+	o, provider := newTestOIDC(t)
+	provider.SetClaims(func(claims map[string]interface{}) { claims["aud"] = []string{"other", "lab-inv"} })
+
+	if _, err := signOn(t, o, "alice", "lab-members", nil); err != nil {
+		t.Fatalf("token for several audiences refused: %v", err)
+	}
+}
+
+func TestOIDCCallbackWithoutCookie(t *testing.T) {
+	o, _ := newTestOIDC(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=x&state=y", nil)
+	if _, err := o.Callback(httptest.NewRecorder(), r); err == nil {
+		t.Fatal("callback without a sign-on in progress succeeded")
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	o, provider := newTestOIDC(t)
+
+	if _, err := signOn(t, o, "alice", "lab-members", nil); err != nil {
+		t.Fatalf("first sign-on: %v", err)
+	}
+	before := provider.KeyID()
+	if err := provider.RotateKey(); err != nil {
+		t.Fatal(err)
+	}
+	if provider.KeyID() == before {
+		t.Fatal("key ID did not change")
+	}
+
+	// The new key is unknown, so the keys are fetched again
+	if _, err := signOn(t, o, "alice", "lab-members", nil); err != nil {
+		t.Fatalf("sign-on after rotation: %v", err)
+	}
+	if _, ok := o.keys[before]; ok {
+		t.Fatal("retired key is still trusted")
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	o, _ := newTestOIDC(t)
+
+	tests := []struct {
+		groups      []string
+		defaultRole string
+		want        string
+	}{
+		{[]string{"lab-members"}, "", model.RoleMember},
+		{[]string{"lab-members", "lab-managers"}, "", model.RoleManager},
+		{[]string{"lab-managers", "lab-members"}, "", model.RoleManager},
+		{[]string{"chemistry"}, "", ""},
+		{[]string{"chemistry"}, model.RoleViewer, model.RoleViewer},
+		{nil, model.RoleViewer, model.RoleViewer},
+		{[]string{"lab-members"}, model.RoleViewer, model.RoleMember},
+	}
+	for _, tt := range tests {
+		o.cfg.DefaultRole = tt.defaultRole
+		if got := o.role(tt.groups); got != tt.want {
+			t.Errorf("role(%v) with default %q = %q, want %q", tt.groups, tt.defaultRole, got, tt.want)
+		}
+	}
+}
+
+func TestOIDCProvision(t *testing.T) {
+	o, _ := newTestOIDC(t)
+	store := storage.NewMemoryStore(model.Inventory{})
+
+	// The first sign-on creates the user, without a password
+	alice := Identity{Subject: "sub-alice", Username: "alice", Groups: []string{"lab-members"}}
+	user, err := o.Provision(store, alice)
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	if user.Username != "alice" || user.Role != model.RoleMember || user.OIDCSubject != "sub-alice" || user.PasswordHash != "" {
+		t.Fatalf("provisioned %+v", user)
+	}
+
+	// Later ones keep the user and follow their groups
+	alice.Groups = []string{"lab-managers"}
+	again, err := o.Provision(store, alice)
+	if err != nil {
+		t.Fatalf("Provision again: %v", err)
+	}
+	if again.ID != user.ID || again.Role != model.RoleManager {
+		t.Fatalf("provisioned again %+v", again)
+	}
+
+	// Nobody takes over an account that is not theirs
+	if _, err := o.Provision(store, Identity{Subject: "sub-mallory", Username: "alice", Groups: []string{"lab-members"}}); err == nil {
+		t.Fatal("another subject took over alice")
+	}
+	if _, err := store.AddUser(model.CreateUser{Username: "bob", Password: "correct horse", Role: model.RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Provision(store, Identity{Subject: "sub-bob", Username: "bob", Groups: []string{"lab-members"}}); err == nil {
+		t.Fatal("sign-on took over a local user")
+	}
+
+	// Users none of whose groups map to a role are refused
+	_, err = o.Provision(store, Identity{Subject: "sub-carol", Username: "carol", Groups: []string{"chemistry"}})
+	if !errors.Is(err, ErrNoRole) {
+		t.Fatalf("got %v, want ErrNoRole", err)
+	}
+	if _, err := store.GetUserByUsername("carol"); err == nil {
+		t.Fatal("refused user was created")
+	}
+}
@@ -0,0 +1,341 @@
+// Package oidctest is a minimal OpenID Connect provider for trying out and
+// testing single sign-on. Its login page signs on anyone as whatever user
+// name and groups are typed in. Never use it for real.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// authorization is a code handed out by the login page, waiting to be
+// exchanged for an ID token
+type authorization struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	username    string
+	groups      []string
+	expires     time.Time
+}
+
+// signingKey is an RSA key published under an ID
+type signingKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+// Provider is the OpenID Connect provider; it serves discovery, the login
+// page, the token endpoint and its keys as an http.Handler
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	mux          *http.ServeMux
+
+	mu     sync.Mutex
+	key    signingKey
+	forged *rsa.PrivateKey // Signs ID tokens instead of key when set; never published
+	claims func(claims map[string]interface{})
+	codes  map[string]authorization
+}
+
+// loginPage asks who to sign on as, passing the authorization request along
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><title>Mock OIDC provider</title></head>
+<body>
+<h1>Mock OIDC provider</h1>
+<form method="post" action="/authorize">
+<p><label>User name <input name="username" value="alice" autofocus></label></p>
+<p><label>Groups (comma separated) <input name="groups" value="lab-members"></label></p>
+{{range $name, $value := .}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<p><button type="submit">Sign on</button></p>
+</form>
+</body></html>
+`))
+
+// New creates a provider reached at issuer, for one client
+func New(issuer, clientID, clientSecret string) (*Provider, error) {
+	p := &Provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		codes:        make(map[string]authorization),
+	}
+	if err := p.RotateKey(); err != nil {
+		return nil, err
+	}
+
+	p.mux = http.NewServeMux()
+	p.mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	p.mux.HandleFunc("/authorize", p.handleAuthorize)
+	p.mux.HandleFunc("/token", p.handleToken)
+	p.mux.HandleFunc("/jwks", p.handleJWKS)
+	return p, nil
+}
+
+// ServeHTTP serves the provider's endpoints
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+// RotateKey replaces the signing key with a new one under a new key ID.
+// Only the new key is published from then on.
+func (p *Provider) RotateKey() error {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = signingKey{id: "mock-" + strconv.FormatInt(time.Now().UnixNano(), 36), key: key}
+	return nil
+}
+
+// KeyID returns the ID of the key ID tokens are signed with
+func (p *Provider) KeyID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.key.id
+}
+
+// SetClaims makes fn change the claims of every ID token from then on,
+// before it is signed, e.g. to issue expired tokens; nil stops it
+func (p *Provider) SetClaims(fn func(claims map[string]interface{})) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = fn
+}
+
+// ForgeSignatures makes ID tokens be signed with a key that is not
+// published, under the published key's ID, as an attacker's would be
+func (p *Provider) ForgeSignatures(forge bool) error {
+	var key *rsa.PrivateKey
+	if forge {
+		var err error
+		if key, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.forged = key
+	return nil
+}
+
+// handleDiscovery serves the discovery document
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"jwks_uri":                              p.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// handleAuthorize shows the login page on GET and, on POST, hands out a code
+// and sends the browser back to the client
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("client_id") != p.clientID || r.Form.Get("response_type") != "code" {
+		http.Error(w, "unknown client or unsupported response type", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		params := map[string]string{}
+		for _, name := range []string{"client_id", "response_type", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params[name] = r.Form.Get(name)
+		}
+		loginPage.Execute(w, params)
+
+	case http.MethodPost:
+		code := randomString()
+		groups := []string{}
+		for _, group := range strings.Split(r.Form.Get("groups"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				groups = append(groups, group)
+			}
+		}
+
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			redirectURI: r.Form.Get("redirect_uri"),
+			nonce:       r.Form.Get("nonce"),
+			challenge:   r.Form.Get("code_challenge"),
+			username:    r.Form.Get("username"),
+			groups:      groups,
+			expires:     time.Now().Add(time.Minute),
+		}
+		p.mu.Unlock()
+
+		query := url.Values{"code": {code}, "state": {r.Form.Get("state")}}
+		http.Redirect(w, r, r.Form.Get("redirect_uri")+"?"+query.Encode(), http.StatusFound)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleToken exchanges a code for a signed ID token
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if id != p.clientID || secret != p.clientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	auth, found := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	switch {
+	case r.Form.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type")
+		return
+	case !found || time.Now().After(auth.expires) || r.Form.Get("redirect_uri") != auth.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken, err := p.sign(map[string]interface{}{
+		"iss":                p.issuer,
+		"sub":                "mock-" + auth.username,
+		"aud":                p.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              auth.nonce,
+		"preferred_username": auth.username,
+		"groups":             auth.groups,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendJSON(w, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// handleJWKS serves the public signing key
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	key := p.key
+	p.mu.Unlock()
+
+	sendJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": key.id,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.key.E)).Bytes()),
+		}},
+	})
+}
+
+// sign encodes claims as a JWT signed with RS256, after letting the claims
+// hook change them
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	p.mu.Lock()
+	key, forged, hook := p.key, p.forged, p.claims
+	p.mu.Unlock()
+
+	if hook != nil {
+		hook(claims)
+	}
+	signer := key.key
+	if forged != nil {
+		signer = forged
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": key.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// tokenError refuses a token request with an OAuth error code
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+// sendJSON writes data as a JSON response
+func sendJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
+
+// randomString returns an unguessable string for codes and tokens
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
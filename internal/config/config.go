@@ -0,0 +1,311 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Prefix for all environment variables read by Load
+	envPrefix = "LAB_INV_"
+
+	// Default values used when nothing else is configured
+	defaultDatabaseName = "lab_inventory"
+	defaultPort         = ":8080"
+	defaultStore        = "mongo"
+	defaultDataDir      = "./data"
+	defaultRetries      = 3
+	defaultRetryBackoff = "1s"
+
+	defaultWebhookRetries      = 5
+	defaultWebhookRetryBackoff = "5s"
+
+	// Most retries a notify channel or webhook delivery may be configured with
+	maxRetries = 20
+
+	defaultTrashRetention = "720h"
+	defaultSessionTTL     = "12h"
+
+	defaultOIDCUsernameClaim = "preferred_username"
+	defaultOIDCGroupsClaim   = "groups"
+)
+
+// Default returns the configuration used when no file, environment or flags are given
+func Default() model.Config {
+	return model.Config{
+		DatabaseName: defaultDatabaseName,
+		Port:         defaultPort,
+		Store:        defaultStore,
+		DataDir:      defaultDataDir,
+		Notify: model.NotifyConfig{
+			Retries:      defaultRetries,
+			RetryBackoff: defaultRetryBackoff,
+		},
+		Webhooks: model.WebhookConfig{
+			Retries:      defaultWebhookRetries,
+			RetryBackoff: defaultWebhookRetryBackoff,
+		},
+		Auth: model.AuthConfig{
+			SessionTTL: defaultSessionTTL,
+			OIDC: model.OIDCConfig{
+				UsernameClaim: defaultOIDCUsernameClaim,
+				GroupsClaim:   defaultOIDCGroupsClaim,
+			},
+		},
+		TrashRetention: defaultTrashRetention,
+	}
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the defaults, a JSON or YAML config file, LAB_INV_* environment variables
+// and command-line flags. The configuration flags are registered on fs, so
+// callers may add flags of their own before calling Load.
+// The result is validated before it is returned.
+func Load(fs *flag.FlagSet, args []string) (model.Config, error) {
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a JSON or YAML config file")
+	mongoURI := fs.String("mongo-uri", "", "MongoDB connection string")
+	databaseName := fs.String("db", "", "MongoDB database name")
+	port := fs.String("port", "", "HTTP listen address, e.g. :8080")
+	store := fs.String("store", "", "storage backend: mongo, bolt, file or memory")
+	dataDir := fs.String("data", "", "data directory for file-based backends")
+
+	if err := fs.Parse(args); err != nil {
+		return model.Config{}, err
+	}
+
+	cfg := Default()
+
+	// Config file
+	if *configPath != "" {
+		if err := loadFile(*configPath, &cfg); err != nil {
+			return model.Config{}, err
+		}
+	}
+
+	// Environment variables
+	applyEnv(&cfg)
+
+	// Command-line flags, only those explicitly set
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mongo-uri":
+			cfg.MongoURI = *mongoURI
+		case "db":
+			cfg.DatabaseName = *databaseName
+		case "port":
+			cfg.Port = *port
+		case "store":
+			cfg.Store = *store
+		case "data":
+			cfg.DataDir = *dataDir
+		}
+	})
+
+	cfg.Port = normalizePort(cfg.Port)
+
+	if err := Validate(cfg); err != nil {
+		return model.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile merges the JSON or YAML file at path into cfg.
+// The format is chosen from the file extension.
+func loadFile(path string, cfg *model.Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overrides cfg with any LAB_INV_* environment variables that are set
+func applyEnv(cfg *model.Config) {
+	vars := map[string]*string{
+		"MONGO_URI":       &cfg.MongoURI,
+		"DATABASE_NAME":   &cfg.DatabaseName,
+		"PORT":            &cfg.Port,
+		"STORE":           &cfg.Store,
+		"DATA_DIR":        &cfg.DataDir,
+		"TRASH_RETENTION": &cfg.TrashRetention,
+		"ADMIN_PASSWORD":  &cfg.Auth.AdminPassword,
+
+		"OIDC_ISSUER":        &cfg.Auth.OIDC.Issuer,
+		"OIDC_CLIENT_ID":     &cfg.Auth.OIDC.ClientID,
+		"OIDC_CLIENT_SECRET": &cfg.Auth.OIDC.ClientSecret,
+		"OIDC_REDIRECT_URL":  &cfg.Auth.OIDC.RedirectURL,
+	}
+
+	for name, field := range vars {
+		if value, ok := os.LookupEnv(envPrefix + name); ok {
+			*field = value
+		}
+	}
+}
+
+// normalizePort turns a bare port number like "8080" into a listen address
+func normalizePort(port string) string {
+	if port != "" && !strings.Contains(port, ":") {
+		return ":" + port
+	}
+	return port
+}
+
+// Validate checks that cfg is complete and consistent
+func Validate(cfg model.Config) error {
+	_, portStr, err := net.SplitHostPort(cfg.Port)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", cfg.Port)
+	}
+	if n, err := strconv.Atoi(portStr); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q", cfg.Port)
+	}
+
+	switch cfg.Store {
+	case "mongo":
+		if cfg.MongoURI == "" {
+			return errors.New("mongo_uri is required for the mongo store")
+		}
+		if !strings.HasPrefix(cfg.MongoURI, "mongodb://") && !strings.HasPrefix(cfg.MongoURI, "mongodb+srv://") {
+			return errors.New("mongo_uri must start with mongodb:// or mongodb+srv://")
+		}
+		if cfg.DatabaseName == "" {
+			return errors.New("database_name is required for the mongo store")
+		}
+	case "file", "bolt":
+		if cfg.DataDir == "" {
+			return fmt.Errorf("data_dir is required for the %s store", cfg.Store)
+		}
+	case "memory":
+	default:
+		return fmt.Errorf("unknown store %q", cfg.Store)
+	}
+
+	if d, err := time.ParseDuration(cfg.TrashRetention); err != nil || d < 0 {
+		return fmt.Errorf("invalid trash_retention %q", cfg.TrashRetention)
+	}
+
+	if d, err := time.ParseDuration(cfg.Auth.SessionTTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid auth.session_ttl %q", cfg.Auth.SessionTTL)
+	}
+	if cfg.Auth.AdminPassword != "" && len(cfg.Auth.AdminPassword) < model.MinPasswordLength {
+		return fmt.Errorf("auth.admin_password must be at least %d characters", model.MinPasswordLength)
+	}
+
+	if err := validateOIDC(cfg.Auth.OIDC); err != nil {
+		return err
+	}
+
+	if err := validateRetry("webhooks", cfg.Webhooks.Retries, cfg.Webhooks.RetryBackoff); err != nil {
+		return err
+	}
+	return validateNotify(cfg.Notify)
+}
+
+// validateOIDC checks the single sign-on settings, if it is turned on
+func validateOIDC(cfg model.OIDCConfig) error {
+	if cfg.Issuer == "" {
+		return nil
+	}
+
+	if !strings.HasPrefix(cfg.Issuer, "http://") && !strings.HasPrefix(cfg.Issuer, "https://") {
+		return errors.New("auth.oidc.issuer must start with http:// or https://")
+	}
+	if !strings.HasPrefix(cfg.RedirectURL, "http://") && !strings.HasPrefix(cfg.RedirectURL, "https://") {
+		return errors.New("auth.oidc.redirect_url must start with http:// or https://")
+	}
+	if cfg.ClientID == "" {
+		return errors.New("auth.oidc.client_id is required")
+	}
+	if cfg.UsernameClaim == "" || cfg.GroupsClaim == "" {
+		return errors.New("auth.oidc.username_claim and auth.oidc.groups_claim must not be empty")
+	}
+	for group, role := range cfg.GroupRoles {
+		if !model.ValidRole(role) {
+			return fmt.Errorf("auth.oidc.group_roles: unknown role %q for group %q", role, group)
+		}
+	}
+	if cfg.DefaultRole != "" && !model.ValidRole(cfg.DefaultRole) {
+		return fmt.Errorf("invalid auth.oidc.default_role %q", cfg.DefaultRole)
+	}
+	return nil
+}
+
+// validateRetry checks the retry settings of the named section
+func validateRetry(section string, retries int, backoff string) error {
+	if retries < 0 || retries > maxRetries {
+		return fmt.Errorf("%s.retries must be between 0 and %d", section, maxRetries)
+	}
+	if d, err := time.ParseDuration(backoff); err != nil || d < 0 {
+		return fmt.Errorf("invalid %s.retry_backoff %q", section, backoff)
+	}
+	return nil
+}
+
+// validateNotify checks the notification settings
+func validateNotify(cfg model.NotifyConfig) error {
+	if err := validateRetry("notify", cfg.Retries, cfg.RetryBackoff); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for i, channel := range cfg.Channels {
+		if channel.Name == "" {
+			return fmt.Errorf("notify.channels[%d]: name is required", i)
+		}
+		if names[channel.Name] {
+			return fmt.Errorf("notify channel %q is defined twice", channel.Name)
+		}
+		names[channel.Name] = true
+
+		switch channel.Type {
+		case "smtp":
+			if channel.SMTPAddr == "" || channel.From == "" || len(channel.To) == 0 {
+				return fmt.Errorf("notify channel %q: smtp_addr, from and to are required", channel.Name)
+			}
+			if _, _, err := net.SplitHostPort(channel.SMTPAddr); err != nil {
+				return fmt.Errorf("notify channel %q: invalid smtp_addr %q", channel.Name, channel.SMTPAddr)
+			}
+		case "webhook":
+			if !strings.HasPrefix(channel.URL, "http://") && !strings.HasPrefix(channel.URL, "https://") {
+				return fmt.Errorf("notify channel %q: url must start with http:// or https://", channel.Name)
+			}
+		case "log":
+		default:
+			return fmt.Errorf("notify channel %q: unknown type %q", channel.Name, channel.Type)
+		}
+
+		for _, pattern := range channel.Events {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("notify channel %q: invalid event pattern %q", channel.Name, pattern)
+			}
+		}
+	}
+
+	return nil
+}
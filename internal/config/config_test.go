@@ -0,0 +1,116 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateRetry(t *testing.T) {
+	tests := []struct {
+		retries int
+		backoff string
+		valid   bool
+	}{
+		{0, "0s", true},
+		{3, "1s", true},
+		{maxRetries, "5s", true},
+		{-1, "1s", false},
+		{maxRetries + 1, "1s", false},
+		{1000000, "1s", false},
+		{3, "-1s", false},
+		{3, "soon", false},
+	}
+	for _, tt := range tests {
+		err := validateRetry("webhooks", tt.retries, tt.backoff)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateRetry(%d, %q) = %v, want valid %v", tt.retries, tt.backoff, err, tt.valid)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(jsonFile, []byte(`{"store": "file", "port": "9000", "data_dir": "/srv/file"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	yamlFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(yamlFile, []byte("store: bolt\nport: \":9001\"\ndata_dir: /srv/yaml\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		store   string
+		port    string
+		dataDir string
+	}{
+		{"defaults", nil, []string{"-store", "memory"}, "memory", ":8080", "./data"},
+		{"JSON file", nil, []string{"-config", jsonFile}, "file", ":9000", "/srv/file"},
+		{"YAML file", nil, []string{"-config", yamlFile}, "bolt", ":9001", "/srv/yaml"},
+		{"file from env", map[string]string{"CONFIG": yamlFile}, nil, "bolt", ":9001", "/srv/yaml"},
+		{"env over file", map[string]string{"STORE": "memory", "PORT": "9100"}, []string{"-config", jsonFile}, "memory", ":9100", "/srv/file"},
+		{"flags over env", map[string]string{"STORE": "memory", "DATA_DIR": "/srv/env"}, []string{"-config", jsonFile, "-store", "bolt", "-port", "127.0.0.1:9200"}, "bolt", "127.0.0.1:9200", "/srv/env"},
+		{"flags over everything", map[string]string{"DATA_DIR": "/srv/env"}, []string{"-config", jsonFile, "-data", "/srv/flag"}, "file", ":9000", "/srv/flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"CONFIG", "MONGO_URI", "DATABASE_NAME", "PORT", "STORE", "DATA_DIR"} {
+				t.Setenv(envPrefix+name, tt.env[name])
+				if _, ok := tt.env[name]; !ok {
+					os.Unsetenv(envPrefix + name)
+				}
+			}
+
+			cfg, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Store != tt.store || cfg.Port != tt.port || cfg.DataDir != tt.dataDir {
+				t.Errorf("got store %q, port %q, data dir %q; want %q, %q, %q", cfg.Store, cfg.Port, cfg.DataDir, tt.store, tt.port, tt.dataDir)
+			}
+			if cfg.TrashRetention != defaultTrashRetention || cfg.Notify.Retries != defaultRetries {
+				t.Errorf("defaults not kept: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.yaml")
+	if err := os.WriteFile(broken, []byte("store: [file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"missing file", []string{"-config", filepath.Join(dir, "missing.json")}},
+		{"unparsable file", []string{"-config", broken}},
+		{"unknown store", []string{"-store", "postgres"}},
+		{"mongo without URI", []string{"-store", "mongo"}},
+		{"bad port", []string{"-store", "memory", "-port", "99999"}},
+		{"unknown flag", []string{"-verbose"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"CONFIG", "MONGO_URI", "PORT", "STORE"} {
+				t.Setenv(envPrefix+name, "")
+				os.Unsetenv(envPrefix + name)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			if _, err := Load(fs, tt.args); err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Package events carries inventory change notifications from the store to
+// whoever wants them, such as the low-stock checker.
+package events
+
+import (
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+// Event types
+const (
+	ItemCreated       = "item.created"
+	ItemUpdated       = "item.updated"
+	ItemDeleted       = "item.deleted"
+	ItemRestored      = "item.restored"
+	LocationCreated   = "location.created"
+	LocationUpdated   = "location.updated"
+	LocationDeleted   = "location.deleted"
+	LocationRestored  = "location.restored"
+	InventoryImported = "inventory.imported"
+	LowStock          = "alert.low_stock" // An item's stock dropped below its minimum
+	Restocked         = "alert.restocked" // A low item is back at or above its minimum
+)
+
+// Event is one change to the inventory. Item, Location, Import or Alert is
+// set depending on the type; deletes carry the record as it was.
+type Event struct {
+	Type     string               `json:"type"`
+	Time     time.Time            `json:"time"`
+	Item     *model.Item          `json:"item,omitempty"`
+	Location *model.Location      `json:"location,omitempty"`
+	Import   *model.ImportSummary `json:"import,omitempty"`
+	Alert    *model.LowStockAlert `json:"alert,omitempty"`
+}
+
+// Bus fans events out to subscribers.
+// Publishing never blocks: a subscriber whose buffer is full misses the event.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]string
+}
+
+// NewBus creates a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]string)}
+}
+
+// Subscribe returns a channel receiving every event published from now on,
+// buffering up to buffer of them, and a function that ends the subscription.
+// name identifies the subscriber in log messages.
+func (b *Bus) Subscribe(name string, buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = name
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to every subscriber, stamping the time if unset
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch, name := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Dropping %s event for %s: subscriber is falling behind", event.Type, name)
+		}
+	}
+}
+
+// Match reports whether an event type matches any of the patterns, where
+// "*" matches any part of a type ("item.*", "*.deleted"). No patterns match everything.
+func Match(patterns []string, eventType string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+// Column is one column of a tabular items-with-locations export
+type Column struct {
+	Key    string // Name used in ?columns= and -columns
+	Header string // Title written in the header row
+	value  func(item model.ItemWithLocation) interface{}
+}
+
+// columns lists every column that can be exported, by key
+var columns = map[string]Column{
+	"id": {Key: "id", Header: "ID", value: func(i model.ItemWithLocation) interface{} {
+		return i.ID.Hex()
+	}},
+	"name": {Key: "name", Header: "Name", value: func(i model.ItemWithLocation) interface{} {
+		return i.Name
+	}},
+	"location": {Key: "location", Header: "Location", value: func(i model.ItemWithLocation) interface{} {
+		return i.Location
+	}},
+	"number": {Key: "number", Header: "Number", value: func(i model.ItemWithLocation) interface{} {
+		return i.Number
+	}},
+	"total": {Key: "total", Header: "Total Number", value: func(i model.ItemWithLocation) interface{} {
+		return i.Total
+	}},
+	"price": {Key: "price", Header: "Unit Price", value: func(i model.ItemWithLocation) interface{} {
+		return i.Price
+	}},
+	"value": {Key: "value", Header: "Total Value", value: func(i model.ItemWithLocation) interface{} {
+		return math.Round(i.Price*float64(i.Number)*100) / 100
+	}},
+	"modified": {Key: "modified", Header: "Modified", value: func(i model.ItemWithLocation) interface{} {
+		return i.Modified.Format(time.RFC3339)
+	}},
+}
+
+// DefaultColumns is used when no columns are requested
+const DefaultColumns = "name,location,number,price,value"
+
+// ParseColumns turns a comma-separated list of column keys into columns
+func ParseColumns(spec string) ([]Column, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultColumns
+	}
+
+	var selected []Column
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		column, ok := columns[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", key)
+		}
+		selected = append(selected, column)
+	}
+
+	return selected, nil
+}
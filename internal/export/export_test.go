@@ -0,0 +1,176 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var rows = []model.ItemWithLocation{
+	{ID: primitive.NewObjectID(), Name: "Pipette tips", Location: "Lab / Shelf A", Price: 12.5, Number: 4, Total: 6},
+	{ID: primitive.NewObjectID(), Name: "=HYPERLINK(\"x\")", Location: "Lab", Price: 0.1, Number: 3, Total: 3},
+}
+
+// each feeds rows to a WriteItems callback
+func each(fn func(model.ItemWithLocation) error) error {
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		spec    string
+		headers []string
+		valid   bool
+	}{
+		{"", []string{"Name", "Location", "Number", "Unit Price", "Total Value"}, true},
+		{"  ", []string{"Name", "Location", "Number", "Unit Price", "Total Value"}, true},
+		{"id,total", []string{"ID", "Total Number"}, true},
+		{" Name , PRICE ", []string{"Name", "Unit Price"}, true},
+		{"name,name", []string{"Name", "Name"}, true},
+		{"name,colour", nil, false},
+		{"name,", nil, false},
+	}
+	for _, tt := range tests {
+		columns, err := ParseColumns(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseColumns(%q) = %v, want valid %v", tt.spec, err, tt.valid)
+			continue
+		}
+		var headers []string
+		for _, column := range columns {
+			headers = append(headers, column.Header)
+		}
+		if strings.Join(headers, ",") != strings.Join(tt.headers, ",") {
+			t.Errorf("ParseColumns(%q) headers = %v, want %v", tt.spec, headers, tt.headers)
+		}
+	}
+}
+
+func TestWriteItemsCSV(t *testing.T) {
+	columns, err := ParseColumns("name,location,number,total,price,value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteItems(&buf, FormatCSV, columns, each); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"Name", "Location", "Number", "Total Number", "Unit Price", "Total Value"},
+		{"Pipette tips", "Lab / Shelf A", "4", "6", "12.50", "50.00"},
+		{"'=HYPERLINK(\"x\")", "Lab", "3", "3", "0.10", "0.30"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d: %v", len(records), len(want), records)
+	}
+	for i := range want {
+		if strings.Join(records[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("record %d = %q, want %q", i, records[i], want[i])
+		}
+	}
+}
+
+func TestWriteItemsXLSX(t *testing.T) {
+	columns, err := ParseColumns("name,number,value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteItems(&buf, FormatXLSX, columns, each); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("workbook lacks %s", name)
+		}
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c>`,
+		`<c r="B2"><v>4</v></c><c r="C2"><v>50</v></c>`,
+		`<t xml:space="preserve">=HYPERLINK(&#34;x&#34;)</t>`,
+		`<c r="C3"><v>0.3</v></c></row></sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet lacks %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestWriteItemsErrors(t *testing.T) {
+	columns, _ := ParseColumns("")
+	failed := errors.New("store gone")
+	tests := []struct {
+		name   string
+		format string
+		each   func(func(model.ItemWithLocation) error) error
+		want   string
+	}{
+		{"unknown format", "ods", each, "unknown export format"},
+		{"failing source", FormatCSV, func(func(model.ItemWithLocation) error) error { return failed }, failed.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WriteItems(io.Discard, tt.format, columns, tt.each)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{27, "AB"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := columnName(tt.index); got != tt.want {
+			t.Errorf("columnName(%d) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
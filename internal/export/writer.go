@@ -0,0 +1,110 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"lab-inv/internal/model"
+)
+
+const (
+	// Supported export formats
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// RowWriter writes items one row at a time, so exports never hold the
+// whole inventory in memory
+type RowWriter interface {
+	WriteItem(item model.ItemWithLocation) error
+	// Close flushes any buffered output; it does not close the underlying writer
+	Close() error
+}
+
+// ContentType returns the MIME type of the given format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewWriter creates a RowWriter for format and writes the header row
+func NewWriter(w io.Writer, format string, columns []Column) (RowWriter, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// csvWriter writes items as comma-separated values
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), columns: columns}
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+	}
+	if err := cw.w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+// WriteItem writes one item as a CSV record
+func (c *csvWriter) WriteItem(item model.ItemWithLocation) error {
+	record := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		switch v := column.value(item).(type) {
+		case string:
+			record[i] = escapeFormula(v)
+		case int:
+			record[i] = strconv.Itoa(v)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', 2, 64)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+// Close flushes buffered records
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeFormula stops spreadsheet programs from evaluating text cells as formulas
+func escapeFormula(s string) string {
+	if s != "" && (s[0] == '=' || s[0] == '+' || s[0] == '-' || s[0] == '@') {
+		return "'" + s
+	}
+	return s
+}
+
+// WriteItems streams every item produced by each to w in the given format
+func WriteItems(w io.Writer, format string, columns []Column, each func(func(model.ItemWithLocation) error) error) error {
+	rw, err := NewWriter(w, format, columns)
+	if err != nil {
+		return err
+	}
+
+	if err := each(rw.WriteItem); err != nil {
+		return err
+	}
+
+	return rw.Close()
+}
@@ -0,0 +1,184 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// headerAliases maps accepted CSV header names to the field they fill
+var headerAliases = map[string]string{
+	"name":        "name",
+	"location":    "location",
+	"location_id": "location",
+	"price":       "price",
+	"unit price":  "price",
+	"number":      "number",
+	"quantity":    "number",
+}
+
+// ParseItemsCSV reads items from CSV with a header row naming the columns
+// name, location, price and number. The location may be given by ID or by
+// its full path ("Lab / Shelf A" or "Lab/Shelf A", case-insensitive). When
+// createMissing is set, every level of the path that does not exist yet is
+// created under the one before it; otherwise unknown locations are row errors.
+//
+// Nothing is written: the result is an inventory of new records ready for
+// a merge import, plus the errors of every rejected row. Callers should only
+// import when there are no errors, which makes the batch all-or-nothing.
+func ParseItemsCSV(r io.Reader, locations []model.Location, createMissing bool) (model.Inventory, []model.RowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return model.Inventory{}, nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return model.Inventory{}, nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	// Work out which column holds which field
+	index := map[string]int{}
+	for i, name := range header {
+		field, ok := headerAliases[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return model.Inventory{}, nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		index[field] = i
+	}
+	for _, required := range []string{"name", "location"} {
+		if _, ok := index[required]; !ok {
+			return model.Inventory{}, nil, fmt.Errorf("CSV is missing the %q column", required)
+		}
+	}
+
+	// Locations can be named by ID, by full path ("Storage Room / Shelf B")
+	// or, for top-level locations, by plain name
+	byID := make(map[string]primitive.ObjectID, len(locations))
+	byName := make(map[string]primitive.ObjectID, len(locations))
+	for id, path := range model.LocationPaths(locations) {
+		byID[id.Hex()] = id
+		byName[pathKey(splitPath(path))] = id
+	}
+
+	result := model.Inventory{Items: []model.Item{}, Locations: []model.Location{}}
+	var rowErrors []model.RowError
+	now := time.Now()
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return model.Inventory{}, nil, err
+			}
+			rowErrors = append(rowErrors, model.RowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		row, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		createItem := model.CreateItem{
+			Name:       field("name"),
+			LocationID: field("location"),
+		}
+		if value := field("price"); value != "" {
+			createItem.Price, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				rowErrors = append(rowErrors, model.RowError{Row: row, Error: fmt.Sprintf("invalid price %q", value)})
+				continue
+			}
+		}
+		if value := field("number"); value != "" {
+			createItem.Number, err = strconv.Atoi(value)
+			if err != nil {
+				rowErrors = append(rowErrors, model.RowError{Row: row, Error: fmt.Sprintf("invalid number %q", value)})
+				continue
+			}
+		}
+
+		// Same rules as items created through the API
+		if err := createItem.Validate(); err != nil {
+			rowErrors = append(rowErrors, model.RowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		// Resolve the location by ID first, then by path
+		path := splitPath(createItem.LocationID)
+		locationID, ok := byID[createItem.LocationID]
+		if !ok {
+			locationID, ok = byName[pathKey(path)]
+		}
+		if !ok {
+			if !createMissing || len(path) == 0 {
+				rowErrors = append(rowErrors, model.RowError{Row: row, Error: fmt.Sprintf("location %q does not exist", createItem.LocationID)})
+				continue
+			}
+
+			// Find or create each level under the one before it
+			var parentID *primitive.ObjectID
+			for i, name := range path {
+				key := pathKey(path[:i+1])
+				id, exists := byName[key]
+				if !exists {
+					location := model.Location{
+						ID:       primitive.NewObjectID(),
+						Name:     name,
+						ParentID: parentID,
+						Modified: now,
+					}
+					result.Locations = append(result.Locations, location)
+					byName[key] = location.ID
+					id = location.ID
+				}
+				parentID = &id
+			}
+			locationID = *parentID
+		}
+
+		result.Items = append(result.Items, model.Item{
+			ID:         primitive.NewObjectID(),
+			Name:       createItem.Name,
+			LocationID: locationID,
+			Price:      createItem.Price,
+			Number:     createItem.Number,
+			Modified:   now,
+		})
+	}
+
+	return result, rowErrors, nil
+}
+
+// splitPath splits a location path into the names of its levels
+func splitPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// pathKey is how a path is looked up, ignoring case and spacing around separators
+func pathKey(names []string) string {
+	return strings.ToLower(strings.Join(names, model.LocationPathSeparator))
+}
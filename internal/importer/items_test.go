@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseItemsCSVCreatesPathLevels(t *testing.T) {
+	lab := primitive.NewObjectID()
+	locations := []model.Location{{ID: lab, Name: "Lab"}}
+
+	csv := "name,location\n" +
+		"Beaker,Lab/Shelf A\n" +
+		"Flask,lab / shelf a / Box 1\n" +
+		"Pipette,Storage/Drawer 2\n" +
+		"Tweezers,Lab\n"
+	inventory, rowErrors, err := ParseItemsCSV(strings.NewReader(csv), locations, true)
+	if err != nil || len(rowErrors) > 0 {
+		t.Fatalf("err %v, row errors %v", err, rowErrors)
+	}
+
+	// Every missing level exists once, under the level before it
+	paths := model.LocationPaths(append(locations, inventory.Locations...))
+	var created []string
+	for _, location := range inventory.Locations {
+		created = append(created, paths[location.ID])
+	}
+	want := []string{"Lab / Shelf A", "Lab / Shelf A / Box 1", "Storage", "Storage / Drawer 2"}
+	if strings.Join(created, ",") != strings.Join(want, ",") {
+		t.Fatalf("created %q, want %q", created, want)
+	}
+
+	stored := map[string]string{}
+	for _, item := range inventory.Items {
+		stored[item.Name] = paths[item.LocationID]
+	}
+	for name, path := range map[string]string{
+		"Beaker":   "Lab / Shelf A",
+		"Flask":    "Lab / Shelf A / Box 1",
+		"Pipette":  "Storage / Drawer 2",
+		"Tweezers": "Lab",
+	} {
+		if stored[name] != path {
+			t.Errorf("%s stored in %q, want %q", name, stored[name], path)
+		}
+	}
+}
+
+func TestParseItemsCSVUnknownPath(t *testing.T) {
+	lab := primitive.NewObjectID()
+	shelf := primitive.NewObjectID()
+	locations := []model.Location{{ID: lab, Name: "Lab"}, {ID: shelf, Name: "Shelf A", ParentID: &lab}}
+
+	csv := "name,location\n" +
+		"Beaker,Lab/Shelf A\n" +
+		"Flask,Lab/Shelf B\n" +
+		"Pipette," + shelf.Hex() + "\n"
+	inventory, rowErrors, err := ParseItemsCSV(strings.NewReader(csv), locations, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowErrors) != 1 || rowErrors[0].Row != 3 {
+		t.Fatalf("row errors %v, want one for row 3", rowErrors)
+	}
+	if len(inventory.Locations) != 0 || len(inventory.Items) != 2 {
+		t.Fatalf("got %d locations and %d items", len(inventory.Locations), len(inventory.Items))
+	}
+	for _, item := range inventory.Items {
+		if item.LocationID != shelf {
+			t.Errorf("%s stored in %s, want Shelf A", item.Name, item.LocationID.Hex())
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+	"lab-inv/internal/storage"
+)
+
+// LegacyItem is an item in the old integer-ID inventory.json format
+type LegacyItem struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	LocationID int       `json:"location_id"`
+	Price      float64   `json:"price"`
+	Number     int       `json:"number"`
+	Modified   time.Time `json:"modified"`
+}
+
+// LegacyLocation is a location in the old integer-ID inventory.json format
+type LegacyLocation struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Modified time.Time `json:"modified"`
+}
+
+// LegacyInventory is the top-level document of the old inventory.json format
+type LegacyInventory struct {
+	Items     []LegacyItem     `json:"items"`
+	Locations []LegacyLocation `json:"locations"`
+}
+
+// Report summarizes what a migration did, or would do in dry-run mode
+type Report struct {
+	DryRun           bool
+	LocationsCreated int
+	LocationsReused  int
+	ItemsCreated     int
+	ItemsSkipped     int
+	Orphans          []LegacyItem // Items whose location_id matches no legacy location
+}
+
+// String formats the report for the command line
+func (r Report) String() string {
+	var b strings.Builder
+	if r.DryRun {
+		b.WriteString("Dry run: no changes were written\n")
+	}
+	fmt.Fprintf(&b, "Locations created: %d\n", r.LocationsCreated)
+	fmt.Fprintf(&b, "Locations reused:  %d\n", r.LocationsReused)
+	fmt.Fprintf(&b, "Items created:     %d\n", r.ItemsCreated)
+	fmt.Fprintf(&b, "Items skipped:     %d\n", r.ItemsSkipped)
+	fmt.Fprintf(&b, "Orphaned items:    %d\n", len(r.Orphans))
+	for _, orphan := range r.Orphans {
+		fmt.Fprintf(&b, "  - #%d %q references missing location %d\n", orphan.ID, orphan.Name, orphan.LocationID)
+	}
+	return b.String()
+}
+
+// ReadLegacy reads an inventory.json file in the old integer-ID format
+func ReadLegacy(path string) (LegacyInventory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LegacyInventory{}, err
+	}
+
+	var legacy LegacyInventory
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return LegacyInventory{}, fmt.Errorf("%s is not a legacy inventory file: %w", path, err)
+	}
+
+	return legacy, nil
+}
+
+// Run copies a legacy inventory into store, assigning new ObjectIDs and
+// remapping location references. Legacy locations become top-level
+// locations; one whose full path already exists in the store is reused, and
+// items already stocked at their target location are skipped, so running the
+// migration twice does not duplicate records.
+// Items referencing unknown locations are reported as orphans and not migrated.
+// In dry-run mode the store is only read, never written.
+func Run(store storage.Store, legacy LegacyInventory, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun}
+
+	existingLocations, err := store.GetAllLocations()
+	if err != nil {
+		return report, err
+	}
+	// Location names are unique among siblings regardless of case
+	locationsByPath := make(map[string]string, len(existingLocations))
+	for id, path := range model.LocationPaths(existingLocations) {
+		locationsByPath[strings.ToLower(path)] = id.Hex()
+	}
+
+	existingItems, err := store.GetAllItems()
+	if err != nil {
+		return report, err
+	}
+	itemKeys := make(map[string]bool, len(existingItems))
+	for _, item := range existingItems {
+		item.Normalize()
+		for _, level := range item.Stock {
+			itemKeys[level.LocationID.Hex()+"/"+item.Name] = true
+		}
+	}
+
+	// Map legacy location IDs to store location IDs
+	locationIDs := make(map[int]string, len(legacy.Locations))
+	for _, legacyLocation := range legacy.Locations {
+		path := strings.ToLower(legacyLocation.Name)
+		if id, ok := locationsByPath[path]; ok {
+			locationIDs[legacyLocation.ID] = id
+			report.LocationsReused++
+			continue
+		}
+
+		id := fmt.Sprintf("legacy-location-%d", legacyLocation.ID)
+		if !dryRun {
+			location, err := store.AddLocation(model.CreateLocation{Name: legacyLocation.Name})
+			if err != nil {
+				return report, fmt.Errorf("failed to create location %q: %w", legacyLocation.Name, err)
+			}
+			id = location.ID.Hex()
+		}
+		locationIDs[legacyLocation.ID] = id
+		locationsByPath[path] = id
+		report.LocationsCreated++
+	}
+
+	for _, legacyItem := range legacy.Items {
+		locationID, ok := locationIDs[legacyItem.LocationID]
+		if !ok {
+			report.Orphans = append(report.Orphans, legacyItem)
+			continue
+		}
+
+		key := locationID + "/" + legacyItem.Name
+		if itemKeys[key] {
+			report.ItemsSkipped++
+			continue
+		}
+
+		if !dryRun {
+			_, err := store.AddItem(model.CreateItem{
+				Name:       legacyItem.Name,
+				LocationID: locationID,
+				Price:      legacyItem.Price,
+				Number:     legacyItem.Number,
+			})
+			if err != nil {
+				return report, fmt.Errorf("failed to create item %q: %w", legacyItem.Name, err)
+			}
+		}
+		itemKeys[key] = true
+		report.ItemsCreated++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,133 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lab-inv/internal/model"
+	"lab-inv/internal/storage"
+)
+
+var legacy = LegacyInventory{
+	Locations: []LegacyLocation{
+		{ID: 1, Name: "Cold room"},
+		{ID: 2, Name: "Shelf B"},
+	},
+	Items: []LegacyItem{
+		{ID: 10, Name: "Agarose", LocationID: 1, Price: 80, Number: 2},
+		{ID: 11, Name: "Gloves", LocationID: 2, Price: 9.5, Number: 30},
+		{ID: 12, Name: "Gloves", LocationID: 1, Number: 5},
+		{ID: 13, Name: "Lost buffer", LocationID: 7, Number: 1},
+	},
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+		runs   int
+		want   []Report // One per run
+	}{
+		{"migrates", false, 1, []Report{
+			{LocationsCreated: 2, ItemsCreated: 3},
+		}},
+		{"is idempotent", false, 2, []Report{
+			{LocationsCreated: 2, ItemsCreated: 3},
+			{LocationsReused: 2, ItemsSkipped: 3},
+		}},
+		{"dry run writes nothing", true, 2, []Report{
+			{DryRun: true, LocationsCreated: 2, ItemsCreated: 3},
+			{DryRun: true, LocationsCreated: 2, ItemsCreated: 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStore(model.Inventory{})
+			for run := 0; run < tt.runs; run++ {
+				report, err := Run(store, legacy, tt.dryRun)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := tt.want[run]
+				if report.DryRun != want.DryRun || report.LocationsCreated != want.LocationsCreated || report.LocationsReused != want.LocationsReused ||
+					report.ItemsCreated != want.ItemsCreated || report.ItemsSkipped != want.ItemsSkipped {
+					t.Errorf("run %d: got %+v, want %+v", run+1, report, want)
+				}
+				if len(report.Orphans) != 1 || report.Orphans[0].ID != 13 {
+					t.Errorf("run %d: orphans %+v, want item 13", run+1, report.Orphans)
+				}
+			}
+
+			items, _ := store.GetAllItems()
+			locations, _ := store.GetAllLocations()
+			wantItems, wantLocations := 3, 2
+			if tt.dryRun {
+				wantItems, wantLocations = 0, 0
+			}
+			if len(items) != wantItems || len(locations) != wantLocations {
+				t.Fatalf("store has %d items and %d locations, want %d and %d", len(items), len(locations), wantItems, wantLocations)
+			}
+		})
+	}
+}
+
+func TestRunRemapsLocations(t *testing.T) {
+	store := storage.NewMemoryStore(model.Inventory{})
+	// A location that already exists is reused, whatever its case
+	existing, err := store.AddLocation(model.CreateLocation{Name: "COLD ROOM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(store, legacy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.LocationsReused != 1 || report.LocationsCreated != 1 {
+		t.Fatalf("got %+v, want one location reused and one created", report)
+	}
+
+	locations, _ := store.GetAllLocations()
+	paths := model.LocationPaths(locations)
+	items, _ := store.GetAllItems()
+	got := make(map[string]bool, len(items))
+	for _, item := range items {
+		for _, level := range item.Stock {
+			got[item.Name+" @ "+paths[level.LocationID]] = true
+		}
+		if item.Name == "Agarose" && (item.LocationID != existing.ID || item.Price != 80 || item.Number != 2) {
+			t.Errorf("Agarose migrated as %+v", item)
+		}
+	}
+	for _, want := range []string{"Agarose @ COLD ROOM", "Gloves @ Shelf B", "Gloves @ COLD ROOM"} {
+		if !got[want] {
+			t.Errorf("missing %s, got %v", want, got)
+		}
+	}
+}
+
+func TestReadLegacy(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		contents string
+		valid    bool
+	}{
+		{"legacy file", `{"items":[{"id":1,"name":"Beaker","location_id":2}],"locations":[{"id":2,"name":"Lab"}]}`, true},
+		{"ObjectID file", `{"items":[{"id":"65f1c0ffee0000000000abcd","name":"Beaker"}]}`, false},
+		{"not JSON", `items: []`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			legacy, err := ReadLegacy(path)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ReadLegacy = %+v, %v; want valid %v", legacy, err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audited entities
+const (
+	AuditItem      = "item"
+	AuditLocation  = "location"
+	AuditInventory = "inventory" // Bulk imports
+	AuditUser      = "user"
+	AuditToken     = "token" // API tokens
+)
+
+// Audited actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"  // Moved to the trash
+	AuditRestore = "restore" // Brought back from the trash
+	AuditPurge   = "purge"   // Permanently deleted from the trash
+	AuditImport  = "import"
+)
+
+// AuditEntry records one change: who made it, in which request, and the
+// record before and after. Before is empty for a create, After for a delete.
+type AuditEntry struct {
+	ID        primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Entity    string                 `json:"entity" bson:"entity"`
+	EntityID  string                 `json:"entity_id,omitempty" bson:"entity_id,omitempty"`
+	Action    string                 `json:"action" bson:"action"`
+	Actor     string                 `json:"actor" bson:"actor"`
+	RequestID string                 `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Time      time.Time              `json:"time" bson:"time"`
+	Before    map[string]interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After     map[string]interface{} `json:"after,omitempty" bson:"after,omitempty"`
+	Changes   []FieldChange          `json:"changes,omitempty" bson:"changes,omitempty"`
+}
+
+// FieldChange is a top-level field whose value differs between the before
+// and after documents of an audit entry
+type FieldChange struct {
+	Field string      `json:"field" bson:"field"`
+	From  interface{} `json:"from" bson:"from"`
+	To    interface{} `json:"to" bson:"to"`
+}
+
+// AuditFilter selects audit entries; zero fields match everything
+type AuditFilter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	Since    time.Time // Inclusive
+	Until    time.Time // Exclusive
+	Limit    int       // Most recent entries returned
+}
+
+// Matches reports whether an entry passes the filter
+func (f AuditFilter) Matches(entry AuditEntry) bool {
+	return (f.Entity == "" || entry.Entity == f.Entity) &&
+		(f.EntityID == "" || entry.EntityID == f.EntityID) &&
+		(f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.Time.Before(f.Until))
+}
+
+// AuditDocument turns a record into the generic document stored in an audit
+// entry, as it appears in the API
+func AuditDocument(record interface{}) map[string]interface{} {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil
+	}
+	return document
+}
+
+// AuditChanges lists the fields that differ between two documents, by name.
+// Bookkeeping fields that change on every write are left out.
+func AuditChanges(before, after map[string]interface{}) []FieldChange {
+	fields := make(map[string]bool)
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+	delete(fields, "modified")
+	delete(fields, "version")
+
+	var changes []FieldChange
+	for field := range fields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, FieldChange{Field: field, From: before[field], To: after[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
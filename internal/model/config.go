@@ -0,0 +1,74 @@
+package model
+
+// Config represents application configuration
+type Config struct {
+	MongoURI     string        `json:"mongo_uri" yaml:"mongo_uri"`
+	DatabaseName string        `json:"database_name" yaml:"database_name"`
+	Port         string        `json:"port" yaml:"port"`
+	Store        string        `json:"store" yaml:"store"`       // Storage backend: mongo, bolt, file or memory
+	DataDir      string        `json:"data_dir" yaml:"data_dir"` // Directory for file-based backends
+	Notify       NotifyConfig  `json:"notify" yaml:"notify"`
+	Webhooks     WebhookConfig `json:"webhooks" yaml:"webhooks"`
+	Auth         AuthConfig    `json:"auth" yaml:"auth"`
+
+	// How long deleted records stay in the trash before they are purged,
+	// as a duration such as "720h"; "0" keeps them until purged by hand
+	TrashRetention string `json:"trash_retention" yaml:"trash_retention"`
+}
+
+// AuthConfig configures logging in to the web UI and API
+type AuthConfig struct {
+	SessionTTL    string     `json:"session_ttl" yaml:"session_ttl"`       // How long a login lasts, e.g. "12h"
+	SecureCookies bool       `json:"secure_cookies" yaml:"secure_cookies"` // Only send the session cookie over HTTPS
+	AdminPassword string     `json:"admin_password" yaml:"admin_password"` // Password for the admin user created on first start
+	OIDC          OIDCConfig `json:"oidc" yaml:"oidc"`
+}
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider,
+// which is off unless Issuer is set. Users are created on their first login
+// and get the highest role any of their groups maps to at every login.
+type OIDCConfig struct {
+	Issuer        string            `json:"issuer" yaml:"issuer"` // Provider URL; its /.well-known/openid-configuration is read
+	ClientID      string            `json:"client_id" yaml:"client_id"`
+	ClientSecret  string            `json:"client_secret" yaml:"client_secret"`
+	RedirectURL   string            `json:"redirect_url" yaml:"redirect_url"`     // This server's /api/oidc/callback, as the provider reaches users' browsers
+	Scopes        []string          `json:"scopes" yaml:"scopes"`                 // Requested besides "openid"
+	UsernameClaim string            `json:"username_claim" yaml:"username_claim"` // ID token claim holding the user name
+	GroupsClaim   string            `json:"groups_claim" yaml:"groups_claim"`     // ID token claim listing the user's groups
+	GroupRoles    map[string]string `json:"group_roles" yaml:"group_roles"`       // Group name to role
+	DefaultRole   string            `json:"default_role" yaml:"default_role"`     // For users in none of the groups; empty refuses them
+}
+
+// NotifyConfig configures the channels inventory events are sent to.
+// A send that fails is retried, waiting RetryBackoff before the first retry
+// and twice as long before each one after it, up to an hour.
+type NotifyConfig struct {
+	Retries      int             `json:"retries" yaml:"retries"`
+	RetryBackoff string          `json:"retry_backoff" yaml:"retry_backoff"` // Duration such as "2s"
+	Channels     []ChannelConfig `json:"channels" yaml:"channels"`
+}
+
+// WebhookConfig configures how deliveries to registered webhooks are retried.
+// A failed delivery waits RetryBackoff before the first retry and twice as
+// long before each one after it, up to an hour.
+type WebhookConfig struct {
+	Retries      int    `json:"retries" yaml:"retries"`
+	RetryBackoff string `json:"retry_backoff" yaml:"retry_backoff"` // Duration such as "5s"
+}
+
+// ChannelConfig configures one notification channel and the events it receives
+type ChannelConfig struct {
+	Name   string   `json:"name" yaml:"name"`
+	Type   string   `json:"type" yaml:"type"`     // smtp, webhook or log
+	Events []string `json:"events" yaml:"events"` // Event types, "item.*" style patterns allowed; empty for all
+
+	// smtp
+	SMTPAddr string   `json:"smtp_addr" yaml:"smtp_addr"` // host:port of the mail server
+	Username string   `json:"username" yaml:"username"`   // Empty to send without authentication
+	Password string   `json:"password" yaml:"password"`
+	From     string   `json:"from" yaml:"from"`
+	To       []string `json:"to" yaml:"to"`
+
+	// webhook
+	URL string `json:"url" yaml:"url"`
+}
@@ -1,71 +1,280 @@
 package model
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Location represents a physical location where items are stored
+// Location represents a physical location where items are stored.
+// Locations form a tree (building > room > shelf > bin) through ParentID;
+// top-level locations have no parent.
 type Location struct {
-	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name     string             `json:"name" bson:"name"`
-	Modified time.Time          `json:"modified" bson:"modified"`
+	ID       primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name     string              `json:"name" bson:"name"`
+	ParentID *primitive.ObjectID `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	Modified time.Time           `json:"modified" bson:"modified"`
+	Version  int64               `json:"version" bson:"version"` // Incremented on every change; served as the ETag
+	Deletion `bson:",inline"`
 }
 
-// Item represents an inventory item in the Lab
+// Item represents an inventory item in the Lab.
+// Stock holds the quantity kept at each location; LocationID and Number are
+// derived from it (the first location and the total) for older clients.
 type Item struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name       string             `json:"name" bson:"name"`
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name            string             `json:"name" bson:"name"`
+	LocationID      primitive.ObjectID `json:"location_id" bson:"location_id"`
+	Price           float64            `json:"price" bson:"price"`
+	Number          int                `json:"number" bson:"number"` // Total quantity across all locations
+	Stock           []StockLevel       `json:"stock" bson:"stock"`
+	MinQuantity     int                `json:"min_quantity" bson:"min_quantity"`         // Stock is low below this total; 0 disables the alert
+	ReorderQuantity int                `json:"reorder_quantity" bson:"reorder_quantity"` // How many to order when stock is low
+	Modified        time.Time          `json:"modified" bson:"modified"`
+	Version         int64              `json:"version" bson:"version"` // Incremented on every change; served as the ETag
+	Deletion        `bson:",inline"`
+}
+
+// Deletion marks a record that is in the trash; it is empty for live records
+type Deletion struct {
+	DeletedAt   *time.Time          `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy   string              `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	DeletedWith *primitive.ObjectID `json:"deleted_with,omitempty" bson:"deleted_with,omitempty"` // The location whose deletion took this one along
+}
+
+// Trash holds deleted items and locations until they are restored or purged
+type Trash struct {
+	Items     []Item     `json:"items"`
+	Locations []Location `json:"locations"`
+}
+
+// StockLevel is the quantity of an item kept at one location
+type StockLevel struct {
 	LocationID primitive.ObjectID `json:"location_id" bson:"location_id"`
-	Price      float64            `json:"price" bson:"price"`
-	Number     int                `json:"number" bson:"number"` // Quantity/Count
-	Modified   time.Time          `json:"modified" bson:"modified"`
+	Number     int                `json:"number" bson:"number"`
+}
+
+// Normalize brings the derived fields of an item in line with its stock.
+// Items stored before per-location stock existed only have LocationID and
+// Number; those become the single stock entry.
+func (i *Item) Normalize() {
+	if len(i.Stock) == 0 {
+		if i.LocationID.IsZero() {
+			return
+		}
+		i.Stock = []StockLevel{{LocationID: i.LocationID, Number: i.Number}}
+	}
+
+	i.LocationID = i.Stock[0].LocationID
+	i.Number = 0
+	for _, level := range i.Stock {
+		i.Number += level.Number
+	}
+}
+
+// LowStock reports whether the item's total quantity is below its minimum
+func (i *Item) LowStock() bool {
+	return i.Number < i.MinQuantity
 }
 
-// CreateItem represents the data needed to create a new item
+// StoredIn reports whether the item has a stock entry at any of the given locations
+func (i *Item) StoredIn(locationIDs map[primitive.ObjectID]bool) bool {
+	for _, level := range i.Stock {
+		if locationIDs[level.LocationID] {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateItem represents the data needed to create a new item.
+// An item kept in one place can be given by LocationID and Number alone;
+// Stock lists the quantity per location and takes precedence over them.
 type CreateItem struct {
-	Name       string  `json:"name"`
-	LocationID string  `json:"location_id"` // String to receive from frontend
-	Price      float64 `json:"price"`
-	Number     int     `json:"number"` // Quantity/Count
+	Name            string        `json:"name"`
+	LocationID      string        `json:"location_id"` // String to receive from frontend
+	Price           float64       `json:"price"`
+	Number          int           `json:"number"` // Quantity/Count
+	Stock           []CreateStock `json:"stock,omitempty"`
+	MinQuantity     int           `json:"min_quantity"`
+	ReorderQuantity int           `json:"reorder_quantity"`
+}
+
+// CreateStock represents the quantity of a new or updated item at one location
+type CreateStock struct {
+	LocationID string `json:"location_id"`
+	Number     int    `json:"number"`
+}
+
+// StockLevels returns the requested quantity per location
+func (c CreateItem) StockLevels() []CreateStock {
+	if len(c.Stock) > 0 {
+		return c.Stock
+	}
+	return []CreateStock{{LocationID: c.LocationID, Number: c.Number}}
+}
+
+// Validate checks the fields every item create or update must have
+func (c CreateItem) Validate() error {
+	if c.Name == "" {
+		return errors.New("Item name is required")
+	}
+	if c.Price < 0 {
+		return errors.New("Price must be non-negative")
+	}
+	if c.MinQuantity < 0 || c.ReorderQuantity < 0 {
+		return errors.New("Minimum and reorder quantities must be non-negative")
+	}
+
+	seen := make(map[string]bool, len(c.Stock))
+	for _, level := range c.StockLevels() {
+		if level.LocationID == "" {
+			return errors.New("Location ID is required")
+		}
+		if level.Number < 0 {
+			return errors.New("Number must be non-negative")
+		}
+		if seen[level.LocationID] {
+			return errors.New("Each location may only appear once in stock")
+		}
+		seen[level.LocationID] = true
+	}
+	return nil
 }
 
 // CreateLocation represents the data needed to create a new location
 type CreateLocation struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id,omitempty"` // Empty for a top-level location
 }
 
-// ItemWithLocation represents an item with its location name (for display)
+// MoveLocation represents a request to move a location (and its subtree) under a new parent
+type MoveLocation struct {
+	ParentID string `json:"parent_id"` // Empty moves the location to the top level
+}
+
+// LocationPathSeparator joins location names into a full path for display
+const LocationPathSeparator = " / "
+
+// LowStockAlert describes an item whose total quantity is below its minimum
+type LowStockAlert struct {
+	ItemID          primitive.ObjectID `json:"item_id"`
+	Name            string             `json:"name"`
+	Number          int                `json:"number"`
+	MinQuantity     int                `json:"min_quantity"`
+	ReorderQuantity int                `json:"reorder_quantity"`
+	Low             bool               `json:"low"` // False once the item is back at or above its minimum
+}
+
+// NewLowStockAlert describes the item's stock against its minimum
+func NewLowStockAlert(item Item) LowStockAlert {
+	return LowStockAlert{
+		ItemID:          item.ID,
+		Name:            item.Name,
+		Number:          item.Number,
+		MinQuantity:     item.MinQuantity,
+		ReorderQuantity: item.ReorderQuantity,
+		Low:             item.LowStock(),
+	}
+}
+
+// ItemWithLocation represents an item at one of its locations, with the
+// location's full path (for display). An item stocked in several locations
+// appears once per location.
 type ItemWithLocation struct {
-	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name     string             `json:"name" bson:"name"`
-	Location string             `json:"location" bson:"location"`
-	Price    float64            `json:"price" bson:"price"`
-	Number   int                `json:"number" bson:"number"` // Quantity/Count
-	Modified time.Time          `json:"modified" bson:"modified"`
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name       string             `json:"name" bson:"name"`
+	LocationID primitive.ObjectID `json:"location_id" bson:"location_id"`
+	Location   string             `json:"location" bson:"location"`
+	Price      float64            `json:"price" bson:"price"`
+	Number     int                `json:"number" bson:"number"` // Quantity at this location
+	Total      int                `json:"total" bson:"total"`   // Quantity across all locations
+	Modified   time.Time          `json:"modified" bson:"modified"`
 }
 
-// Inventory represents the entire inventory with items and locations (for compatibility)
+// Inventory represents the entire inventory with items and locations, as
+// exported and imported through the API
 type Inventory struct {
 	Items     []Item     `json:"items"`
 	Locations []Location `json:"locations"`
 }
 
-// Config represents application configuration
-type Config struct {
-	MongoURI     string `json:"mongo_uri"`
-	DatabaseName string `json:"database_name"`
-	Port         string `json:"port"`
+// ImportCounts tallies what an import did with one kind of record
+type ImportCounts struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+}
+
+// ImportSummary reports the outcome of an inventory import
+type ImportSummary struct {
+	Mode      string       `json:"mode"`
+	Items     ImportCounts `json:"items"`
+	Locations ImportCounts `json:"locations"`
+}
+
+// RowError describes why one row of a bulk import was rejected
+type RowError struct {
+	Row   int    `json:"row"` // 1-based line number in the uploaded file, header included
+	Error string `json:"error"`
+}
+
+// ItemImportResult reports the outcome of a bulk item import
+type ItemImportResult struct {
+	ItemsCreated     int        `json:"items_created"`
+	LocationsCreated int        `json:"locations_created"`
+	Errors           []RowError `json:"errors"`
+}
+
+// ToItemsWithLocations converts an Item to one ItemWithLocation per stock
+// location, looking up location names in paths
+func (i *Item) ToItemsWithLocations(paths map[primitive.ObjectID]string) []ItemWithLocation {
+	rows := make([]ItemWithLocation, 0, len(i.Stock))
+	for _, level := range i.Stock {
+		name, ok := paths[level.LocationID]
+		if !ok {
+			name = "Unknown"
+		}
+		rows = append(rows, ItemWithLocation{
+			ID:         i.ID,
+			Name:       i.Name,
+			LocationID: level.LocationID,
+			Location:   name,
+			Price:      i.Price,
+			Number:     level.Number,
+			Total:      i.Number,
+			Modified:   i.Modified,
+		})
+	}
+	return rows
 }
 
-// ToItemWithLocation converts an Item to an ItemWithLocation
-func (i *Item) ToItemWithLocation(locationName string) ItemWithLocation {
-	return ItemWithLocation{
-		ID:       i.ID,
-		Name:     i.Name,
-		Location: locationName,
-		Price:    i.Price,
-		Modified: i.Modified,
+// LocationPaths returns the full display path ("Electronics / Shelf B / Bin 12")
+// of every location, keyed by ID. Parents that do not exist end the path,
+// and a cycle in the parent links is cut where it repeats.
+func LocationPaths(locations []Location) map[primitive.ObjectID]string {
+	byID := make(map[primitive.ObjectID]Location, len(locations))
+	for _, location := range locations {
+		byID[location.ID] = location
 	}
+
+	paths := make(map[primitive.ObjectID]string, len(locations))
+	for _, location := range locations {
+		names := []string{location.Name}
+		seen := map[primitive.ObjectID]bool{location.ID: true}
+		for parentID := location.ParentID; parentID != nil && !seen[*parentID]; {
+			parent, ok := byID[*parentID]
+			if !ok {
+				break
+			}
+			seen[parent.ID] = true
+			names = append([]string{parent.Name}, names...)
+			parentID = parent.ParentID
+		}
+		paths[location.ID] = strings.Join(names, LocationPathSeparator)
+	}
+
+	return paths
 }
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Movement types
+const (
+	MovementReceive  = "receive"  // Stock arrives at a location
+	MovementConsume  = "consume"  // Stock is used up at a location
+	MovementTransfer = "transfer" // Stock moves from one location to another
+	MovementAdjust   = "adjust"   // Stock at a location is corrected, up or down
+)
+
+// Movement is one entry in an item's append-only stock ledger.
+// Quantity units leave FromLocationID, if set, and arrive at ToLocationID, if set.
+type Movement struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ItemID         primitive.ObjectID  `json:"item_id" bson:"item_id"`
+	Type           string              `json:"type" bson:"type"`
+	FromLocationID *primitive.ObjectID `json:"from_location_id,omitempty" bson:"from_location_id,omitempty"`
+	ToLocationID   *primitive.ObjectID `json:"to_location_id,omitempty" bson:"to_location_id,omitempty"`
+	Quantity       int                 `json:"quantity" bson:"quantity"` // Always positive
+	Delta          int                 `json:"delta" bson:"delta"`       // Change in the item's total quantity
+	Reason         string              `json:"reason,omitempty" bson:"reason,omitempty"`
+	User           string              `json:"user,omitempty" bson:"user,omitempty"`
+	Created        time.Time           `json:"created" bson:"created"`
+}
+
+// CreateMovement represents a stock movement posted for an item.
+// receive, consume and adjust act on LocationID; transfer moves stock from
+// FromLocationID to ToLocationID. Quantity is positive, except for adjust
+// where its sign says whether stock is added or removed.
+type CreateMovement struct {
+	Type           string `json:"type"`
+	LocationID     string `json:"location_id,omitempty"`
+	FromLocationID string `json:"from_location_id,omitempty"`
+	ToLocationID   string `json:"to_location_id,omitempty"`
+	Quantity       int    `json:"quantity"`
+	Reason         string `json:"reason"`
+	User           string `json:"user"`
+}
+
+// Validate checks that the movement is complete for its type
+func (c CreateMovement) Validate() error {
+	switch c.Type {
+	case MovementReceive, MovementConsume:
+		if c.LocationID == "" {
+			return errors.New("Location ID is required")
+		}
+		if c.Quantity <= 0 {
+			return errors.New("Quantity must be positive")
+		}
+	case MovementTransfer:
+		if c.FromLocationID == "" || c.ToLocationID == "" {
+			return errors.New("From and to location IDs are required")
+		}
+		if c.FromLocationID == c.ToLocationID {
+			return errors.New("Cannot transfer to the same location")
+		}
+		if c.Quantity <= 0 {
+			return errors.New("Quantity must be positive")
+		}
+	case MovementAdjust:
+		if c.LocationID == "" {
+			return errors.New("Location ID is required")
+		}
+		if c.Quantity == 0 {
+			return errors.New("Quantity must not be zero")
+		}
+	default:
+		return fmt.Errorf("unknown movement type %q", c.Type)
+	}
+	return nil
+}
+
+// MovementResult is the outcome of recording a stock movement
+type MovementResult struct {
+	Movement Movement `json:"movement"`
+	Item     Item     `json:"item"` // The item with its stock after the movement
+}
+
+// AdjustStock represents an atomic change to an item's quantity at one location
+type AdjustStock struct {
+	Delta      int    `json:"delta"`                 // Negative to take stock out
+	LocationID string `json:"location_id,omitempty"` // Defaults to the item's first location
+	Reason     string `json:"reason,omitempty"`
+	User       string `json:"user,omitempty"`
+}
+
+// Validate checks that the adjustment changes something
+func (a AdjustStock) Validate() error {
+	if a.Delta == 0 {
+		return errors.New("Delta must not be zero")
+	}
+	return nil
+}
+
+// AdjustResult reports an item's quantities after a stock adjustment
+type AdjustResult struct {
+	ItemID     primitive.ObjectID `json:"item_id"`
+	LocationID primitive.ObjectID `json:"location_id"`
+	Number     int                `json:"number"` // Quantity now at the location
+	Total      int                `json:"total"`  // Quantity now across all locations
+}
+
+// Apply applies a movement to the item's stock, refusing to take a location
+// below zero. Stock arriving at a new location adds a stock entry.
+func (i *Item) Apply(m Movement) error {
+	stock := append([]StockLevel{}, i.Stock...)
+
+	if m.FromLocationID != nil {
+		found := false
+		for n := range stock {
+			if stock[n].LocationID == *m.FromLocationID {
+				if stock[n].Number < m.Quantity {
+					return errors.New("insufficient stock at location")
+				}
+				stock[n].Number -= m.Quantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("item is not stocked at location")
+		}
+	}
+
+	if m.ToLocationID != nil {
+		found := false
+		for n := range stock {
+			if stock[n].LocationID == *m.ToLocationID {
+				stock[n].Number += m.Quantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			stock = append(stock, StockLevel{LocationID: *m.ToLocationID, Number: m.Quantity})
+		}
+	}
+
+	i.Stock = stock
+	i.Normalize()
+	return nil
+}
+
+// LedgerBalance sums movements into the quantity they leave at each location
+func LedgerBalance(movements []Movement) map[primitive.ObjectID]int {
+	balance := make(map[primitive.ObjectID]int)
+	for _, m := range movements {
+		if m.FromLocationID != nil {
+			balance[*m.FromLocationID] -= m.Quantity
+		}
+		if m.ToLocationID != nil {
+			balance[*m.ToLocationID] += m.Quantity
+		}
+	}
+	return balance
+}
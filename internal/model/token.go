@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// API token scopes, each allowing everything the ones before it do. A token
+// never allows more than its user's role does.
+const (
+	ScopeReadOnly    = "read-only"    // GET requests only
+	ScopeStockAdjust = "stock-adjust" // Also adjust stock and record movements
+	ScopeFull        = "full"         // Everything the user may do
+)
+
+// scopeRanks orders the scopes
+var scopeRanks = map[string]int{ScopeReadOnly: 0, ScopeStockAdjust: 1, ScopeFull: 2}
+
+// maxTokenExpiryDays caps how long a token can be made to last
+const maxTokenExpiryDays = 3650
+
+// APIToken lets a script call the API as a user, sending the token as
+// "Authorization: Bearer <token>". Only a hash of the token is stored.
+type APIToken struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID   primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Name     string             `json:"name" bson:"name"`
+	Scope    string             `json:"scope" bson:"scope"`
+	Prefix   string             `json:"prefix" bson:"prefix"`       // Start of the token, to tell tokens apart
+	Hash     string             `json:"hash,omitempty" bson:"hash"` // SHA-256 of the token; never sent to clients
+	Created  time.Time          `json:"created" bson:"created"`
+	Expires  *time.Time         `json:"expires,omitempty" bson:"expires"`     // Never, if nil
+	LastUsed *time.Time         `json:"last_used,omitempty" bson:"last_used"` // Never, if nil
+}
+
+// Expired reports whether the token can no longer be used at now
+func (t APIToken) Expired(now time.Time) bool {
+	return t.Expires != nil && now.After(*t.Expires)
+}
+
+// Allows reports whether the token's scope includes scope
+func (t APIToken) Allows(scope string) bool {
+	rank, ok := scopeRanks[t.Scope]
+	return ok && rank >= scopeRanks[scope]
+}
+
+// WithoutSecrets returns the token as it may be shown to clients
+func (t APIToken) WithoutSecrets() APIToken {
+	t.Hash = ""
+	return t
+}
+
+// CreateAPIToken represents the data needed to create an API token
+type CreateAPIToken struct {
+	Name          string `json:"name"`
+	Scope         string `json:"scope"`
+	ExpiresInDays int    `json:"expires_in_days"` // 0 for a token that never expires
+}
+
+// Validate checks the token's name, scope and lifetime
+func (c CreateAPIToken) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("Name is required")
+	}
+	if _, ok := scopeRanks[c.Scope]; !ok {
+		return errors.New("Scope must be read-only, stock-adjust or full")
+	}
+	if c.ExpiresInDays < 0 || c.ExpiresInDays > maxTokenExpiryDays {
+		return errors.New("Expiry must be between 0 (never) and 3650 days")
+	}
+	return nil
+}
+
+// NewAPITokenResult is returned when a token is created; the token itself
+// is shown this once and cannot be recovered later
+type NewAPITokenResult struct {
+	APIToken
+	Token string `json:"token"`
+}
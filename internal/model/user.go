@@ -0,0 +1,153 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Limits on user names and passwords
+const (
+	MinPasswordLength = 8
+	maxUsernameLength = 64
+)
+
+// Roles, each allowed everything the ones before it are
+const (
+	RoleViewer  = "viewer"  // Look up items and locations
+	RoleMember  = "member"  // Also add items, edit them except for their price, and move stock
+	RoleManager = "manager" // Also change prices, delete, manage locations, import and restore
+	RoleAdmin   = "admin"   // Also manage users and webhooks
+)
+
+// roleRanks orders the roles; users stored before roles existed have none
+// and rank as viewers
+var roleRanks = map[string]int{RoleViewer: 0, RoleMember: 1, RoleManager: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is one of the roles above
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HighestRole returns the role among roles that allows the most, or "" if
+// there are none
+func HighestRole(roles []string) string {
+	highest := ""
+	for _, role := range roles {
+		if ValidRole(role) && (highest == "" || roleRanks[role] > roleRanks[highest]) {
+			highest = role
+		}
+	}
+	return highest
+}
+
+// User is someone who can log in to the inventory
+type User struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Username     string             `json:"username" bson:"username"`                             // Lower case, unique
+	Role         string             `json:"role" bson:"role"`                                     // One of the Role constants
+	PasswordHash string             `json:"password_hash,omitempty" bson:"password_hash"`         // bcrypt hash; never sent to clients
+	OIDCSubject  string             `json:"oidc_subject,omitempty" bson:"oidc_subject,omitempty"` // Set for users who log in through single sign-on
+	Created      time.Time          `json:"created" bson:"created"`
+	PasswordSet  *time.Time         `json:"password_set,omitempty" bson:"password_set,omitempty"` // Last password change by the user; nil if never
+}
+
+// HasRole reports whether the user is allowed what role is
+func (u User) HasRole(role string) bool {
+	return roleRanks[u.Role] >= roleRanks[role]
+}
+
+// WithoutSecrets returns the user as it may be shown to clients
+func (u User) WithoutSecrets() User {
+	u.PasswordHash = ""
+	return u
+}
+
+// CreateUser represents the data needed to create a user. Users created
+// on their first single sign-on have an OIDC subject and no password.
+type CreateUser struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Role        string `json:"role"` // RoleViewer if empty
+	OIDCSubject string `json:"-"`
+}
+
+// Normalize trims the user name and makes it lower case, so that user
+// names are compared the same way everywhere, and fills in the default role
+func (c *CreateUser) Normalize() {
+	c.Username = NormalizeUsername(c.Username)
+	if c.Role == "" {
+		c.Role = RoleViewer
+	}
+}
+
+// Validate checks that the user name is usable and the password, unless the
+// user signs on through OIDC, long enough
+func (c CreateUser) Validate() error {
+	if c.Username == "" {
+		return errors.New("Username is required")
+	}
+	if len(c.Username) > maxUsernameLength {
+		return errors.New("Username is too long")
+	}
+	if strings.ContainsAny(c.Username, " \t\r\n/") {
+		return errors.New("Username must not contain spaces or slashes")
+	}
+	if c.OIDCSubject == "" && len(c.Password) < MinPasswordLength {
+		return errors.New("Password must be at least 8 characters")
+	}
+	if !ValidRole(c.Role) {
+		return errors.New("Role must be viewer, member, manager or admin")
+	}
+	return nil
+}
+
+// UpdateUser represents the changes an admin can make to a user
+type UpdateUser struct {
+	Role string `json:"role"`
+}
+
+// Validate checks that the role exists
+func (u UpdateUser) Validate() error {
+	if !ValidRole(u.Role) {
+		return errors.New("Role must be viewer, member, manager or admin")
+	}
+	return nil
+}
+
+// ChangePassword represents a user's request to change their own password
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// Validate checks that the new password is long enough
+func (c ChangePassword) Validate() error {
+	if len(c.NewPassword) < MinPasswordLength {
+		return errors.New("Password must be at least 8 characters")
+	}
+	return nil
+}
+
+// NormalizeUsername returns the form user names are stored and looked up in
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Login is the body posted to log in
+type Login struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Session is a logged-in browser. ID is a hash of the token in the session
+// cookie, so the stored sessions cannot be used to log in.
+type Session struct {
+	ID      string             `json:"id" bson:"_id"`
+	UserID  primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Created time.Time          `json:"created" bson:"created"`
+	Expires time.Time          `json:"expires" bson:"expires"`
+}
@@ -0,0 +1,69 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook is a URL that is sent a signed JSON payload for every inventory
+// event matching one of its event types
+type Webhook struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	URL     string             `json:"url" bson:"url"`
+	Events  []string           `json:"events" bson:"events"`                     // Event types, "location.*" style patterns allowed
+	Secret  string             `json:"secret,omitempty" bson:"secret,omitempty"` // HMAC key; only shown when the webhook is created
+	Created time.Time          `json:"created" bson:"created"`
+}
+
+// CreateWebhook represents the data needed to register a webhook
+type CreateWebhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"` // Generated if empty
+}
+
+// Validate checks that the webhook has a usable URL and event types
+func (c CreateWebhook) Validate() error {
+	if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+		return errors.New("URL must start with http:// or https://")
+	}
+	if len(c.Events) == 0 {
+		return errors.New("At least one event type is required")
+	}
+	for _, pattern := range c.Events {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid event type %q", pattern)
+		}
+	}
+	return nil
+}
+
+// WebhookPayload is the JSON body posted to a webhook.
+// Data is the item or location the event is about.
+type WebhookPayload struct {
+	ID   string      `json:"id"` // Same for every attempt to deliver the event
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	WebhookID  primitive.ObjectID `json:"webhook_id" bson:"webhook_id"`
+	EventID    string             `json:"event_id" bson:"event_id"`
+	EventType  string             `json:"event_type" bson:"event_type"`
+	Attempt    int                `json:"attempt" bson:"attempt"` // 1 for the first try
+	StatusCode int                `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string             `json:"error,omitempty" bson:"error,omitempty"`
+	Success    bool               `json:"success" bson:"success"`
+	Duration   int64              `json:"duration_ms" bson:"duration_ms"`
+	Payload    json.RawMessage    `json:"payload" bson:"payload"`
+	Created    time.Time          `json:"created" bson:"created"`
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+// Channel delivers messages to one destination
+type Channel interface {
+	Send(msg Message) error
+}
+
+// NewChannel creates the channel described by cfg
+func NewChannel(cfg model.ChannelConfig) (Channel, error) {
+	switch cfg.Type {
+	case "smtp":
+		return newSMTPChannel(cfg), nil
+	case "webhook":
+		return &WebhookChannel{URL: cfg.URL, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "log":
+		return LogChannel{}, nil
+	default:
+		return nil, fmt.Errorf("unknown channel type %q", cfg.Type)
+	}
+}
+
+// LogChannel writes messages to the server log
+type LogChannel struct{}
+
+// Send logs the message subject
+func (LogChannel) Send(msg Message) error {
+	log.Printf("Notification: %s", msg.Subject)
+	return nil
+}
+
+// WebhookChannel POSTs messages as JSON to a URL. The payload has a "text"
+// field, so chat services that accept incoming webhooks can show it as is.
+type WebhookChannel struct {
+	URL    string
+	Client *http.Client
+}
+
+// Send posts the message and fails unless the server answers 2xx
+func (c *WebhookChannel) Send(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Client.Post(c.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPChannel emails messages as plain text
+type SMTPChannel struct {
+	Addr string
+	Auth smtp.Auth // nil to send without authentication
+	From string
+	To   []string
+}
+
+// newSMTPChannel creates an SMTP channel, authenticating if a username is set
+func newSMTPChannel(cfg model.ChannelConfig) *SMTPChannel {
+	channel := &SMTPChannel{Addr: cfg.SMTPAddr, From: cfg.From, To: cfg.To}
+	if cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(cfg.SMTPAddr)
+		channel.Auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return channel
+}
+
+// Send emails the message to every recipient
+func (c *SMTPChannel) Send(msg Message) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", c.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	body.WriteString("\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	body.WriteString("\r\n")
+
+	return smtp.SendMail(c.Addr, c.Auth, c.From, c.To, body.Bytes())
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"lab-inv/internal/events"
+)
+
+// Message is an event described for people
+type Message struct {
+	Subject string       `json:"subject"`
+	Text    string       `json:"text"`
+	Event   events.Event `json:"event"`
+}
+
+// NewMessage describes an event
+func NewMessage(event events.Event) Message {
+	var subject string
+	var details []string
+
+	switch {
+	case event.Alert != nil:
+		alert := event.Alert
+		if alert.Low {
+			subject = fmt.Sprintf("Low stock: %s", alert.Name)
+		} else {
+			subject = fmt.Sprintf("Restocked: %s", alert.Name)
+		}
+		details = append(details, fmt.Sprintf("Quantity: %d (minimum %d)", alert.Number, alert.MinQuantity))
+		if alert.Low && alert.ReorderQuantity > 0 {
+			details = append(details, fmt.Sprintf("Reorder: %d", alert.ReorderQuantity))
+		}
+
+	case event.Item != nil:
+		item := event.Item
+		subject = fmt.Sprintf("%s: %s", describe(event.Type), item.Name)
+		details = append(details, fmt.Sprintf("Quantity: %d", item.Number))
+		details = append(details, fmt.Sprintf("Price: %.2f", item.Price))
+
+	case event.Location != nil:
+		subject = fmt.Sprintf("%s: %s", describe(event.Type), event.Location.Name)
+
+	case event.Import != nil:
+		subject = describe(event.Type)
+		details = append(details,
+			fmt.Sprintf("Items: %d created, %d updated, %d skipped",
+				event.Import.Items.Created, event.Import.Items.Updated, event.Import.Items.Skipped),
+			fmt.Sprintf("Locations: %d created, %d updated, %d skipped",
+				event.Import.Locations.Created, event.Import.Locations.Updated, event.Import.Locations.Skipped),
+		)
+
+	default:
+		subject = describe(event.Type)
+	}
+
+	text := subject
+	if len(details) > 0 {
+		text += "\n\n" + strings.Join(details, "\n")
+	}
+	text += "\n\nAt: " + event.Time.Format("2006-01-02 15:04:05")
+
+	return Message{Subject: subject, Text: text, Event: event}
+}
+
+// describe turns an event type such as "item.created" into "Item created"
+func describe(eventType string) string {
+	words := strings.Fields(strings.NewReplacer(".", " ", "_", " ").Replace(eventType))
+	if len(words) == 0 {
+		return "Inventory changed"
+	}
+	words[0] = strings.ToUpper(words[0][:1]) + words[0][1:]
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,155 @@
+// Package notify sends inventory events to people and systems outside
+// lab-inv: by email over SMTP, to an HTTP webhook, or to the server log.
+package notify
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+)
+
+const (
+	// queueSize is how many messages a channel may have waiting before new ones are dropped
+	queueSize = 100
+
+	// maxBackoff is the longest wait before a retry, however many sends have failed
+	maxBackoff = time.Hour
+)
+
+// subscription is a channel together with the events it receives
+type subscription struct {
+	name    string
+	channel Channel
+	events  []string
+	queue   chan Message
+}
+
+// Notifier sends each event published on a bus to the channels subscribed to it.
+// Every channel has its own queue, so a slow or failing one does not hold up the others.
+type Notifier struct {
+	bus           *events.Bus
+	subscriptions []*subscription
+	retries       int
+	backoff       time.Duration
+	stopping      chan struct{} // Closed on stop to cut retries short
+}
+
+// New creates a notifier for the channels in cfg
+func New(bus *events.Bus, cfg model.NotifyConfig) (*Notifier, error) {
+	backoff, err := time.ParseDuration(cfg.RetryBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry backoff: %w", err)
+	}
+
+	n := &Notifier{bus: bus, retries: cfg.Retries, backoff: backoff, stopping: make(chan struct{})}
+	for _, channelCfg := range cfg.Channels {
+		channel, err := NewChannel(channelCfg)
+		if err != nil {
+			return nil, fmt.Errorf("notify channel %q: %w", channelCfg.Name, err)
+		}
+		n.Add(channelCfg.Name, channel, channelCfg.Events)
+	}
+	return n, nil
+}
+
+// Add subscribes a channel to the given event types ("item.*" style patterns
+// allowed; none for all events). Channels must be added before Start.
+func (n *Notifier) Add(name string, channel Channel, eventTypes []string) {
+	n.subscriptions = append(n.subscriptions, &subscription{
+		name:    name,
+		channel: channel,
+		events:  eventTypes,
+		queue:   make(chan Message, queueSize),
+	})
+}
+
+// Start delivers events in the background until the returned function is called.
+// Stopping gives every message already queued one more attempt, without
+// retries, and waits for those to finish.
+func (n *Notifier) Start() (stop func()) {
+	if len(n.subscriptions) == 0 {
+		return func() {}
+	}
+
+	var wg sync.WaitGroup
+	for _, sub := range n.subscriptions {
+		wg.Add(1)
+		go func(sub *subscription) {
+			defer wg.Done()
+			for msg := range sub.queue {
+				n.deliver(sub, msg)
+			}
+		}(sub)
+	}
+
+	ch, cancel := n.bus.Subscribe("notifier", 256)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range ch {
+			n.dispatch(event)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		close(n.stopping)
+		for _, sub := range n.subscriptions {
+			close(sub.queue)
+		}
+		wg.Wait()
+	}
+}
+
+// dispatch queues an event for every channel subscribed to it
+func (n *Notifier) dispatch(event events.Event) {
+	var msg *Message
+	for _, sub := range n.subscriptions {
+		if !events.Match(sub.events, event.Type) {
+			continue
+		}
+		if msg == nil {
+			m := NewMessage(event)
+			msg = &m
+		}
+		select {
+		case sub.queue <- *msg:
+		default:
+			log.Printf("Notify channel %s is full, dropping %s", sub.name, event.Type)
+		}
+	}
+}
+
+// deliver sends a message, retrying with exponential backoff until the
+// notifier stops
+func (n *Notifier) deliver(sub *subscription, msg Message) {
+	wait := n.backoff
+	for attempt := 0; ; attempt++ {
+		err := sub.channel.Send(msg)
+		if err == nil {
+			return
+		}
+		if attempt >= n.retries {
+			log.Printf("Notify channel %s gave up on %q after %d attempts: %v", sub.name, msg.Subject, attempt+1, err)
+			return
+		}
+		log.Printf("Notify channel %s failed to send %q, retrying in %s: %v", sub.name, msg.Subject, wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-n.stopping:
+			timer.Stop()
+			log.Printf("Notify channel %s gave up on %q: shutting down", sub.name, msg.Subject)
+			return
+		}
+		wait *= 2
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+	}
+}
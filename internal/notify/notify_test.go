@@ -0,0 +1,388 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+)
+
+// mail is one message accepted by the fake SMTP server
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a fake mail server speaking just enough SMTP for net/smtp
+type smtpServer struct {
+	addr string
+
+	mu    sync.Mutex
+	mails []mail
+}
+
+// newSMTPServer starts a fake mail server on a free local port
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &smtpServer{addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve handles one SMTP session
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var current mail
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			current = mail{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			current.to = append(current.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			current.data = data.String()
+			s.mu.Lock()
+			s.mails = append(s.mails, current)
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// received returns the mails accepted so far
+func (s *smtpServer) received() []mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mail(nil), s.mails...)
+}
+
+// recorder is a channel remembering what it was sent, failing the first
+// failures sends
+type recorder struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	sent     []Message
+}
+
+func (c *recorder) Send(msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.attempts <= c.failures {
+		return errSendFailed
+	}
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+// counts returns how many sends were attempted and how many succeeded
+func (c *recorder) counts() (attempts, sent int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts, len(c.sent)
+}
+
+// types returns the event types of the messages sent
+func (c *recorder) types() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var types []string
+	for _, msg := range c.sent {
+		types = append(types, msg.Event.Type)
+	}
+	return types
+}
+
+var errSendFailed = errors.New("destination unreachable")
+
+var lowStock = events.Event{
+	Type:  events.LowStock,
+	Alert: &model.LowStockAlert{Name: "Pipette tips", Number: 2, MinQuantity: 10, ReorderQuantity: 50, Low: true},
+}
+
+// publish starts n, publishes the events, waits until done reports that
+// the deliveries the test expects have happened (nil to not wait) and
+// stops n again, which waits for the messages still queued
+func publish(t *testing.T, bus *events.Bus, n *Notifier, done func() bool, published ...events.Event) {
+	t.Helper()
+	stop := n.Start()
+	defer stop()
+	for _, event := range published {
+		bus.Publish(event)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for done != nil && !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries did not happen in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSMTPDelivery(t *testing.T) {
+	server := newSMTPServer(t)
+	bus := events.NewBus()
+	n, err := New(bus, model.NotifyConfig{RetryBackoff: "1ms", Channels: []model.ChannelConfig{{
+		Name:     "lab managers",
+		Type:     "smtp",
+		SMTPAddr: server.addr,
+		From:     "lab-inv@example.com",
+		To:       []string{"alice@example.com", "bob@example.com"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, bus, n, nil, lowStock)
+
+	mails := server.received()
+	if len(mails) != 1 {
+		t.Fatalf("got %d mails, want 1", len(mails))
+	}
+	got := mails[0]
+	if got.from != "lab-inv@example.com" || strings.Join(got.to, ",") != "alice@example.com,bob@example.com" {
+		t.Fatalf("mail from %q to %v", got.from, got.to)
+	}
+	for _, want := range []string{"Subject: Low stock: Pipette tips\r\n", "To: alice@example.com, bob@example.com\r\n", "Quantity: 2 (minimum 10)\r\n", "Reorder: 50\r\n"} {
+		if !strings.Contains(got.data, want) {
+			t.Errorf("mail does not contain %q:\n%s", want, got.data)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		payload  map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 3 {
+			http.Error(w, "try again later", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	bus := events.NewBus()
+	n, err := New(bus, model.NotifyConfig{Retries: 2, RetryBackoff: "1ms", Channels: []model.ChannelConfig{{
+		Name: "chat",
+		Type: "webhook",
+		URL:  server.URL,
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish(t, bus, n, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return payload != nil
+	}, lowStock)
+
+	if attempts != 3 {
+		t.Fatalf("got %d attempts, want 3", attempts)
+	}
+	if payload["subject"] != "Low stock: Pipette tips" || !strings.HasPrefix(payload["text"].(string), "Low stock: Pipette tips\n\n") {
+		t.Fatalf("payload = %v", payload)
+	}
+	if event, _ := payload["event"].(map[string]interface{}); event["type"] != events.LowStock {
+		t.Fatalf("payload event = %v", payload["event"])
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  int
+		failures int
+		attempts int
+		sent     int
+	}{
+		{"first try", 3, 0, 1, 1},
+		{"after retries", 3, 2, 3, 1},
+		{"on the last retry", 3, 3, 4, 1},
+		{"gives up", 3, 10, 4, 0},
+		{"no retries", 0, 1, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := events.NewBus()
+			n, err := New(bus, model.NotifyConfig{Retries: tt.retries, RetryBackoff: "1ms"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			channel := &recorder{failures: tt.failures}
+			n.Add("flaky", channel, nil)
+
+			publish(t, bus, n, func() bool {
+				attempts, _ := channel.counts()
+				return attempts >= tt.attempts
+			}, lowStock)
+
+			if channel.attempts != tt.attempts || len(channel.sent) != tt.sent {
+				t.Fatalf("got %d attempts and %d sent, want %d and %d", channel.attempts, len(channel.sent), tt.attempts, tt.sent)
+			}
+		})
+	}
+}
+
+func TestFailingChannelDoesNotHoldUpOthers(t *testing.T) {
+	bus := events.NewBus()
+	n, err := New(bus, model.NotifyConfig{Retries: 1, RetryBackoff: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := &recorder{failures: 100}
+	working := &recorder{}
+	n.Add("broken", broken, nil)
+	n.Add("working", working, nil)
+
+	publish(t, bus, n, func() bool {
+		attempts, _ := broken.counts()
+		_, sent := working.counts()
+		return attempts >= 4 && sent == 2
+	}, lowStock, events.Event{Type: events.ItemCreated, Item: &model.Item{Name: "Beaker"}})
+
+	if len(working.sent) != 2 || len(broken.sent) != 0 || broken.attempts != 4 {
+		t.Fatalf("working sent %d, broken sent %d in %d attempts", len(working.sent), len(broken.sent), broken.attempts)
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	bus := events.NewBus()
+	n, err := New(bus, model.NotifyConfig{RetryBackoff: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	everything := &recorder{}
+	alerts := &recorder{}
+	deletes := &recorder{}
+	n.Add("everything", everything, nil)
+	n.Add("alerts", alerts, []string{"alert.*"})
+	n.Add("deletes", deletes, []string{"item.deleted", "location.deleted"})
+
+	item := &model.Item{Name: "Beaker"}
+	location := &model.Location{Name: "Shelf A"}
+	publish(t, bus, n, nil,
+		events.Event{Type: events.ItemCreated, Item: item},
+		lowStock,
+		events.Event{Type: events.ItemDeleted, Item: item},
+		events.Event{Type: events.LocationDeleted, Location: location},
+		events.Event{Type: events.Restocked, Alert: &model.LowStockAlert{Name: "Pipette tips", Number: 60, MinQuantity: 10}},
+	)
+
+	tests := []struct {
+		name    string
+		channel *recorder
+		want    []string
+	}{
+		{"everything", everything, []string{events.ItemCreated, events.LowStock, events.ItemDeleted, events.LocationDeleted, events.Restocked}},
+		{"alerts", alerts, []string{events.LowStock, events.Restocked}},
+		{"deletes", deletes, []string{events.ItemDeleted, events.LocationDeleted}},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.channel.types(), ","); got != strings.Join(tt.want, ",") {
+			t.Errorf("%s received %s, want %s", tt.name, got, strings.Join(tt.want, ","))
+		}
+	}
+}
+
+func TestStopCutsRetriesShort(t *testing.T) {
+	bus := events.NewBus()
+	n, err := New(bus, model.NotifyConfig{Retries: 5, RetryBackoff: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := &recorder{failures: 100}
+	n.Add("broken", broken, nil)
+
+	start := time.Now()
+	publish(t, bus, n, func() bool {
+		attempts, _ := broken.counts()
+		return attempts == 1
+	}, lowStock)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("stopping waited %s for retries", elapsed)
+	}
+	if attempts, _ := broken.counts(); attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", attempts)
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	bus := events.NewBus()
+	if _, err := New(bus, model.NotifyConfig{RetryBackoff: "soon"}); err == nil {
+		t.Error("invalid backoff accepted")
+	}
+	if _, err := New(bus, model.NotifyConfig{RetryBackoff: "1s", Channels: []model.ChannelConfig{{Name: "pager", Type: "pager"}}}); err == nil {
+		t.Error("unknown channel type accepted")
+	}
+}
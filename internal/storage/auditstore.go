@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"log"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actor identifies who makes a change and the request it was made in
+type Actor struct {
+	User      string
+	RequestID string
+}
+
+// AuditStore wraps a Store and records every change made through it in the
+// audit log, on behalf of one actor. It is cheap to create, one per request.
+// A change that succeeds is never undone because its audit entry could not
+// be written; the failure is logged instead.
+type AuditStore struct {
+	Store
+	actor Actor
+}
+
+// NewAuditStore wraps store so that changes made through it are audited as actor's
+func NewAuditStore(store Store, actor Actor) *AuditStore {
+	return &AuditStore{Store: store, actor: actor}
+}
+
+// record writes an audit entry; before or after is nil for a create or delete.
+// Only updates list their changes, since everything changes in the others.
+func (a *AuditStore) record(entity, entityID, action string, before, after interface{}) {
+	entry := model.AuditEntry{
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Actor:     a.actor.User,
+		RequestID: a.actor.RequestID,
+		Time:      time.Now(),
+	}
+	if before != nil {
+		entry.Before = model.AuditDocument(before)
+	}
+	if after != nil {
+		entry.After = model.AuditDocument(after)
+	}
+	if before != nil && after != nil {
+		entry.Changes = model.AuditChanges(entry.Before, entry.After)
+	}
+
+	if err := a.Store.AddAuditEntry(entry); err != nil {
+		log.Printf("Failed to audit %s of %s %s by %s: %v", action, entity, entityID, a.actor.User, err)
+	}
+}
+
+// AddItem creates an item and audits it
+func (a *AuditStore) AddItem(createItem model.CreateItem) (model.Item, error) {
+	item, err := a.Store.AddItem(createItem)
+	if err != nil {
+		return model.Item{}, err
+	}
+	a.record(model.AuditItem, item.ID.Hex(), model.AuditCreate, nil, item)
+	return item, nil
+}
+
+// UpdateItem updates an item and audits the change
+func (a *AuditStore) UpdateItem(id string, updateItem model.CreateItem, version int64) (model.Item, error) {
+	before, err := a.Store.GetItemByID(id)
+	if err != nil {
+		return model.Item{}, err
+	}
+	item, err := a.Store.UpdateItem(id, updateItem, version)
+	if err != nil {
+		return model.Item{}, err
+	}
+	a.record(model.AuditItem, id, model.AuditUpdate, before, item)
+	return item, nil
+}
+
+// DeleteItem deletes an item and audits it
+func (a *AuditStore) DeleteItem(id string, version int64, deletedBy string) error {
+	before, err := a.Store.GetItemByID(id)
+	if err != nil {
+		return err
+	}
+	if err := a.Store.DeleteItem(id, version, deletedBy); err != nil {
+		return err
+	}
+	a.record(model.AuditItem, id, model.AuditDelete, before, nil)
+	return nil
+}
+
+// AddMovement records a stock movement and audits the item's change
+func (a *AuditStore) AddMovement(itemID string, movement model.CreateMovement) (model.MovementResult, error) {
+	before, err := a.Store.GetItemByID(itemID)
+	if err != nil {
+		return model.MovementResult{}, err
+	}
+	result, err := a.Store.AddMovement(itemID, movement)
+	if err != nil {
+		return model.MovementResult{}, err
+	}
+	a.record(model.AuditItem, itemID, model.AuditUpdate, before, result.Item)
+	return result, nil
+}
+
+// AdjustStock adjusts an item's stock and audits the item's change
+func (a *AuditStore) AdjustStock(itemID string, adjust model.AdjustStock) (model.AdjustResult, error) {
+	before, err := a.Store.GetItemByID(itemID)
+	if err != nil {
+		return model.AdjustResult{}, err
+	}
+	result, err := a.Store.AdjustStock(itemID, adjust)
+	if err != nil {
+		return model.AdjustResult{}, err
+	}
+	if after, err := a.Store.GetItemByID(itemID); err == nil {
+		a.record(model.AuditItem, itemID, model.AuditUpdate, before, after)
+	}
+	return result, nil
+}
+
+// AddLocation creates a location and audits it
+func (a *AuditStore) AddLocation(createLocation model.CreateLocation) (model.Location, error) {
+	location, err := a.Store.AddLocation(createLocation)
+	if err != nil {
+		return model.Location{}, err
+	}
+	a.record(model.AuditLocation, location.ID.Hex(), model.AuditCreate, nil, location)
+	return location, nil
+}
+
+// UpdateLocation updates a location and audits the change
+func (a *AuditStore) UpdateLocation(id string, updateLocation model.CreateLocation, version int64) (model.Location, error) {
+	before, err := a.Store.GetLocationByID(id)
+	if err != nil {
+		return model.Location{}, err
+	}
+	location, err := a.Store.UpdateLocation(id, updateLocation, version)
+	if err != nil {
+		return model.Location{}, err
+	}
+	a.record(model.AuditLocation, id, model.AuditUpdate, before, location)
+	return location, nil
+}
+
+// MoveLocation moves a location and audits the change
+func (a *AuditStore) MoveLocation(id string, move model.MoveLocation, version int64) (model.Location, error) {
+	before, err := a.Store.GetLocationByID(id)
+	if err != nil {
+		return model.Location{}, err
+	}
+	location, err := a.Store.MoveLocation(id, move, version)
+	if err != nil {
+		return model.Location{}, err
+	}
+	a.record(model.AuditLocation, id, model.AuditUpdate, before, location)
+	return location, nil
+}
+
+// DeleteLocation deletes a location and audits it, along with the
+// locations below it when cascading. Locations still holding items cannot
+// be deleted, so no items go with them.
+func (a *AuditStore) DeleteLocation(id string, cascade bool, version int64, deletedBy string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return a.Store.DeleteLocation(id, cascade, version, deletedBy)
+	}
+
+	// Remember what the delete removes
+	locations, err := a.Store.GetAllLocations()
+	if err != nil {
+		return err
+	}
+	ids := subtree(locations, objectID)
+
+	if err := a.Store.DeleteLocation(id, cascade, version, deletedBy); err != nil {
+		return err
+	}
+
+	for _, location := range locations {
+		if ids[location.ID] {
+			a.record(model.AuditLocation, location.ID.Hex(), model.AuditDelete, location, nil)
+		}
+	}
+	return nil
+}
+
+// ImportInventory imports an inventory and audits the import as a whole
+func (a *AuditStore) ImportInventory(inventory model.Inventory, mode string) (model.ImportSummary, error) {
+	summary, err := a.Store.ImportInventory(inventory, mode)
+	if err != nil {
+		return model.ImportSummary{}, err
+	}
+	a.record(model.AuditInventory, "", model.AuditImport, nil, summary)
+	return summary, nil
+}
+
+// RestoreFromTrash restores a deleted record and audits everything it brings back
+func (a *AuditStore) RestoreFromTrash(id string) (model.Trash, error) {
+	restored, err := a.Store.RestoreFromTrash(id)
+	if err != nil {
+		return model.Trash{}, err
+	}
+	for _, item := range restored.Items {
+		a.record(model.AuditItem, item.ID.Hex(), model.AuditRestore, nil, item)
+	}
+	for _, location := range restored.Locations {
+		a.record(model.AuditLocation, location.ID.Hex(), model.AuditRestore, nil, location)
+	}
+	return restored, nil
+}
+
+// PurgeTrash purges old deleted records and audits each of them
+func (a *AuditStore) PurgeTrash(deletedBefore time.Time) (model.Trash, error) {
+	purged, err := a.Store.PurgeTrash(deletedBefore)
+	if err != nil {
+		return model.Trash{}, err
+	}
+	a.recordPurge(purged)
+	return purged, nil
+}
+
+// DeleteFromTrash purges a deleted record and audits it
+func (a *AuditStore) DeleteFromTrash(id string) (model.Trash, error) {
+	purged, err := a.Store.DeleteFromTrash(id)
+	if err != nil {
+		return model.Trash{}, err
+	}
+	a.recordPurge(purged)
+	return purged, nil
+}
+
+// recordPurge audits the permanent deletion of purged records
+func (a *AuditStore) recordPurge(purged model.Trash) {
+	for _, item := range purged.Items {
+		a.record(model.AuditItem, item.ID.Hex(), model.AuditPurge, item, nil)
+	}
+	for _, location := range purged.Locations {
+		a.record(model.AuditLocation, location.ID.Hex(), model.AuditPurge, location, nil)
+	}
+}
+
+// AddUser creates a user and audits it, without the password hash
+func (a *AuditStore) AddUser(createUser model.CreateUser) (model.User, error) {
+	user, err := a.Store.AddUser(createUser)
+	if err != nil {
+		return model.User{}, err
+	}
+	a.record(model.AuditUser, user.ID.Hex(), model.AuditCreate, nil, user.WithoutSecrets())
+	return user, nil
+}
+
+// DeleteUser deletes a user and audits it
+func (a *AuditStore) DeleteUser(id string) error {
+	before, err := a.Store.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+	if err := a.Store.DeleteUser(id); err != nil {
+		return err
+	}
+	a.record(model.AuditUser, id, model.AuditDelete, before.WithoutSecrets(), nil)
+	return nil
+}
+
+// UpdateUser updates a user and audits the change
+func (a *AuditStore) UpdateUser(id string, updateUser model.UpdateUser) (model.User, error) {
+	before, err := a.Store.GetUserByID(id)
+	if err != nil {
+		return model.User{}, err
+	}
+	user, err := a.Store.UpdateUser(id, updateUser)
+	if err != nil {
+		return model.User{}, err
+	}
+	a.record(model.AuditUser, id, model.AuditUpdate, before.WithoutSecrets(), user.WithoutSecrets())
+	return user, nil
+}
+
+// SetUserPassword changes a user's password and audits the change, without
+// the password hash
+func (a *AuditStore) SetUserPassword(id string, password string) (model.User, error) {
+	before, err := a.Store.GetUserByID(id)
+	if err != nil {
+		return model.User{}, err
+	}
+	user, err := a.Store.SetUserPassword(id, password)
+	if err != nil {
+		return model.User{}, err
+	}
+	a.record(model.AuditUser, id, model.AuditUpdate, before.WithoutSecrets(), user.WithoutSecrets())
+	return user, nil
+}
+
+// AddAPIToken stores an API token and audits it, without its hash
+func (a *AuditStore) AddAPIToken(token model.APIToken) error {
+	if err := a.Store.AddAPIToken(token); err != nil {
+		return err
+	}
+	a.record(model.AuditToken, token.ID.Hex(), model.AuditCreate, nil, token.WithoutSecrets())
+	return nil
+}
+
+// DeleteAPIToken revokes an API token and audits it
+func (a *AuditStore) DeleteAPIToken(id string) (model.APIToken, error) {
+	token, err := a.Store.DeleteAPIToken(id)
+	if err != nil {
+		return model.APIToken{}, err
+	}
+	a.record(model.AuditToken, id, model.AuditDelete, token.WithoutSecrets(), nil)
+	return token, nil
+}
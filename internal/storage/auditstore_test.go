@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+func TestAuditStoreEntries(t *testing.T) {
+	base := NewMemoryStore(model.Inventory{})
+	audited := NewAuditStore(base, Actor{User: "alice", RequestID: "req-1"})
+
+	// IDs handed from one step to the next
+	var lab, shelf, empty model.Location
+	var item model.Item
+
+	steps := []struct {
+		name  string
+		do    func() error
+		fails bool
+		want  []string // Entries the step adds, as entity/action/changed fields, oldest first
+	}{
+		{"create location", func() (err error) {
+			lab, err = audited.AddLocation(model.CreateLocation{Name: "Lab"})
+			return err
+		}, false, []string{"location/create/"}},
+		{"create child", func() (err error) {
+			shelf, err = audited.AddLocation(model.CreateLocation{Name: "Shelf", ParentID: lab.ID.Hex()})
+			return err
+		}, false, []string{"location/create/"}},
+		{"rename location", func() (err error) {
+			shelf, err = audited.UpdateLocation(shelf.ID.Hex(), model.CreateLocation{Name: "Top shelf"}, AnyVersion)
+			return err
+		}, false, []string{"location/update/name"}},
+		{"create item", func() (err error) {
+			item, err = audited.AddItem(model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10})
+			return err
+		}, false, []string{"item/create/"}},
+		{"update item", func() (err error) {
+			item, err = audited.UpdateItem(item.ID.Hex(), model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Price: 4, Number: 10}, item.Version)
+			return err
+		}, false, []string{"item/update/name,price"}},
+		{"stale update", func() error {
+			_, err := audited.UpdateItem(item.ID.Hex(), model.CreateItem{Name: "Latex gloves", LocationID: shelf.ID.Hex()}, item.Version-1)
+			return err
+		}, true, nil},
+		{"adjust stock", func() error {
+			_, err := audited.AdjustStock(item.ID.Hex(), model.AdjustStock{Delta: -4})
+			return err
+		}, false, []string{"item/update/number,stock"}},
+		{"delete item", func() error {
+			return audited.DeleteItem(item.ID.Hex(), AnyVersion, "alice")
+		}, false, []string{"item/delete/"}},
+		{"restore item", func() error {
+			_, err := audited.RestoreFromTrash(item.ID.Hex())
+			return err
+		}, false, []string{"item/restore/"}},
+		{"delete location in use", func() error {
+			return audited.DeleteLocation(lab.ID.Hex(), true, AnyVersion, "alice")
+		}, true, nil},
+		{"cascade delete", func() error {
+			var err error
+			if empty, err = base.AddLocation(model.CreateLocation{Name: "Empty"}); err != nil {
+				return err
+			}
+			if _, err := base.AddLocation(model.CreateLocation{Name: "Drawer", ParentID: empty.ID.Hex()}); err != nil {
+				return err
+			}
+			return audited.DeleteLocation(empty.ID.Hex(), true, AnyVersion, "alice")
+		}, false, []string{"location/delete/", "location/delete/"}},
+		{"purge", func() error {
+			_, err := audited.PurgeTrash(time.Now().Add(time.Hour))
+			return err
+		}, false, []string{"location/purge/", "location/purge/"}},
+		{"create user", func() error {
+			_, err := audited.AddUser(model.CreateUser{Username: "bob", Password: "correct horse", Role: model.RoleMember})
+			return err
+		}, false, []string{"user/create/"}},
+		{"import", func() error {
+			_, err := audited.ImportInventory(model.Inventory{}, ImportMerge)
+			return err
+		}, false, []string{"inventory/import/"}},
+		{"reads", func() error {
+			_, err := audited.GetAllItems()
+			return err
+		}, false, nil},
+	}
+
+	seen := 0
+	for _, step := range steps {
+		err := step.do()
+		if (err != nil) != step.fails {
+			t.Fatalf("%s: got error %v", step.name, err)
+		}
+
+		entries, err := base.GetAuditEntries(model.AuditFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		added := entries[:len(entries)-seen]
+		seen = len(entries)
+
+		var got []string
+		for i := len(added) - 1; i >= 0; i-- {
+			entry := added[i]
+			var fields []string
+			for _, change := range entry.Changes {
+				fields = append(fields, change.Field)
+			}
+			got = append(got, entry.Entity+"/"+entry.Action+"/"+strings.Join(fields, ","))
+
+			if entry.Actor != "alice" || entry.RequestID != "req-1" || entry.Time.IsZero() {
+				t.Errorf("%s: entry %+v does not name the actor and request", step.name, entry)
+			}
+			switch entry.Action {
+			case model.AuditCreate, model.AuditRestore, model.AuditImport:
+				if entry.Before != nil || entry.After == nil {
+					t.Errorf("%s: %s entry has before %v and after %v", step.name, entry.Action, entry.Before, entry.After)
+				}
+			case model.AuditDelete, model.AuditPurge:
+				if entry.Before == nil || entry.After != nil {
+					t.Errorf("%s: %s entry has before %v and after %v", step.name, entry.Action, entry.Before, entry.After)
+				}
+			}
+			if _, ok := entry.After["password_hash"]; ok {
+				t.Errorf("%s: entry leaks the password hash", step.name)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(step.want, " ") {
+			t.Errorf("%s: added %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestAuditStoreFilter(t *testing.T) {
+	base := NewMemoryStore(model.Inventory{})
+	alice := NewAuditStore(base, Actor{User: "alice"})
+	bob := NewAuditStore(base, Actor{User: "bob"})
+
+	lab, err := alice.AddLocation(model.CreateLocation{Name: "Lab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Far enough apart for clocks with coarse resolution
+	time.Sleep(time.Millisecond)
+	start := time.Now()
+	time.Sleep(time.Millisecond)
+	item, err := bob.AddItem(model.CreateItem{Name: "Gloves", LocationID: lab.ID.Hex(), Number: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.UpdateItem(item.ID.Hex(), model.CreateItem{Name: "Nitrile gloves", LocationID: lab.ID.Hex(), Number: 1}, AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter model.AuditFilter
+		want   []string // Actor and action of the entries returned, newest first
+	}{
+		{"everything", model.AuditFilter{}, []string{"alice update", "bob create", "alice create"}},
+		{"by actor", model.AuditFilter{Actor: "alice"}, []string{"alice update", "alice create"}},
+		{"by entity", model.AuditFilter{Entity: model.AuditItem}, []string{"alice update", "bob create"}},
+		{"by record", model.AuditFilter{EntityID: lab.ID.Hex()}, []string{"alice create"}},
+		{"since", model.AuditFilter{Since: start}, []string{"alice update", "bob create"}},
+		{"until", model.AuditFilter{Until: start}, []string{"alice create"}},
+		{"limit", model.AuditFilter{Limit: 1}, []string{"alice update"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := base.GetAuditEntries(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.Actor+" "+entry.Action)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
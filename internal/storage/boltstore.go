@@ -0,0 +1,1507 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Name of the database file inside the data directory
+	boltFileName = "inventory.db"
+)
+
+var (
+	// Bucket names
+	itemsBucket      = []byte("items")
+	locationsBucket  = []byte("locations")
+	movementsBucket  = []byte("movements") // One nested bucket of movements per item
+	webhooksBucket   = []byte("webhooks")
+	deliveriesBucket = []byte("webhook_deliveries") // One nested bucket of delivery attempts per webhook
+	auditBucket      = []byte("audit")
+	trashItemsBucket = []byte("trash_items")
+	trashLocsBucket  = []byte("trash_locations")
+	usersBucket      = []byte("users")
+	sessionsBucket   = []byte("sessions") // Keyed by session ID
+	tokensBucket     = []byte("api_tokens")
+)
+
+// BoltStore keeps the inventory in an embedded bbolt database file.
+// It needs no server and no cgo, so it suits labs that work offline.
+// Records are stored as JSON keyed by their 12-byte ObjectID.
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+// NewBoltStore opens (or creates) the database file dataDir/inventory.db
+func NewBoltStore(dataDir string) (*BoltStore, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dataDir, boltFileName)
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	store := &BoltStore{db: db}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{itemsBucket, locationsBucket, movementsBucket, webhooksBucket, deliveriesBucket, auditBucket, trashItemsBucket, trashLocsBucket, usersBucket, sessionsBucket, tokensBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Initialize with sample data if the database is empty
+	if err := store.initSampleData(); err != nil {
+		log.Printf("Warning: Failed to initialize sample data: %v", err)
+	}
+
+	return store, nil
+}
+
+// Close closes the database file
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// initSampleData creates initial data if the locations bucket is empty
+func (b *BoltStore) initSampleData() error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(locationsBucket).Stats().KeyN > 0 {
+			return nil
+		}
+
+		sample := SampleInventory()
+		for _, location := range sample.Locations {
+			if err := putJSON(tx.Bucket(locationsBucket), location.ID, location); err != nil {
+				return err
+			}
+		}
+		for _, item := range sample.Items {
+			if err := putJSON(tx.Bucket(itemsBucket), item.ID, item); err != nil {
+				return err
+			}
+		}
+
+		log.Println("Created sample locations and items")
+		return nil
+	})
+}
+
+// putJSON stores v under id in bucket
+func putJSON(bucket *bbolt.Bucket, id primitive.ObjectID, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(id[:], data)
+}
+
+// getJSON loads the record stored under id into v, reporting whether it exists
+func getJSON(bucket *bbolt.Bucket, id primitive.ObjectID, v interface{}) (bool, error) {
+	data := bucket.Get(id[:])
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// decodeItem decodes a stored item, filling in per-location stock for
+// records written before it existed
+func decodeItem(data []byte) (model.Item, error) {
+	var item model.Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return model.Item{}, err
+	}
+	item.Normalize()
+	return item, nil
+}
+
+// boltItems decodes every item in the transaction, in key (creation) order
+func boltItems(tx *bbolt.Tx) ([]model.Item, error) {
+	items := []model.Item{}
+	err := tx.Bucket(itemsBucket).ForEach(func(_, data []byte) error {
+		item, err := decodeItem(data)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// boltLocations decodes every location in the transaction, in key (creation) order
+func boltLocations(tx *bbolt.Tx) ([]model.Location, error) {
+	locations := []model.Location{}
+	err := tx.Bucket(locationsBucket).ForEach(func(_, data []byte) error {
+		var location model.Location
+		if err := json.Unmarshal(data, &location); err != nil {
+			return err
+		}
+		locations = append(locations, location)
+		return nil
+	})
+	return locations, err
+}
+
+// boltLedger decodes the movements recorded for an item, oldest first
+func boltLedger(tx *bbolt.Tx, itemID primitive.ObjectID) ([]model.Movement, error) {
+	movements := []model.Movement{}
+	bucket := tx.Bucket(movementsBucket).Bucket(itemID[:])
+	if bucket == nil {
+		return movements, nil
+	}
+
+	err := bucket.ForEach(func(_, data []byte) error {
+		var movement model.Movement
+		if err := json.Unmarshal(data, &movement); err != nil {
+			return err
+		}
+		movements = append(movements, movement)
+		return nil
+	})
+	return movements, err
+}
+
+// appendLedger stores entries in the ledgers of their items
+func appendLedger(tx *bbolt.Tx, entries []model.Movement) error {
+	for _, entry := range entries {
+		bucket, err := tx.Bucket(movementsBucket).CreateBucketIfNotExists(entry.ItemID[:])
+		if err != nil {
+			return err
+		}
+		if err := putJSON(bucket, entry.ID, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllItems returns all items from the database
+func (b *BoltStore) GetAllItems() ([]model.Item, error) {
+	var items []model.Item
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		items, err = boltItems(tx)
+		return err
+	})
+	return items, err
+}
+
+// GetAllLocations returns all locations from the database
+func (b *BoltStore) GetAllLocations() ([]model.Location, error) {
+	var locations []model.Location
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		locations, err = boltLocations(tx)
+		return err
+	})
+	return locations, err
+}
+
+// GetItemByID returns a single item by its ID
+func (b *BoltStore) GetItemByID(id string) (model.Item, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Item{}, errors.New("invalid item ID format")
+	}
+
+	var item model.Item
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(itemsBucket).Get(objectID[:])
+		if data == nil {
+			return errors.New("item not found")
+		}
+		item, err = decodeItem(data)
+		return err
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	return item, nil
+}
+
+// GetLocationByID returns a single location by its ID
+func (b *BoltStore) GetLocationByID(id string) (model.Location, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Location{}, errors.New("invalid location ID format")
+	}
+
+	var location model.Location
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		found, err := getJSON(tx.Bucket(locationsBucket), objectID, &location)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("location not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	return location, nil
+}
+
+// checkBoltStockLocations fails unless every stock location exists
+func checkBoltStockLocations(tx *bbolt.Tx, stock []model.StockLevel) error {
+	locations := tx.Bucket(locationsBucket)
+	for _, level := range stock {
+		if locations.Get(level.LocationID[:]) == nil {
+			return errors.New("location does not exist")
+		}
+	}
+	return nil
+}
+
+// AddItem adds a new item to the database
+func (b *BoltStore) AddItem(createItem model.CreateItem) (model.Item, error) {
+	// Convert location ID strings to ObjectIDs
+	stock, err := parseStock(createItem)
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	// Create new item
+	item := newItem(primitive.NewObjectID(), createItem, stock)
+
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		// Validate that the locations exist
+		if err := checkBoltStockLocations(tx, stock); err != nil {
+			return err
+		}
+		if err := putJSON(tx.Bucket(itemsBucket), item.ID, item); err != nil {
+			return err
+		}
+		return appendLedger(tx, itemChangeEntries(nil, model.Item{}, item, reasonItemCreated))
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	return item, nil
+}
+
+// AddLocation adds a new location to the database
+func (b *BoltStore) AddLocation(createLocation model.CreateLocation) (model.Location, error) {
+	parentID, err := parseParentID(createLocation.ParentID)
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	// Create new location
+	location := model.Location{
+		ID:       primitive.NewObjectID(),
+		Name:     createLocation.Name,
+		ParentID: parentID,
+		Modified: time.Now(),
+		Version:  1,
+	}
+
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		// Validate that the parent exists
+		if parentID != nil && tx.Bucket(locationsBucket).Get(parentID[:]) == nil {
+			return errors.New("parent location does not exist")
+		}
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkSiblingName(locations, parentID, location.Name, location.ID); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(locationsBucket), location.ID, location)
+	})
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	return location, nil
+}
+
+// UpdateLocation renames an existing location in the database
+func (b *BoltStore) UpdateLocation(id string, updateLocation model.CreateLocation, version int64) (model.Location, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Location{}, errors.New("invalid location ID format")
+	}
+
+	var updatedLocation model.Location
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		found, err := getJSON(tx.Bucket(locationsBucket), objectID, &updatedLocation)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("location not found")
+		}
+		if err := checkVersion(updatedLocation.Version, version); err != nil {
+			return err
+		}
+
+		// Location names must stay unique among siblings
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkSiblingName(locations, updatedLocation.ParentID, updateLocation.Name, objectID); err != nil {
+			return err
+		}
+
+		updatedLocation.Name = updateLocation.Name
+		updatedLocation.Modified = time.Now()
+		updatedLocation.Version++
+		return putJSON(tx.Bucket(locationsBucket), objectID, updatedLocation)
+	})
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	return updatedLocation, nil
+}
+
+// MoveLocation moves a location, with everything below it, under a new parent
+func (b *BoltStore) MoveLocation(id string, move model.MoveLocation, version int64) (model.Location, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Location{}, errors.New("invalid location ID format")
+	}
+	parentID, err := parseParentID(move.ParentID)
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	var movedLocation model.Location
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		found, err := getJSON(tx.Bucket(locationsBucket), objectID, &movedLocation)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("location not found")
+		}
+		if err := checkVersion(movedLocation.Version, version); err != nil {
+			return err
+		}
+
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkMove(locations, objectID, parentID); err != nil {
+			return err
+		}
+		if err := checkSiblingName(locations, parentID, movedLocation.Name, objectID); err != nil {
+			return err
+		}
+
+		movedLocation.ParentID = parentID
+		movedLocation.Modified = time.Now()
+		movedLocation.Version++
+		return putJSON(tx.Bucket(locationsBucket), objectID, movedLocation)
+	})
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	return movedLocation, nil
+}
+
+// UpdateItem updates an existing item in the database
+func (b *BoltStore) UpdateItem(id string, updateItem model.CreateItem, version int64) (model.Item, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Item{}, errors.New("invalid item ID format")
+	}
+
+	// Convert location ID strings to ObjectIDs
+	stock, err := parseStock(updateItem)
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	// Create updated item
+	updatedItem := newItem(objectID, updateItem, stock)
+
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		// Validate that the locations exist
+		if err := checkBoltStockLocations(tx, stock); err != nil {
+			return err
+		}
+
+		items := tx.Bucket(itemsBucket)
+		data := items.Get(objectID[:])
+		if data == nil {
+			return errors.New("item not found")
+		}
+		currentItem, err := decodeItem(data)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(currentItem.Version, version); err != nil {
+			return err
+		}
+		updatedItem.Version = currentItem.Version + 1
+
+		ledger, err := boltLedger(tx, objectID)
+		if err != nil {
+			return err
+		}
+
+		if err := putJSON(items, objectID, updatedItem); err != nil {
+			return err
+		}
+		return appendLedger(tx, itemChangeEntries(ledger, currentItem, updatedItem, reasonItemUpdated))
+	})
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	return updatedItem, nil
+}
+
+// DeleteItem moves an item to the trash
+func (b *BoltStore) DeleteItem(id string, version int64, deletedBy string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid item ID format")
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+		data := items.Get(objectID[:])
+		if data == nil {
+			return errors.New("item not found")
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(item.Version, version); err != nil {
+			return err
+		}
+		if err := putJSON(tx.Bucket(trashItemsBucket), item.ID, trashItem(item, deletedBy, time.Now())); err != nil {
+			return err
+		}
+		return items.Delete(objectID[:])
+	})
+}
+
+// DeleteLocation moves a location to the trash.
+// With cascade, child locations are removed too; otherwise they block the delete.
+func (b *BoltStore) DeleteLocation(id string, cascade bool, version int64, deletedBy string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid location ID format")
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(locationsBucket)
+		var location model.Location
+		found, err := getJSON(bucket, objectID, &location)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("location not found")
+		}
+		if err := checkVersion(location.Version, version); err != nil {
+			return err
+		}
+
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+		ids, err := checkDelete(locations, objectID, cascade)
+		if err != nil {
+			return err
+		}
+
+		// Check if any items are using these locations
+		items, err := boltItems(tx)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if item.StoredIn(ids) {
+				return errors.New("cannot delete location: it is still being used by items")
+			}
+		}
+
+		deleted := []model.Location{}
+		for _, location := range locations {
+			if ids[location.ID] {
+				deleted = append(deleted, location)
+			}
+		}
+		for _, location := range trashLocations(deleted, objectID, deletedBy, time.Now()) {
+			if err := putJSON(tx.Bucket(trashLocsBucket), location.ID, location); err != nil {
+				return err
+			}
+			if err := bucket.Delete(location.ID[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetItemsInLocation returns the items stored in a location,
+// including those in its sub-locations when includeSublocations is set
+func (b *BoltStore) GetItemsInLocation(id string, includeSublocations bool) ([]model.Item, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid location ID format")
+	}
+
+	items := []model.Item{}
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(locationsBucket).Get(objectID[:]) == nil {
+			return errors.New("location not found")
+		}
+
+		ids := map[primitive.ObjectID]bool{objectID: true}
+		if includeSublocations {
+			locations, err := boltLocations(tx)
+			if err != nil {
+				return err
+			}
+			ids = subtree(locations, objectID)
+		}
+
+		all, err := boltItems(tx)
+		if err != nil {
+			return err
+		}
+		for _, item := range all {
+			if item.StoredIn(ids) {
+				items = append(items, item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddMovement records a stock movement for an item and applies it to the
+// item's stock in the same transaction
+func (b *BoltStore) AddMovement(itemID string, createMovement model.CreateMovement) (model.MovementResult, error) {
+	objectID, err := primitive.ObjectIDFromHex(itemID)
+	if err != nil {
+		return model.MovementResult{}, errors.New("invalid item ID format")
+	}
+
+	var result model.MovementResult
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		items := tx.Bucket(itemsBucket)
+		data := items.Get(objectID[:])
+		if data == nil {
+			return errors.New("item not found")
+		}
+		item, err := decodeItem(data)
+		if err != nil {
+			return err
+		}
+		ledger, err := boltLedger(tx, objectID)
+		if err != nil {
+			return err
+		}
+
+		updatedItem, entries, err := recordMovement(item, ledger, createMovement)
+		if err != nil {
+			return err
+		}
+		if err := checkBoltStockLocations(tx, updatedItem.Stock); err != nil {
+			return err
+		}
+
+		if err := putJSON(items, objectID, updatedItem); err != nil {
+			return err
+		}
+		if err := appendLedger(tx, entries); err != nil {
+			return err
+		}
+
+		result = model.MovementResult{Movement: entries[len(entries)-1], Item: updatedItem}
+		return nil
+	})
+	if err != nil {
+		return model.MovementResult{}, err
+	}
+
+	return result, nil
+}
+
+// AdjustStock changes an item's quantity at one location as a single ledger movement
+func (b *BoltStore) AdjustStock(itemID string, adjust model.AdjustStock) (model.AdjustResult, error) {
+	result, err := b.AddMovement(itemID, adjustMovement(adjust))
+	if err != nil {
+		return model.AdjustResult{}, err
+	}
+
+	return adjustResult(result), nil
+}
+
+// GetMovements returns the ledger of an item, oldest first
+func (b *BoltStore) GetMovements(itemID string) ([]model.Movement, error) {
+	objectID, err := primitive.ObjectIDFromHex(itemID)
+	if err != nil {
+		return nil, errors.New("invalid item ID format")
+	}
+
+	var movements []model.Movement
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(itemsBucket).Get(objectID[:]) == nil {
+			return errors.New("item not found")
+		}
+		movements, err = boltLedger(tx, objectID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+// SearchItems searches for items by name (case-insensitive)
+func (b *BoltStore) SearchItems(query string) ([]model.Item, error) {
+	items, err := b.GetAllItems()
+	if err != nil || query == "" {
+		return items, err
+	}
+
+	query = strings.ToLower(query)
+	matches := []model.Item{}
+	for _, item := range items {
+		if strings.Contains(strings.ToLower(item.Name), query) {
+			matches = append(matches, item)
+		}
+	}
+
+	return matches, nil
+}
+
+// GetItemsWithLocations returns every item once per location it is stocked
+// in, with the full path of that location and the quantity kept there
+func (b *BoltStore) GetItemsWithLocations() ([]model.ItemWithLocation, error) {
+	itemsWithLocations := []model.ItemWithLocation{}
+	err := b.EachItemWithLocation(func(item model.ItemWithLocation) error {
+		itemsWithLocations = append(itemsWithLocations, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return itemsWithLocations, nil
+}
+
+// EachItemWithLocation calls fn for every item and stock location, as
+// GetItemsWithLocations, decoding one item at a time inside a read transaction
+func (b *BoltStore) EachItemWithLocation(fn func(model.ItemWithLocation) error) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+		paths := model.LocationPaths(locations)
+
+		return tx.Bucket(itemsBucket).ForEach(func(_, data []byte) error {
+			item, err := decodeItem(data)
+			if err != nil {
+				return err
+			}
+
+			for _, row := range item.ToItemsWithLocations(paths) {
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// ImportInventory loads incoming into the database in the given mode (merge or replace).
+// The whole import runs in a single transaction.
+func (b *BoltStore) ImportInventory(incoming model.Inventory, mode string) (model.ImportSummary, error) {
+	var summary model.ImportSummary
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		items, err := boltItems(tx)
+		if err != nil {
+			return err
+		}
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+
+		plan, err := planImport(model.Inventory{Items: items, Locations: locations}, incoming, mode)
+		if err != nil {
+			return err
+		}
+
+		if plan.replace {
+			for _, name := range [][]byte{itemsBucket, locationsBucket} {
+				if err := tx.DeleteBucket(name); err != nil {
+					return err
+				}
+				if _, err := tx.CreateBucket(name); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, location := range plan.locations {
+			if err := putJSON(tx.Bucket(locationsBucket), location.ID, location); err != nil {
+				return err
+			}
+		}
+		for _, item := range plan.items {
+			if err := putJSON(tx.Bucket(itemsBucket), item.ID, item); err != nil {
+				return err
+			}
+		}
+
+		summary = plan.summary
+		return nil
+	})
+	if err != nil {
+		return model.ImportSummary{}, err
+	}
+
+	return summary, nil
+}
+
+// GetWebhooks returns every registered webhook
+func (b *BoltStore) GetWebhooks() ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(_, data []byte) error {
+			var webhook model.Webhook
+			if err := json.Unmarshal(data, &webhook); err != nil {
+				return err
+			}
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// AddWebhook registers a new webhook
+func (b *BoltStore) AddWebhook(createWebhook model.CreateWebhook) (model.Webhook, error) {
+	webhook, err := newWebhook(createWebhook)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(webhooksBucket), webhook.ID, webhook)
+	})
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (b *BoltStore) DeleteWebhook(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid webhook ID format")
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		webhooks := tx.Bucket(webhooksBucket)
+		if webhooks.Get(objectID[:]) == nil {
+			return errors.New("webhook not found")
+		}
+		if err := webhooks.Delete(objectID[:]); err != nil {
+			return err
+		}
+
+		deliveries := tx.Bucket(deliveriesBucket)
+		if deliveries.Bucket(objectID[:]) != nil {
+			return deliveries.DeleteBucket(objectID[:])
+		}
+		return nil
+	})
+}
+
+// AddWebhookDelivery records a delivery attempt, dropping the webhook's
+// oldest attempts beyond maxWebhookDeliveries
+func (b *BoltStore) AddWebhookDelivery(delivery model.WebhookDelivery) error {
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.Bucket(deliveriesBucket).CreateBucketIfNotExists(delivery.WebhookID[:])
+		if err != nil {
+			return err
+		}
+		if err := putJSON(bucket, delivery.ID, delivery); err != nil {
+			return err
+		}
+
+		// Keys are ObjectIDs, so the first ones are the oldest
+		var keys [][]byte
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			keys = append(keys, key)
+		}
+		if len(keys) <= maxWebhookDeliveries {
+			return nil
+		}
+		for _, key := range keys[:len(keys)-maxWebhookDeliveries] {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetWebhookDeliveries returns the recorded delivery attempts of a webhook, newest first
+func (b *BoltStore) GetWebhookDeliveries(webhookID string) ([]model.WebhookDelivery, error) {
+	objectID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, errors.New("invalid webhook ID format")
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(webhooksBucket).Get(objectID[:]) == nil {
+			return errors.New("webhook not found")
+		}
+		bucket := tx.Bucket(deliveriesBucket).Bucket(objectID[:])
+		if bucket == nil {
+			return nil
+		}
+
+		cursor := bucket.Cursor()
+		for key, data := cursor.Last(); key != nil; key, data = cursor.Prev() {
+			var delivery model.WebhookDelivery
+			if err := json.Unmarshal(data, &delivery); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// AddAuditEntry appends an entry to the audit log
+func (b *BoltStore) AddAuditEntry(entry model.AuditEntry) error {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(auditBucket), entry.ID, entry)
+	})
+}
+
+// GetAuditEntries returns the audit entries passing filter, newest first
+func (b *BoltStore) GetAuditEntries(filter model.AuditFilter) ([]model.AuditEntry, error) {
+	entries := []model.AuditEntry{}
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		// Keys are ObjectIDs, so walking backwards visits the newest first
+		cursor := tx.Bucket(auditBucket).Cursor()
+		for key, data := cursor.Last(); key != nil; key, data = cursor.Prev() {
+			if filter.Limit > 0 && len(entries) >= filter.Limit {
+				break
+			}
+			var entry model.AuditEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			if filter.Matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// boltTrash decodes everything in the trash
+func boltTrash(tx *bbolt.Tx) (model.Trash, error) {
+	trash := model.Trash{Items: []model.Item{}, Locations: []model.Location{}}
+	err := tx.Bucket(trashItemsBucket).ForEach(func(_, data []byte) error {
+		item, err := decodeItem(data)
+		if err != nil {
+			return err
+		}
+		trash.Items = append(trash.Items, item)
+		return nil
+	})
+	if err != nil {
+		return model.Trash{}, err
+	}
+
+	err = tx.Bucket(trashLocsBucket).ForEach(func(_, data []byte) error {
+		var location model.Location
+		if err := json.Unmarshal(data, &location); err != nil {
+			return err
+		}
+		trash.Locations = append(trash.Locations, location)
+		return nil
+	})
+	if err != nil {
+		return model.Trash{}, err
+	}
+
+	return trash, nil
+}
+
+// removeTrash deletes a selection of records from the trash
+func removeTrash(tx *bbolt.Tx, trash model.Trash) error {
+	for _, item := range trash.Items {
+		if err := tx.Bucket(trashItemsBucket).Delete(item.ID[:]); err != nil {
+			return err
+		}
+	}
+	for _, location := range trash.Locations {
+		if err := tx.Bucket(trashLocsBucket).Delete(location.ID[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTrash returns the deleted items and locations, newest first
+func (b *BoltStore) GetTrash() (model.Trash, error) {
+	var trash model.Trash
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		trash, err = boltTrash(tx)
+		return err
+	})
+	if err != nil {
+		return model.Trash{}, err
+	}
+
+	return sortTrash(trash), nil
+}
+
+// RestoreFromTrash brings a deleted item or location back
+func (b *BoltStore) RestoreFromTrash(id string) (model.Trash, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Trash{}, errors.New("invalid ID format")
+	}
+
+	var restored model.Trash
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		trash, err := boltTrash(tx)
+		if err != nil {
+			return err
+		}
+		locations, err := boltLocations(tx)
+		if err != nil {
+			return err
+		}
+		items := tx.Bucket(itemsBucket)
+		restored, err = planRestore(trash, objectID, locations, func(id primitive.ObjectID) bool {
+			return items.Get(id[:]) != nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range restored.Items {
+			if err := putJSON(items, item.ID, item); err != nil {
+				return err
+			}
+		}
+		for _, location := range restored.Locations {
+			if err := putJSON(tx.Bucket(locationsBucket), location.ID, location); err != nil {
+				return err
+			}
+		}
+		return removeTrash(tx, restored)
+	})
+	if err != nil {
+		return model.Trash{}, err
+	}
+
+	return restored, nil
+}
+
+// PurgeTrash permanently deletes everything deleted before the given time
+func (b *BoltStore) PurgeTrash(deletedBefore time.Time) (model.Trash, error) {
+	return b.purge(purgeOlderThan(deletedBefore))
+}
+
+// DeleteFromTrash permanently deletes one deleted item or location
+func (b *BoltStore) DeleteFromTrash(id string) (model.Trash, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Trash{}, errors.New("invalid ID format")
+	}
+
+	purged, err := b.purge(purgeID(objectID))
+	if err != nil {
+		return model.Trash{}, err
+	}
+	if len(purged.Items) == 0 && len(purged.Locations) == 0 {
+		return model.Trash{}, ErrNotInTrash
+	}
+	return purged, nil
+}
+
+// purge permanently deletes the trashed records that match, and the ledger of purged items
+func (b *BoltStore) purge(match func(primitive.ObjectID, time.Time) bool) (model.Trash, error) {
+	var purged model.Trash
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		trash, err := boltTrash(tx)
+		if err != nil {
+			return err
+		}
+		purged = planPurge(trash, match)
+
+		movements := tx.Bucket(movementsBucket)
+		for _, item := range purged.Items {
+			if movements.Bucket(item.ID[:]) != nil {
+				if err := movements.DeleteBucket(item.ID[:]); err != nil {
+					return err
+				}
+			}
+		}
+		return removeTrash(tx, purged)
+	})
+	if err != nil {
+		return model.Trash{}, err
+	}
+
+	return purged, nil
+}
+
+// boltUsers decodes every user in the transaction
+func boltUsers(tx *bbolt.Tx) ([]model.User, error) {
+	users := []model.User{}
+	err := tx.Bucket(usersBucket).ForEach(func(_, data []byte) error {
+		var user model.User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	})
+	return users, err
+}
+
+// GetUsers returns every user
+func (b *BoltStore) GetUsers() ([]model.User, error) {
+	var users []model.User
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		users, err = boltUsers(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// GetUserByID returns a specific user by ID
+func (b *BoltStore) GetUserByID(id string) (model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, errors.New("invalid user ID format")
+	}
+
+	var user model.User
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		found, err := getJSON(tx.Bucket(usersBucket), objectID, &user)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("user not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername returns the user with the given user name
+func (b *BoltStore) GetUserByUsername(username string) (model.User, error) {
+	username = model.NormalizeUsername(username)
+
+	users, err := b.GetUsers()
+	if err != nil {
+		return model.User{}, err
+	}
+	for _, user := range users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return model.User{}, errors.New("user not found")
+}
+
+// AddUser creates a user with a unique user name
+func (b *BoltStore) AddUser(createUser model.CreateUser) (model.User, error) {
+	createUser.Normalize()
+	user, err := newUser(createUser)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		users, err := boltUsers(tx)
+		if err != nil {
+			return err
+		}
+		for _, existing := range users {
+			if existing.Username == user.Username {
+				return errors.New("a user with this username already exists")
+			}
+		}
+		return putJSON(tx.Bucket(usersBucket), user.ID, user)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser removes a user, ends their sessions and revokes their API tokens
+func (b *BoltStore) DeleteUser(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid user ID format")
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(usersBucket)
+		if users.Get(objectID[:]) == nil {
+			return errors.New("user not found")
+		}
+		if err := users.Delete(objectID[:]); err != nil {
+			return err
+		}
+		err := deleteSessions(tx, func(session model.Session) bool {
+			return session.UserID == objectID
+		})
+		if err != nil {
+			return err
+		}
+
+		tokens, err := boltTokens(tx)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			if token.UserID == objectID {
+				if err := tx.Bucket(tokensBucket).Delete(token.ID[:]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// deleteSessions removes the sessions that match
+func deleteSessions(tx *bbolt.Tx, match func(model.Session) bool) error {
+	bucket := tx.Bucket(sessionsBucket)
+	var keys [][]byte
+	err := bucket.ForEach(func(key, data []byte) error {
+		var session model.Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return err
+		}
+		if match(session) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddSession stores a new login session
+func (b *BoltStore) AddSession(session model.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put([]byte(session.ID), data)
+	})
+}
+
+// GetSession returns the session with the given ID
+func (b *BoltStore) GetSession(id string) (model.Session, error) {
+	var session model.Session
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(sessionsBucket).Get([]byte(id))
+		if data == nil {
+			return errors.New("session not found")
+		}
+		return json.Unmarshal(data, &session)
+	})
+	if err != nil {
+		return model.Session{}, err
+	}
+
+	return session, nil
+}
+
+// DeleteSession ends a session
+func (b *BoltStore) DeleteSession(id string) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete([]byte(id))
+	})
+}
+
+// DeleteExpiredSessions removes the sessions that expired before now
+func (b *BoltStore) DeleteExpiredSessions(now time.Time) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return deleteSessions(tx, func(session model.Session) bool {
+			return session.Expires.Before(now)
+		})
+	})
+}
+
+// UpdateUser changes a user's role
+func (b *BoltStore) UpdateUser(id string, updateUser model.UpdateUser) (model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, errors.New("invalid user ID format")
+	}
+
+	var user model.User
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		found, err := getJSON(bucket, objectID, &user)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("user not found")
+		}
+		user.Role = updateUser.Role
+		return putJSON(bucket, user.ID, user)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// SetUserPassword replaces a user's password
+func (b *BoltStore) SetUserPassword(id string, password string) (model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, errors.New("invalid user ID format")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	var user model.User
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		found, err := getJSON(bucket, objectID, &user)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("user not found")
+		}
+		now := time.Now()
+		user.PasswordHash = hash
+		user.PasswordSet = &now
+		return putJSON(bucket, user.ID, user)
+	})
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// boltTokens decodes every API token in the transaction, in creation order
+func boltTokens(tx *bbolt.Tx) ([]model.APIToken, error) {
+	tokens := []model.APIToken{}
+	err := tx.Bucket(tokensBucket).ForEach(func(_, data []byte) error {
+		var token model.APIToken
+		if err := json.Unmarshal(data, &token); err != nil {
+			return err
+		}
+		tokens = append(tokens, token)
+		return nil
+	})
+	return tokens, err
+}
+
+// GetAPITokens returns a user's API tokens
+func (b *BoltStore) GetAPITokens(userID string) ([]model.APIToken, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID format")
+	}
+
+	tokens := []model.APIToken{}
+	err = b.db.View(func(tx *bbolt.Tx) error {
+		all, err := boltTokens(tx)
+		if err != nil {
+			return err
+		}
+		for _, token := range all {
+			if token.UserID == objectID {
+				tokens = append(tokens, token)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetAPITokenByHash returns the API token with the given hash
+func (b *BoltStore) GetAPITokenByHash(hash string) (model.APIToken, error) {
+	var found model.APIToken
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		tokens, err := boltTokens(tx)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			if token.Hash == hash {
+				found = token
+				return nil
+			}
+		}
+		return errors.New("API token not found")
+	})
+	if err != nil {
+		return model.APIToken{}, err
+	}
+
+	return found, nil
+}
+
+// AddAPIToken stores a new API token
+func (b *BoltStore) AddAPIToken(token model.APIToken) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return putJSON(tx.Bucket(tokensBucket), token.ID, token)
+	})
+}
+
+// TouchAPIToken records when an API token was last used
+func (b *BoltStore) TouchAPIToken(id string, lastUsed time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid API token ID format")
+	}
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(tokensBucket)
+		var token model.APIToken
+		found, err := getJSON(bucket, objectID, &token)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("API token not found")
+		}
+		token.LastUsed = &lastUsed
+		return putJSON(bucket, token.ID, token)
+	})
+}
+
+// DeleteAPIToken revokes an API token and returns it
+func (b *BoltStore) DeleteAPIToken(id string) (model.APIToken, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.APIToken{}, errors.New("invalid API token ID format")
+	}
+
+	var token model.APIToken
+	err = b.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(tokensBucket)
+		found, err := getJSON(bucket, objectID, &token)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return errors.New("API token not found")
+		}
+		return bucket.Delete(objectID[:])
+	})
+	if err != nil {
+		return model.APIToken{}, err
+	}
+
+	return token, nil
+}
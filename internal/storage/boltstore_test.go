@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"testing"
+
+	"lab-inv/internal/model"
+)
+
+// newTestBoltStore opens a BoltStore in a fresh data directory and clears
+// out the sample data it starts with
+func newTestBoltStore(t *testing.T, dataDir string) *BoltStore {
+	t.Helper()
+
+	store, err := NewBoltStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ImportInventory(model.Inventory{}, ImportReplace); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestBoltStoreCRUD(t *testing.T) {
+	store := newTestBoltStore(t, t.TempDir())
+	defer store.Close()
+	testStoreCRUD(t, store)
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	dataDir := t.TempDir()
+	store := newTestBoltStore(t, dataDir)
+	_, item := fill(t, store)
+	if _, err := store.AdjustStock(item.ID.Hex(), model.AdjustStock{Delta: -5, Reason: "used"}); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t, store)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A database with locations in it is not seeded again
+	reopened, err := NewBoltStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if after := snapshot(t, reopened); after != before {
+		t.Fatalf("reopened store differs:\nbefore %s\nafter  %s", before, after)
+	}
+}
+
+func TestBoltStoreSeedsSampleData(t *testing.T) {
+	store, err := NewBoltStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	sample := SampleInventory()
+	items, _ := store.GetAllItems()
+	locations, _ := store.GetAllLocations()
+	if len(items) != len(sample.Items) || len(locations) != len(sample.Locations) {
+		t.Fatalf("got %d items and %d locations, want the sample's %d and %d", len(items), len(locations), len(sample.Items), len(sample.Locations))
+	}
+}
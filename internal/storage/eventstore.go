@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventStore wraps a Store and publishes an event on its bus after every
+// successful change, so the backends themselves need not know about events
+type EventStore struct {
+	Store
+	bus *events.Bus
+}
+
+// NewEventStore wraps store so that its changes are published on bus
+func NewEventStore(store Store, bus *events.Bus) *EventStore {
+	return &EventStore{Store: store, bus: bus}
+}
+
+// publishItem publishes an item event carrying a copy of item
+func (e *EventStore) publishItem(eventType string, item model.Item) {
+	e.bus.Publish(events.Event{Type: eventType, Item: &item})
+}
+
+// publishLocation publishes a location event carrying a copy of location
+func (e *EventStore) publishLocation(eventType string, location model.Location) {
+	e.bus.Publish(events.Event{Type: eventType, Location: &location})
+}
+
+// AddItem creates an item and publishes item.created
+func (e *EventStore) AddItem(createItem model.CreateItem) (model.Item, error) {
+	item, err := e.Store.AddItem(createItem)
+	if err != nil {
+		return model.Item{}, err
+	}
+	e.publishItem(events.ItemCreated, item)
+	return item, nil
+}
+
+// UpdateItem updates an item and publishes item.updated
+func (e *EventStore) UpdateItem(id string, updateItem model.CreateItem, version int64) (model.Item, error) {
+	item, err := e.Store.UpdateItem(id, updateItem, version)
+	if err != nil {
+		return model.Item{}, err
+	}
+	e.publishItem(events.ItemUpdated, item)
+	return item, nil
+}
+
+// DeleteItem deletes an item and publishes item.deleted with the item as it was
+func (e *EventStore) DeleteItem(id string, version int64, deletedBy string) error {
+	item, err := e.Store.GetItemByID(id)
+	if err != nil {
+		return err
+	}
+	if err := e.Store.DeleteItem(id, version, deletedBy); err != nil {
+		return err
+	}
+	e.publishItem(events.ItemDeleted, item)
+	return nil
+}
+
+// AddMovement records a stock movement and publishes item.updated
+func (e *EventStore) AddMovement(itemID string, movement model.CreateMovement) (model.MovementResult, error) {
+	result, err := e.Store.AddMovement(itemID, movement)
+	if err != nil {
+		return model.MovementResult{}, err
+	}
+	e.publishItem(events.ItemUpdated, result.Item)
+	return result, nil
+}
+
+// AdjustStock adjusts an item's stock and publishes item.updated
+func (e *EventStore) AdjustStock(itemID string, adjust model.AdjustStock) (model.AdjustResult, error) {
+	result, err := e.Store.AdjustStock(itemID, adjust)
+	if err != nil {
+		return model.AdjustResult{}, err
+	}
+	if item, err := e.Store.GetItemByID(itemID); err == nil {
+		e.publishItem(events.ItemUpdated, item)
+	}
+	return result, nil
+}
+
+// AddLocation creates a location and publishes location.created
+func (e *EventStore) AddLocation(createLocation model.CreateLocation) (model.Location, error) {
+	location, err := e.Store.AddLocation(createLocation)
+	if err != nil {
+		return model.Location{}, err
+	}
+	e.publishLocation(events.LocationCreated, location)
+	return location, nil
+}
+
+// UpdateLocation updates a location and publishes location.updated
+func (e *EventStore) UpdateLocation(id string, updateLocation model.CreateLocation, version int64) (model.Location, error) {
+	location, err := e.Store.UpdateLocation(id, updateLocation, version)
+	if err != nil {
+		return model.Location{}, err
+	}
+	e.publishLocation(events.LocationUpdated, location)
+	return location, nil
+}
+
+// MoveLocation moves a location and publishes location.updated
+func (e *EventStore) MoveLocation(id string, move model.MoveLocation, version int64) (model.Location, error) {
+	location, err := e.Store.MoveLocation(id, move, version)
+	if err != nil {
+		return model.Location{}, err
+	}
+	e.publishLocation(events.LocationUpdated, location)
+	return location, nil
+}
+
+// DeleteLocation deletes a location and publishes location.deleted for it
+// and, when cascading, for every location below it. Locations still holding
+// items cannot be deleted, so no items go with them.
+func (e *EventStore) DeleteLocation(id string, cascade bool, version int64, deletedBy string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return e.Store.DeleteLocation(id, cascade, version, deletedBy)
+	}
+
+	// Remember what the delete removes
+	locations, err := e.Store.GetAllLocations()
+	if err != nil {
+		return err
+	}
+	ids := subtree(locations, objectID)
+
+	if err := e.Store.DeleteLocation(id, cascade, version, deletedBy); err != nil {
+		return err
+	}
+
+	for _, location := range locations {
+		if ids[location.ID] {
+			e.publishLocation(events.LocationDeleted, location)
+		}
+	}
+	return nil
+}
+
+// ImportInventory imports an inventory and publishes inventory.imported
+func (e *EventStore) ImportInventory(inventory model.Inventory, mode string) (model.ImportSummary, error) {
+	summary, err := e.Store.ImportInventory(inventory, mode)
+	if err != nil {
+		return model.ImportSummary{}, err
+	}
+	e.bus.Publish(events.Event{Type: events.InventoryImported, Import: &summary})
+	return summary, nil
+}
+
+// RestoreFromTrash restores a deleted record and publishes item.restored or
+// location.restored for everything it brings back
+func (e *EventStore) RestoreFromTrash(id string) (model.Trash, error) {
+	restored, err := e.Store.RestoreFromTrash(id)
+	if err != nil {
+		return model.Trash{}, err
+	}
+	for _, item := range restored.Items {
+		e.publishItem(events.ItemRestored, item)
+	}
+	for _, location := range restored.Locations {
+		e.publishLocation(events.LocationRestored, location)
+	}
+	return restored, nil
+}
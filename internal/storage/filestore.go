@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"lab-inv/internal/model"
+)
+
+const (
+	// Name of the inventory file inside the data directory
+	inventoryFileName = "inventory.json"
+)
+
+// FileStore keeps the whole inventory in a single JSON file.
+// All data is held in memory and every mutation rewrites the file
+// atomically, so it is meant for small labs without a MongoDB server.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore creates a file-backed store using dataDir/inventory.json
+func NewFileStore(dataDir string) (*FileStore, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	store := &FileStore{
+		path: InventoryPath(dataDir),
+	}
+
+	doc, err := store.load()
+	if err != nil {
+		return nil, err
+	}
+
+	store.MemoryStore = newMemoryStore(doc)
+	store.MemoryStore.persist = store.write
+
+	return store, nil
+}
+
+// InventoryPath returns the path of the file a FileStore in dataDir keeps its data in
+func InventoryPath(dataDir string) string {
+	return filepath.Join(dataDir, inventoryFileName)
+}
+
+// InitFileStore creates an empty inventory file in dataDir, for callers that
+// fill the store themselves instead of starting from the sample data
+func InitFileStore(dataDir string) error {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return err
+	}
+	store := &FileStore{path: InventoryPath(dataDir)}
+	return store.write(document{Items: []model.Item{}, Locations: []model.Location{}})
+}
+
+// load reads the inventory file, seeding sample data if it does not exist yet
+func (f *FileStore) load() (document, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		sample := SampleInventory()
+		doc := document{Items: sample.Items, Locations: sample.Locations}
+		log.Printf("Creating %s with sample data", f.path)
+		return doc, f.write(doc)
+	}
+	if err != nil {
+		return document{}, err
+	}
+
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if isLegacyInventory(data) {
+			return document{}, fmt.Errorf("%s uses the legacy integer ID format; convert it with lab-inv migrate", f.path)
+		}
+		return document{}, fmt.Errorf("failed to parse %s: %w", f.path, err)
+	}
+
+	return doc, nil
+}
+
+// write stores the inventory on disk.
+// The file is written to a temporary file first and renamed into place so a
+// crash never leaves a half-written inventory behind.
+func (f *FileStore) write(doc document) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".inventory-*.json")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	if err := os.Rename(tmpName, f.path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	return nil
+}
+
+// isLegacyInventory reports whether data looks like the old integer-ID file format
+func isLegacyInventory(data []byte) bool {
+	var probe struct {
+		Items []struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"items"`
+		Locations []struct {
+			ID json.RawMessage `json:"id"`
+		} `json:"locations"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+
+	isNumber := func(raw json.RawMessage) bool {
+		return len(raw) > 0 && raw[0] >= '0' && raw[0] <= '9'
+	}
+	for _, item := range probe.Items {
+		if isNumber(item.ID) {
+			return true
+		}
+	}
+	for _, location := range probe.Locations {
+		if isNumber(location.ID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lab-inv/internal/model"
+)
+
+// newTestFileStore opens a FileStore in an empty data directory
+func newTestFileStore(t *testing.T) (*FileStore, string) {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	if err := InitFileStore(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dataDir
+}
+
+func TestFileStoreCRUD(t *testing.T) {
+	store, _ := newTestFileStore(t)
+	testStoreCRUD(t, store)
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	store, dataDir := newTestFileStore(t)
+	_, item := fill(t, store)
+	if _, err := store.AdjustStock(item.ID.Hex(), model.AdjustStock{Delta: -5, Reason: "used"}); err != nil {
+		t.Fatal(err)
+	}
+	before := snapshot(t, store)
+
+	reopened, err := NewFileStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := snapshot(t, reopened); after != before {
+		t.Fatalf("reopened store differs:\nbefore %s\nafter  %s", before, after)
+	}
+
+	info, err := os.Stat(InventoryPath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("inventory file mode %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestFileStoreSeedsSampleData(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewFileStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sample := SampleInventory()
+	items, _ := store.GetAllItems()
+	locations, _ := store.GetAllLocations()
+	if len(items) != len(sample.Items) || len(locations) != len(sample.Locations) {
+		t.Fatalf("got %d items and %d locations, want the sample's %d and %d", len(items), len(locations), len(sample.Items), len(sample.Locations))
+	}
+	if _, err := os.Stat(InventoryPath(dataDir)); err != nil {
+		t.Fatalf("sample data not written: %v", err)
+	}
+}
+
+func TestFileStoreWriteIsAtomic(t *testing.T) {
+	store, dataDir := newTestFileStore(t)
+	fill(t, store)
+	before := snapshot(t, store)
+
+	// Nothing can be renamed over a directory, so the next write fails
+	// after the temporary file has been written
+	path := InventoryPath(dataDir)
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.AddLocation(model.CreateLocation{Name: "Freezer"}); err == nil {
+		t.Fatal("write into a directory succeeded")
+	}
+	if after := snapshot(t, store); after != before {
+		t.Fatal("failed write changed the store")
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dataDir, ".inventory-*.json"))
+	if len(leftovers) > 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+
+	// Once the file can be written again, the store carries on where it was
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, saved, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddLocation(model.CreateLocation{Name: "Freezer"}); err != nil {
+		t.Fatalf("write after recovery: %v", err)
+	}
+}
+
+func TestFileStoreRejectsBadFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"legacy integer IDs", `{"items":[{"id":1,"name":"Beaker"}],"locations":[{"id":2,"name":"Lab"}]}`, "lab-inv migrate"},
+		{"not JSON", `items: []`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			if err := os.WriteFile(InventoryPath(dataDir), []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewFileStore(dataDir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// ImportMerge adds new records and updates existing ones that are newer in the import
+	ImportMerge = "merge"
+	// ImportReplace discards the current inventory and loads the import as-is
+	ImportReplace = "replace"
+)
+
+// importPlan lists the records a backend has to write to apply an import
+type importPlan struct {
+	replace   bool
+	locations []model.Location
+	items     []model.Item
+	summary   model.ImportSummary
+}
+
+// planImport validates incoming against current and works out which records
+// to write. In merge mode a record whose ID already exists is only updated
+// when its Modified time is newer than the stored one; otherwise it is skipped.
+// Records without an ID get a fresh one. Every item, and every location with a
+// parent, must reference a location that exists after the import, and the
+// locations must form a tree without two siblings of the same name, or the
+// whole import is rejected.
+func planImport(current, incoming model.Inventory, mode string) (importPlan, error) {
+	if mode == "" {
+		mode = ImportMerge
+	}
+	if mode != ImportMerge && mode != ImportReplace {
+		return importPlan{}, fmt.Errorf("unknown import mode %q", mode)
+	}
+
+	plan := importPlan{
+		replace: mode == ImportReplace,
+		summary: model.ImportSummary{Mode: mode},
+	}
+
+	if err := validateImport(incoming); err != nil {
+		return importPlan{}, err
+	}
+
+	// Versions carry on from the stored records even in replace mode, so a
+	// version read before the replace never matches the replacing record
+	storedLocations := make(map[primitive.ObjectID]model.Location, len(current.Locations))
+	for _, location := range current.Locations {
+		storedLocations[location.ID] = location
+	}
+	storedItems := make(map[primitive.ObjectID]model.Item, len(current.Items))
+	for _, item := range current.Items {
+		storedItems[item.ID] = item
+	}
+
+	// In replace mode nothing that exists today survives
+	survivors := current
+	if plan.replace {
+		survivors = model.Inventory{}
+	}
+
+	knownLocations := make(map[primitive.ObjectID]bool, len(survivors.Locations)+len(incoming.Locations))
+	for _, location := range survivors.Locations {
+		knownLocations[location.ID] = true
+	}
+
+	for _, location := range incoming.Locations {
+		if location.ID.IsZero() {
+			location.ID = primitive.NewObjectID()
+		}
+		if location.Modified.IsZero() {
+			location.Modified = time.Now()
+		}
+		knownLocations[location.ID] = true
+
+		stored, exists := storedLocations[location.ID]
+		switch {
+		case !exists || plan.replace:
+			plan.summary.Locations.Created++
+		case location.Modified.After(stored.Modified):
+			plan.summary.Locations.Updated++
+		default:
+			plan.summary.Locations.Skipped++
+			continue
+		}
+		location.Version = stored.Version + 1
+		plan.locations = append(plan.locations, location)
+	}
+
+	var problems []string
+	for _, location := range incoming.Locations {
+		if location.ParentID != nil && !knownLocations[*location.ParentID] {
+			problems = append(problems, fmt.Sprintf("location %q references unknown parent %s", location.Name, location.ParentID.Hex()))
+		}
+	}
+
+	// The tree after the import must still be a tree with unique names per parent
+	locations := make([]model.Location, 0, len(storedLocations)+len(plan.locations))
+	written := make(map[primitive.ObjectID]bool, len(plan.locations))
+	for _, location := range plan.locations {
+		written[location.ID] = true
+	}
+	for _, location := range survivors.Locations {
+		if !written[location.ID] {
+			locations = append(locations, location)
+		}
+	}
+	locations = append(locations, plan.locations...)
+	for _, location := range plan.locations {
+		if location.ParentID != nil && knownLocations[*location.ParentID] {
+			if err := checkMove(locations, location.ID, location.ParentID); err != nil {
+				problems = append(problems, fmt.Sprintf("location %q: %v", location.Name, err))
+				continue
+			}
+		}
+		if err := checkSiblingName(locations, location.ParentID, location.Name, location.ID); err != nil {
+			problems = append(problems, fmt.Sprintf("location %q: %v", location.Name, err))
+		}
+	}
+
+	for _, item := range incoming.Items {
+		item.Normalize()
+		if len(item.Stock) == 0 {
+			problems = append(problems, fmt.Sprintf("item %q has no location", item.Name))
+			continue
+		}
+		known := true
+		for _, level := range item.Stock {
+			if !knownLocations[level.LocationID] {
+				problems = append(problems, fmt.Sprintf("item %q references unknown location %s", item.Name, level.LocationID.Hex()))
+				known = false
+			}
+		}
+		if !known {
+			continue
+		}
+		if item.ID.IsZero() {
+			item.ID = primitive.NewObjectID()
+		}
+		if item.Modified.IsZero() {
+			item.Modified = time.Now()
+		}
+
+		stored, exists := storedItems[item.ID]
+		switch {
+		case !exists || plan.replace:
+			plan.summary.Items.Created++
+		case item.Modified.After(stored.Modified):
+			plan.summary.Items.Updated++
+		default:
+			plan.summary.Items.Skipped++
+			continue
+		}
+		item.Version = stored.Version + 1
+		plan.items = append(plan.items, item)
+	}
+	if len(problems) > 0 {
+		return importPlan{}, errors.New("invalid import: " + strings.Join(problems, "; "))
+	}
+
+	return plan, nil
+}
+
+// validateImport checks the records of an import on their own
+func validateImport(incoming model.Inventory) error {
+	var problems []string
+
+	locationIDs := make(map[primitive.ObjectID]bool, len(incoming.Locations))
+	for i, location := range incoming.Locations {
+		if location.Name == "" {
+			problems = append(problems, fmt.Sprintf("location #%d has no name", i+1))
+		}
+		if !location.ID.IsZero() {
+			if locationIDs[location.ID] {
+				problems = append(problems, fmt.Sprintf("location %s appears more than once", location.ID.Hex()))
+			}
+			locationIDs[location.ID] = true
+		}
+	}
+
+	itemIDs := make(map[primitive.ObjectID]bool, len(incoming.Items))
+	for i, item := range incoming.Items {
+		if item.Name == "" {
+			problems = append(problems, fmt.Sprintf("item #%d has no name", i+1))
+		}
+		if item.Price < 0 {
+			problems = append(problems, fmt.Sprintf("item %q has a negative price", item.Name))
+		}
+		if item.Number < 0 {
+			problems = append(problems, fmt.Sprintf("item %q has a negative number", item.Name))
+		}
+		for _, level := range item.Stock {
+			if level.Number < 0 {
+				problems = append(problems, fmt.Sprintf("item %q has a negative number at location %s", item.Name, level.LocationID.Hex()))
+			}
+		}
+		if !item.ID.IsZero() {
+			if itemIDs[item.ID] {
+				problems = append(problems, fmt.Sprintf("item %s appears more than once", item.ID.Hex()))
+			}
+			itemIDs[item.ID] = true
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid import: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
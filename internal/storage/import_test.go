@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlanImportTree(t *testing.T) {
+	lab, shelf, box := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	earlier := time.Now().Add(-time.Hour)
+	current := model.Inventory{Locations: []model.Location{
+		{ID: lab, Name: "Lab", Modified: earlier},
+		{ID: shelf, Name: "Shelf A", ParentID: &lab, Modified: earlier},
+	}}
+	location := func(id primitive.ObjectID, name string, parent *primitive.ObjectID) model.Location {
+		return model.Location{ID: id, Name: name, ParentID: parent, Modified: time.Now()}
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		incoming []model.Location
+		want     string // Part of the error; empty when the import is valid
+	}{
+		{"new child", ImportMerge, []model.Location{location(box, "Box 1", &shelf)}, ""},
+		{"moves existing location", ImportMerge, []model.Location{location(shelf, "Shelf A", nil)}, ""},
+		{"parent is itself", ImportMerge, []model.Location{location(box, "Box 1", &box)}, "own subtree"},
+		{"cycle through existing", ImportMerge, []model.Location{location(lab, "Lab", &shelf)}, "own subtree"},
+		{"cycle within import", ImportReplace, []model.Location{
+			location(lab, "Lab", &shelf),
+			location(shelf, "Shelf A", &lab),
+		}, "own subtree"},
+		{"duplicate of existing sibling", ImportMerge, []model.Location{location(box, "shelf a", &lab)}, "already exists"},
+		{"duplicate within import", ImportMerge, []model.Location{
+			location(box, "Box 1", &shelf),
+			location(primitive.NilObjectID, "BOX 1", &shelf),
+		}, "already exists"},
+		{"duplicate at top level", ImportMerge, []model.Location{location(box, "Lab", nil)}, "already exists"},
+		{"replace drops existing names", ImportReplace, []model.Location{location(box, "Lab", nil)}, ""},
+		{"renamed existing frees its name", ImportMerge, []model.Location{
+			location(shelf, "Shelf B", &lab),
+			location(box, "Shelf A", &lab),
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := planImport(current, model.Inventory{Locations: tt.incoming}, tt.mode)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatalf("import refused: %v", err)
+			case tt.want != "" && err == nil:
+				t.Fatal("import accepted")
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Fatalf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanImportVersions(t *testing.T) {
+	lab := primitive.NewObjectID()
+	beaker := primitive.NewObjectID()
+	earlier := time.Now().Add(-time.Hour)
+	current := model.Inventory{
+		Locations: []model.Location{{ID: lab, Name: "Lab", Modified: earlier, Version: 4}},
+		Items:     []model.Item{{ID: beaker, Name: "Beaker", LocationID: lab, Number: 1, Modified: earlier, Version: 7}},
+	}
+	incoming := model.Inventory{
+		Locations: []model.Location{{ID: lab, Name: "Lab", Modified: time.Now()}},
+		Items:     []model.Item{{ID: beaker, Name: "Beaker", LocationID: lab, Number: 3, Modified: time.Now()}},
+	}
+
+	for _, mode := range []string{ImportMerge, ImportReplace} {
+		t.Run(mode, func(t *testing.T) {
+			plan, err := planImport(current, incoming, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plan.locations) != 1 || plan.locations[0].Version != 5 {
+				t.Fatalf("locations %+v, want version 5", plan.locations)
+			}
+			if len(plan.items) != 1 || plan.items[0].Version != 8 {
+				t.Fatalf("items %+v, want version 8", plan.items)
+			}
+		})
+	}
+}
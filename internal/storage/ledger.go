@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reasons given on ledger entries the store writes by itself
+const (
+	reasonItemCreated    = "item created"
+	reasonItemUpdated    = "item updated"
+	reasonReconciliation = "reconciliation"
+)
+
+// parseMovement turns a movement posted for an item into a ledger entry
+func parseMovement(itemID primitive.ObjectID, createMovement model.CreateMovement) (model.Movement, error) {
+	parse := func(id string) (*primitive.ObjectID, error) {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, errors.New("invalid location ID format")
+		}
+		return &objectID, nil
+	}
+
+	movement := model.Movement{
+		ID:       primitive.NewObjectID(),
+		ItemID:   itemID,
+		Type:     createMovement.Type,
+		Quantity: createMovement.Quantity,
+		Reason:   createMovement.Reason,
+		User:     createMovement.User,
+		Created:  time.Now(),
+	}
+
+	var err error
+	switch createMovement.Type {
+	case model.MovementReceive:
+		movement.ToLocationID, err = parse(createMovement.LocationID)
+		movement.Delta = movement.Quantity
+	case model.MovementConsume:
+		movement.FromLocationID, err = parse(createMovement.LocationID)
+		movement.Delta = -movement.Quantity
+	case model.MovementTransfer:
+		if movement.FromLocationID, err = parse(createMovement.FromLocationID); err == nil {
+			movement.ToLocationID, err = parse(createMovement.ToLocationID)
+		}
+	case model.MovementAdjust:
+		movement.Delta = movement.Quantity
+		if movement.Quantity > 0 {
+			movement.ToLocationID, err = parse(createMovement.LocationID)
+		} else {
+			movement.FromLocationID, err = parse(createMovement.LocationID)
+			movement.Quantity = -movement.Quantity
+		}
+	default:
+		err = errors.New("unknown movement type")
+	}
+	if err != nil {
+		return model.Movement{}, err
+	}
+
+	return movement, nil
+}
+
+// stockAdjustments returns the adjust entries that take an item's stock from
+// the quantities in before to those in after
+func stockAdjustments(itemID primitive.ObjectID, before map[primitive.ObjectID]int, after []model.StockLevel, reason string) []model.Movement {
+	remaining := make(map[primitive.ObjectID]int, len(before))
+	for id, number := range before {
+		remaining[id] = number
+	}
+
+	var movements []model.Movement
+	adjust := func(locationID primitive.ObjectID, delta int) {
+		if delta == 0 {
+			return
+		}
+		movement := model.Movement{
+			ID:       primitive.NewObjectID(),
+			ItemID:   itemID,
+			Type:     model.MovementAdjust,
+			Quantity: delta,
+			Delta:    delta,
+			Reason:   reason,
+			Created:  time.Now(),
+		}
+		if delta > 0 {
+			movement.ToLocationID = &locationID
+		} else {
+			movement.FromLocationID = &locationID
+			movement.Quantity = -delta
+		}
+		movements = append(movements, movement)
+	}
+
+	for _, level := range after {
+		adjust(level.LocationID, level.Number-remaining[level.LocationID])
+		delete(remaining, level.LocationID)
+	}
+
+	// Locations the item is no longer stocked at, in a stable order
+	gone := make([]primitive.ObjectID, 0, len(remaining))
+	for id := range remaining {
+		gone = append(gone, id)
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i].Hex() < gone[j].Hex() })
+	for _, id := range gone {
+		adjust(id, -remaining[id])
+	}
+
+	return movements
+}
+
+// stockQuantities returns stock levels as quantities by location
+func stockQuantities(stock []model.StockLevel) map[primitive.ObjectID]int {
+	quantities := make(map[primitive.ObjectID]int, len(stock))
+	for _, level := range stock {
+		quantities[level.LocationID] += level.Number
+	}
+	return quantities
+}
+
+// recordMovement applies a posted movement to item, whose ledger so far is
+// ledger. It returns the updated item and the entries to append: adjust
+// entries reconciling the ledger with the stock the item actually has (stock
+// that predates the ledger, or changed by an import), then the movement itself.
+// A receive, consume or adjust without a location acts on the item's first location.
+// Callers must still check that every location in the updated stock exists.
+func recordMovement(item model.Item, ledger []model.Movement, createMovement model.CreateMovement) (model.Item, []model.Movement, error) {
+	if createMovement.Type != model.MovementTransfer && createMovement.LocationID == "" {
+		if len(item.Stock) == 0 {
+			return model.Item{}, nil, errors.New("item is not stocked at any location")
+		}
+		createMovement.LocationID = item.Stock[0].LocationID.Hex()
+	}
+
+	entries := stockAdjustments(item.ID, model.LedgerBalance(ledger), item.Stock, reasonReconciliation)
+
+	movement, err := parseMovement(item.ID, createMovement)
+	if err != nil {
+		return model.Item{}, nil, err
+	}
+
+	if err := item.Apply(movement); err != nil {
+		return model.Item{}, nil, err
+	}
+	item.Modified = movement.Created
+	item.Version++
+
+	return item, append(entries, movement), nil
+}
+
+// itemChangeEntries returns the adjust entries recording a create or update of
+// an item from before (the zero Item for a new one) to after, reconciling the
+// ledger with before first
+func itemChangeEntries(ledger []model.Movement, before, after model.Item, reason string) []model.Movement {
+	entries := stockAdjustments(after.ID, model.LedgerBalance(ledger), before.Stock, reasonReconciliation)
+	return append(entries, stockAdjustments(after.ID, stockQuantities(before.Stock), after.Stock, reason)...)
+}
+
+// adjustMovement returns the adjust movement that records a stock adjustment
+func adjustMovement(adjust model.AdjustStock) model.CreateMovement {
+	return model.CreateMovement{
+		Type:       model.MovementAdjust,
+		LocationID: adjust.LocationID,
+		Quantity:   adjust.Delta,
+		Reason:     adjust.Reason,
+		User:       adjust.User,
+	}
+}
+
+// adjustResult reports the quantities left by a recorded adjustment
+func adjustResult(result model.MovementResult) model.AdjustResult {
+	locationID := result.Movement.ToLocationID
+	if locationID == nil {
+		locationID = result.Movement.FromLocationID
+	}
+
+	adjusted := model.AdjustResult{
+		ItemID:     result.Item.ID,
+		LocationID: *locationID,
+		Total:      result.Item.Number,
+	}
+	for _, level := range result.Item.Stock {
+		if level.LocationID == *locationID {
+			adjusted.Number = level.Number
+		}
+	}
+	return adjusted
+}
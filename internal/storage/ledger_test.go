@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// balanced reports whether the ledger adds up to exactly the item's stock
+func balanced(ledger []model.Movement, stock []model.StockLevel) bool {
+	balance := model.LedgerBalance(ledger)
+	want := stockQuantities(stock)
+	for id, number := range balance {
+		if want[id] != number {
+			return false
+		}
+	}
+	for id, number := range want {
+		if balance[id] != number {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStockAdjustments(t *testing.T) {
+	itemID := primitive.NewObjectID()
+	a, b, c := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		before map[primitive.ObjectID]int
+		after  []model.StockLevel
+		deltas []int // Delta of each entry, in order
+	}{
+		{"unchanged", map[primitive.ObjectID]int{a: 5}, []model.StockLevel{{LocationID: a, Number: 5}}, nil},
+		{"new item", nil, []model.StockLevel{{LocationID: a, Number: 5}, {LocationID: b, Number: 0}}, []int{5}},
+		{"more and less", map[primitive.ObjectID]int{a: 5, b: 2}, []model.StockLevel{{LocationID: a, Number: 8}, {LocationID: b, Number: 1}}, []int{3, -1}},
+		{"moved away", map[primitive.ObjectID]int{a: 5}, []model.StockLevel{{LocationID: c, Number: 5}}, []int{5, -5}},
+		{"emptied", map[primitive.ObjectID]int{a: 5, b: 1}, nil, []int{-5, -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := stockAdjustments(itemID, tt.before, tt.after, reasonItemUpdated)
+
+			if len(entries) != len(tt.deltas) {
+				t.Fatalf("got %d entries, want %d: %+v", len(entries), len(tt.deltas), entries)
+			}
+			// A ledger holding exactly the quantities before
+			var ledger []model.Movement
+			for id, number := range tt.before {
+				locationID := id
+				ledger = append(ledger, model.Movement{ToLocationID: &locationID, Quantity: number})
+			}
+			for n, entry := range entries {
+				if entry.Type != model.MovementAdjust || entry.ItemID != itemID || entry.Reason != reasonItemUpdated {
+					t.Errorf("entry %d = %+v", n, entry)
+				}
+				if entry.Delta != tt.deltas[n] || entry.Quantity < 0 {
+					t.Errorf("entry %d has delta %d and quantity %d, want delta %d", n, entry.Delta, entry.Quantity, tt.deltas[n])
+				}
+			}
+			if !balanced(append(ledger, entries...), tt.after) {
+				t.Errorf("entries do not take %v to %+v: %+v", tt.before, tt.after, entries)
+			}
+		})
+	}
+}
+
+func TestRecordMovementReconciles(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	item := model.Item{ID: primitive.NewObjectID(), Name: "Gloves", Version: 3}
+	item.Stock = []model.StockLevel{{LocationID: a, Number: 10}, {LocationID: b, Number: 2}}
+	item.Normalize()
+
+	// What the ledger holds before the movement: nothing, the same as the
+	// stock, or quantities an import has since overwritten
+	ledgers := []struct {
+		name    string
+		ledger  []model.Movement
+		entries int // Reconciliation entries expected before the movement
+	}{
+		{"stock predates the ledger", nil, 2},
+		{"ledger matches", stockAdjustments(item.ID, nil, item.Stock, reasonItemCreated), 0},
+		{"stock was imported", stockAdjustments(item.ID, nil, []model.StockLevel{{LocationID: a, Number: 4}}, reasonItemCreated), 2},
+	}
+	movements := []struct {
+		name     string
+		movement model.CreateMovement
+		want     map[primitive.ObjectID]int
+		err      string
+	}{
+		{"receive", model.CreateMovement{Type: model.MovementReceive, LocationID: b.Hex(), Quantity: 5}, map[primitive.ObjectID]int{a: 10, b: 7}, ""},
+		{"consume at first location", model.CreateMovement{Type: model.MovementConsume, Quantity: 4}, map[primitive.ObjectID]int{a: 6, b: 2}, ""},
+		{"transfer", model.CreateMovement{Type: model.MovementTransfer, FromLocationID: a.Hex(), ToLocationID: b.Hex(), Quantity: 10}, map[primitive.ObjectID]int{a: 0, b: 12}, ""},
+		{"adjust down", model.CreateMovement{Type: model.MovementAdjust, LocationID: b.Hex(), Quantity: -2}, map[primitive.ObjectID]int{a: 10, b: 0}, ""},
+		{"consume too much", model.CreateMovement{Type: model.MovementConsume, LocationID: b.Hex(), Quantity: 3}, nil, "insufficient stock"},
+		{"unknown type", model.CreateMovement{Type: "lend", LocationID: a.Hex(), Quantity: 1}, nil, "unknown movement type"},
+		{"bad location", model.CreateMovement{Type: model.MovementReceive, LocationID: "shelf", Quantity: 1}, nil, "invalid location ID"},
+	}
+	for _, l := range ledgers {
+		for _, m := range movements {
+			t.Run(l.name+"/"+m.name, func(t *testing.T) {
+				updated, entries, err := recordMovement(item, l.ledger, m.movement)
+				if m.err != "" {
+					if err == nil || !strings.Contains(err.Error(), m.err) {
+						t.Fatalf("got %v, want an error mentioning %q", err, m.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != l.entries+1 {
+					t.Fatalf("got %d entries, want %d reconciliation entries and the movement: %+v", len(entries), l.entries, entries)
+				}
+				for _, entry := range entries[:l.entries] {
+					if entry.Reason != reasonReconciliation {
+						t.Errorf("reconciliation entry %+v", entry)
+					}
+				}
+				if last := entries[len(entries)-1]; last.Type != m.movement.Type {
+					t.Errorf("last entry is %+v, want the %s movement", last, m.movement.Type)
+				}
+
+				if got := stockQuantities(updated.Stock); len(got) != len(m.want) || got[a] != m.want[a] || got[b] != m.want[b] {
+					t.Errorf("stock = %v, want %v", got, m.want)
+				}
+				if updated.Version != item.Version+1 || updated.Number != m.want[a]+m.want[b] {
+					t.Errorf("updated item %+v", updated)
+				}
+				if !balanced(append(l.ledger, entries...), updated.Stock) {
+					t.Errorf("ledger does not add up to the stock %+v", updated.Stock)
+				}
+			})
+		}
+	}
+}
+
+func TestItemChangeEntries(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	id := primitive.NewObjectID()
+	before := model.Item{ID: id, Stock: []model.StockLevel{{LocationID: a, Number: 6}}}
+	after := model.Item{ID: id, Stock: []model.StockLevel{{LocationID: a, Number: 1}, {LocationID: b, Number: 3}}}
+
+	tests := []struct {
+		name   string
+		ledger []model.Movement
+		before model.Item
+		want   []string // Reason of each entry
+	}{
+		{"new item", nil, model.Item{}, []string{reasonItemUpdated, reasonItemUpdated}},
+		{"ledger matches", stockAdjustments(id, nil, before.Stock, reasonItemCreated), before, []string{reasonItemUpdated, reasonItemUpdated}},
+		{"stock predates the ledger", nil, before, []string{reasonReconciliation, reasonItemUpdated, reasonItemUpdated}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := itemChangeEntries(tt.ledger, tt.before, after, reasonItemUpdated)
+
+			var reasons []string
+			for _, entry := range entries {
+				reasons = append(reasons, entry.Reason)
+			}
+			if strings.Join(reasons, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("reasons = %v, want %v", reasons, tt.want)
+			}
+			if !balanced(append(tt.ledger, entries...), after.Stock) {
+				t.Errorf("ledger does not add up to the stock %+v", after.Stock)
+			}
+		})
+	}
+}
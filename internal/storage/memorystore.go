@@ -0,0 +1,1212 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore keeps the inventory in process memory.
+// It is used directly for tests and throwaway demos, and as the
+// in-memory core of FileStore.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	inventory document
+
+	// persist, when set, is called with the new state before every mutation
+	// is committed; an error aborts the mutation.
+	persist func(document) error
+}
+
+// document is everything a MemoryStore holds, as FileStore saves it to disk.
+// Unlike model.Inventory, which is only items and locations, it includes
+// users, tokens and secrets, so it never leaves the storage package.
+type document struct {
+	Items             []model.Item            `json:"items"`
+	Locations         []model.Location        `json:"locations"`
+	Movements         []model.Movement        `json:"movements,omitempty"`
+	Webhooks          []model.Webhook         `json:"webhooks,omitempty"`
+	WebhookDeliveries []model.WebhookDelivery `json:"webhook_deliveries,omitempty"`
+	Audit             []model.AuditEntry      `json:"audit,omitempty"`
+	Trash             *model.Trash            `json:"trash,omitempty"`
+	Users             []model.User            `json:"users,omitempty"`
+	Sessions          []model.Session         `json:"sessions,omitempty"`
+	APITokens         []model.APIToken        `json:"api_tokens,omitempty"`
+}
+
+// NewMemoryStore creates an in-memory store holding a copy of inventory
+func NewMemoryStore(inventory model.Inventory) *MemoryStore {
+	return newMemoryStore(document{Items: inventory.Items, Locations: inventory.Locations})
+}
+
+// newMemoryStore creates an in-memory store holding a copy of doc
+func newMemoryStore(doc document) *MemoryStore {
+	return &MemoryStore{
+		inventory: document{
+			Items:             normalizeItems(doc.Items),
+			Locations:         append([]model.Location{}, doc.Locations...),
+			Movements:         append([]model.Movement{}, doc.Movements...),
+			Webhooks:          append([]model.Webhook{}, doc.Webhooks...),
+			WebhookDeliveries: append([]model.WebhookDelivery{}, doc.WebhookDeliveries...),
+			Audit:             append([]model.AuditEntry{}, doc.Audit...),
+			Trash:             doc.Trash,
+			Users:             append([]model.User{}, doc.Users...),
+			Sessions:          append([]model.Session{}, doc.Sessions...),
+			APITokens:         append([]model.APIToken{}, doc.APITokens...),
+		},
+	}
+}
+
+// Close is a no-op for the in-memory store
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// commit makes inventory the current state, persisting it first if needed.
+// Callers must hold the write lock.
+func (m *MemoryStore) commit(inventory document) error {
+	if m.persist != nil {
+		if err := m.persist(inventory); err != nil {
+			return err
+		}
+	}
+
+	m.inventory = inventory
+	return nil
+}
+
+// itemIndex returns the index of the item with the given ID, or -1
+func (m *MemoryStore) itemIndex(id primitive.ObjectID) int {
+	for i, item := range m.inventory.Items {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// locationIndex returns the index of the location with the given ID, or -1
+func (m *MemoryStore) locationIndex(id primitive.ObjectID) int {
+	for i, location := range m.inventory.Locations {
+		if location.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// withItems returns a copy of the current inventory with the items replaced
+// and entries appended to the ledger
+func (m *MemoryStore) withItems(items []model.Item, entries ...model.Movement) document {
+	next := m.inventory
+	next.Items = items
+	if len(entries) > 0 {
+		next.Movements = append(append([]model.Movement{}, m.inventory.Movements...), entries...)
+	}
+	return next
+}
+
+// withLocations returns a copy of the current inventory with the locations replaced
+func (m *MemoryStore) withLocations(locations []model.Location) document {
+	next := m.inventory
+	next.Locations = locations
+	return next
+}
+
+// ledger returns the movements recorded for an item, oldest first
+func (m *MemoryStore) ledger(itemID primitive.ObjectID) []model.Movement {
+	movements := []model.Movement{}
+	for _, movement := range m.inventory.Movements {
+		if movement.ItemID == itemID {
+			movements = append(movements, movement)
+		}
+	}
+	return movements
+}
+
+// trash returns a copy of the trash that can be changed freely
+func (m *MemoryStore) trash() model.Trash {
+	trash := model.Trash{Items: []model.Item{}, Locations: []model.Location{}}
+	if m.inventory.Trash != nil {
+		trash.Items = append(trash.Items, m.inventory.Trash.Items...)
+		trash.Locations = append(trash.Locations, m.inventory.Trash.Locations...)
+	}
+	return trash
+}
+
+// GetAllItems returns all items from memory
+func (m *MemoryStore) GetAllItems() ([]model.Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]model.Item{}, m.inventory.Items...), nil
+}
+
+// GetAllLocations returns all locations from memory
+func (m *MemoryStore) GetAllLocations() ([]model.Location, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]model.Location{}, m.inventory.Locations...), nil
+}
+
+// GetItemByID returns a single item by its ID
+func (m *MemoryStore) GetItemByID(id string) (model.Item, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Item{}, errors.New("invalid item ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.itemIndex(objectID)
+	if i < 0 {
+		return model.Item{}, errors.New("item not found")
+	}
+
+	return m.inventory.Items[i], nil
+}
+
+// GetLocationByID returns a single location by its ID
+func (m *MemoryStore) GetLocationByID(id string) (model.Location, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Location{}, errors.New("invalid location ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.locationIndex(objectID)
+	if i < 0 {
+		return model.Location{}, errors.New("location not found")
+	}
+
+	return m.inventory.Locations[i], nil
+}
+
+// checkStockLocations fails unless every stock location exists.
+// Callers must hold the lock.
+func (m *MemoryStore) checkStockLocations(stock []model.StockLevel) error {
+	for _, level := range stock {
+		if m.locationIndex(level.LocationID) < 0 {
+			return errors.New("location does not exist")
+		}
+	}
+	return nil
+}
+
+// AddItem adds a new item to memory
+func (m *MemoryStore) AddItem(createItem model.CreateItem) (model.Item, error) {
+	// Convert location ID strings to ObjectIDs
+	stock, err := parseStock(createItem)
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Validate that the locations exist
+	if err := m.checkStockLocations(stock); err != nil {
+		return model.Item{}, err
+	}
+
+	// Create new item
+	item := newItem(primitive.NewObjectID(), createItem, stock)
+	entries := itemChangeEntries(nil, model.Item{}, item, reasonItemCreated)
+
+	items := append(append([]model.Item{}, m.inventory.Items...), item)
+	if err := m.commit(m.withItems(items, entries...)); err != nil {
+		return model.Item{}, err
+	}
+
+	return item, nil
+}
+
+// AddLocation adds a new location to memory
+func (m *MemoryStore) AddLocation(createLocation model.CreateLocation) (model.Location, error) {
+	parentID, err := parseParentID(createLocation.ParentID)
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Validate that the parent exists
+	if parentID != nil && m.locationIndex(*parentID) < 0 {
+		return model.Location{}, errors.New("parent location does not exist")
+	}
+	if err := checkSiblingName(m.inventory.Locations, parentID, createLocation.Name, primitive.NilObjectID); err != nil {
+		return model.Location{}, err
+	}
+
+	// Create new location
+	location := model.Location{
+		ID:       primitive.NewObjectID(),
+		Name:     createLocation.Name,
+		ParentID: parentID,
+		Modified: time.Now(),
+		Version:  1,
+	}
+
+	locations := append(append([]model.Location{}, m.inventory.Locations...), location)
+	if err := m.commit(m.withLocations(locations)); err != nil {
+		return model.Location{}, err
+	}
+
+	return location, nil
+}
+
+// UpdateLocation renames an existing location in memory
+func (m *MemoryStore) UpdateLocation(id string, updateLocation model.CreateLocation, version int64) (model.Location, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Location{}, errors.New("invalid location ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.locationIndex(objectID)
+	if i < 0 {
+		return model.Location{}, errors.New("location not found")
+	}
+
+	updatedLocation := m.inventory.Locations[i]
+	if err := checkVersion(updatedLocation.Version, version); err != nil {
+		return model.Location{}, err
+	}
+
+	// Location names must stay unique among siblings
+	if err := checkSiblingName(m.inventory.Locations, updatedLocation.ParentID, updateLocation.Name, objectID); err != nil {
+		return model.Location{}, err
+	}
+
+	updatedLocation.Name = updateLocation.Name
+	updatedLocation.Modified = time.Now()
+	updatedLocation.Version++
+
+	locations := append([]model.Location{}, m.inventory.Locations...)
+	locations[i] = updatedLocation
+	if err := m.commit(m.withLocations(locations)); err != nil {
+		return model.Location{}, err
+	}
+
+	return updatedLocation, nil
+}
+
+// MoveLocation moves a location, with everything below it, under a new parent
+func (m *MemoryStore) MoveLocation(id string, move model.MoveLocation, version int64) (model.Location, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Location{}, errors.New("invalid location ID format")
+	}
+	parentID, err := parseParentID(move.ParentID)
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.locationIndex(objectID)
+	if i < 0 {
+		return model.Location{}, errors.New("location not found")
+	}
+	if err := checkVersion(m.inventory.Locations[i].Version, version); err != nil {
+		return model.Location{}, err
+	}
+	if err := checkMove(m.inventory.Locations, objectID, parentID); err != nil {
+		return model.Location{}, err
+	}
+
+	movedLocation := m.inventory.Locations[i]
+	if err := checkSiblingName(m.inventory.Locations, parentID, movedLocation.Name, objectID); err != nil {
+		return model.Location{}, err
+	}
+	movedLocation.ParentID = parentID
+	movedLocation.Modified = time.Now()
+	movedLocation.Version++
+
+	locations := append([]model.Location{}, m.inventory.Locations...)
+	locations[i] = movedLocation
+	if err := m.commit(m.withLocations(locations)); err != nil {
+		return model.Location{}, err
+	}
+
+	return movedLocation, nil
+}
+
+// UpdateItem updates an existing item in memory
+func (m *MemoryStore) UpdateItem(id string, updateItem model.CreateItem, version int64) (model.Item, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Item{}, errors.New("invalid item ID format")
+	}
+
+	// Convert location ID strings to ObjectIDs
+	stock, err := parseStock(updateItem)
+	if err != nil {
+		return model.Item{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Validate that the locations exist
+	if err := m.checkStockLocations(stock); err != nil {
+		return model.Item{}, err
+	}
+
+	i := m.itemIndex(objectID)
+	if i < 0 {
+		return model.Item{}, errors.New("item not found")
+	}
+	if err := checkVersion(m.inventory.Items[i].Version, version); err != nil {
+		return model.Item{}, err
+	}
+
+	// Create updated item
+	updatedItem := newItem(objectID, updateItem, stock)
+	updatedItem.Version = m.inventory.Items[i].Version + 1
+	entries := itemChangeEntries(m.ledger(objectID), m.inventory.Items[i], updatedItem, reasonItemUpdated)
+
+	items := append([]model.Item{}, m.inventory.Items...)
+	items[i] = updatedItem
+	if err := m.commit(m.withItems(items, entries...)); err != nil {
+		return model.Item{}, err
+	}
+
+	return updatedItem, nil
+}
+
+// DeleteItem removes an item from memory
+func (m *MemoryStore) DeleteItem(id string, version int64, deletedBy string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid item ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.itemIndex(objectID)
+	if i < 0 {
+		return errors.New("item not found")
+	}
+	if err := checkVersion(m.inventory.Items[i].Version, version); err != nil {
+		return err
+	}
+
+	items := append(append([]model.Item{}, m.inventory.Items[:i]...), m.inventory.Items[i+1:]...)
+	next := m.withItems(items)
+
+	trash := m.trash()
+	trash.Items = append(trash.Items, trashItem(m.inventory.Items[i], deletedBy, time.Now()))
+	next.Trash = &trash
+	return m.commit(next)
+}
+
+// DeleteLocation removes a location from memory.
+// With cascade, child locations are removed too; otherwise they block the delete.
+func (m *MemoryStore) DeleteLocation(id string, cascade bool, version int64, deletedBy string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid location ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.locationIndex(objectID)
+	if i < 0 {
+		return errors.New("location not found")
+	}
+	if err := checkVersion(m.inventory.Locations[i].Version, version); err != nil {
+		return err
+	}
+
+	ids, err := checkDelete(m.inventory.Locations, objectID, cascade)
+	if err != nil {
+		return err
+	}
+
+	// Check if any items are using these locations
+	for _, item := range m.inventory.Items {
+		if item.StoredIn(ids) {
+			return errors.New("cannot delete location: it is still being used by items")
+		}
+	}
+
+	locations := []model.Location{}
+	deleted := []model.Location{}
+	for _, location := range m.inventory.Locations {
+		if ids[location.ID] {
+			deleted = append(deleted, location)
+		} else {
+			locations = append(locations, location)
+		}
+	}
+	next := m.withLocations(locations)
+
+	trash := m.trash()
+	trash.Locations = append(trash.Locations, trashLocations(deleted, objectID, deletedBy, time.Now())...)
+	next.Trash = &trash
+	return m.commit(next)
+}
+
+// GetItemsInLocation returns the items stored in a location,
+// including those in its sub-locations when includeSublocations is set
+func (m *MemoryStore) GetItemsInLocation(id string, includeSublocations bool) ([]model.Item, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid location ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.locationIndex(objectID) < 0 {
+		return nil, errors.New("location not found")
+	}
+
+	ids := map[primitive.ObjectID]bool{objectID: true}
+	if includeSublocations {
+		ids = subtree(m.inventory.Locations, objectID)
+	}
+
+	items := []model.Item{}
+	for _, item := range m.inventory.Items {
+		if item.StoredIn(ids) {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// AddMovement records a stock movement for an item and applies it to the item's stock
+func (m *MemoryStore) AddMovement(itemID string, createMovement model.CreateMovement) (model.MovementResult, error) {
+	objectID, err := primitive.ObjectIDFromHex(itemID)
+	if err != nil {
+		return model.MovementResult{}, errors.New("invalid item ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.itemIndex(objectID)
+	if i < 0 {
+		return model.MovementResult{}, errors.New("item not found")
+	}
+
+	updatedItem, entries, err := recordMovement(m.inventory.Items[i], m.ledger(objectID), createMovement)
+	if err != nil {
+		return model.MovementResult{}, err
+	}
+	if err := m.checkStockLocations(updatedItem.Stock); err != nil {
+		return model.MovementResult{}, err
+	}
+
+	items := append([]model.Item{}, m.inventory.Items...)
+	items[i] = updatedItem
+	if err := m.commit(m.withItems(items, entries...)); err != nil {
+		return model.MovementResult{}, err
+	}
+
+	return model.MovementResult{Movement: entries[len(entries)-1], Item: updatedItem}, nil
+}
+
+// AdjustStock changes an item's quantity at one location as a single ledger movement
+func (m *MemoryStore) AdjustStock(itemID string, adjust model.AdjustStock) (model.AdjustResult, error) {
+	result, err := m.AddMovement(itemID, adjustMovement(adjust))
+	if err != nil {
+		return model.AdjustResult{}, err
+	}
+
+	return adjustResult(result), nil
+}
+
+// GetMovements returns the ledger of an item, oldest first
+func (m *MemoryStore) GetMovements(itemID string) ([]model.Movement, error) {
+	objectID, err := primitive.ObjectIDFromHex(itemID)
+	if err != nil {
+		return nil, errors.New("invalid item ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.itemIndex(objectID) < 0 {
+		return nil, errors.New("item not found")
+	}
+
+	return m.ledger(objectID), nil
+}
+
+// SearchItems searches for items by name (case-insensitive)
+func (m *MemoryStore) SearchItems(query string) ([]model.Item, error) {
+	if query == "" {
+		return m.GetAllItems()
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	items := []model.Item{}
+	for _, item := range m.inventory.Items {
+		if strings.Contains(strings.ToLower(item.Name), query) {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// GetItemsWithLocations returns every item once per location it is stocked
+// in, with the full path of that location and the quantity kept there
+func (m *MemoryStore) GetItemsWithLocations() ([]model.ItemWithLocation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := model.LocationPaths(m.inventory.Locations)
+
+	itemsWithLocations := make([]model.ItemWithLocation, 0, len(m.inventory.Items))
+	for _, item := range m.inventory.Items {
+		itemsWithLocations = append(itemsWithLocations, item.ToItemsWithLocations(paths)...)
+	}
+
+	return itemsWithLocations, nil
+}
+
+// EachItemWithLocation calls fn for every item and stock location, as GetItemsWithLocations.
+// It works on a snapshot, so fn may be slow without blocking writers.
+func (m *MemoryStore) EachItemWithLocation(fn func(model.ItemWithLocation) error) error {
+	items, err := m.GetItemsWithLocations()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportInventory loads incoming into memory in the given mode (merge or replace)
+func (m *MemoryStore) ImportInventory(incoming model.Inventory, mode string) (model.ImportSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := model.Inventory{Items: m.inventory.Items, Locations: m.inventory.Locations}
+	plan, err := planImport(current, incoming, mode)
+	if err != nil {
+		return model.ImportSummary{}, err
+	}
+
+	next := m.inventory
+	next.Items = []model.Item{}
+	next.Locations = []model.Location{}
+	if !plan.replace {
+		next.Items = append(next.Items, m.inventory.Items...)
+		next.Locations = append(next.Locations, m.inventory.Locations...)
+	}
+
+	locationIndex := make(map[primitive.ObjectID]int, len(next.Locations))
+	for i, location := range next.Locations {
+		locationIndex[location.ID] = i
+	}
+	for _, location := range plan.locations {
+		if i, ok := locationIndex[location.ID]; ok {
+			next.Locations[i] = location
+		} else {
+			next.Locations = append(next.Locations, location)
+		}
+	}
+
+	itemIndex := make(map[primitive.ObjectID]int, len(next.Items))
+	for i, item := range next.Items {
+		itemIndex[item.ID] = i
+	}
+	for _, item := range plan.items {
+		if i, ok := itemIndex[item.ID]; ok {
+			next.Items[i] = item
+		} else {
+			next.Items = append(next.Items, item)
+		}
+	}
+
+	if err := m.commit(next); err != nil {
+		return model.ImportSummary{}, err
+	}
+
+	return plan.summary, nil
+}
+
+// GetWebhooks returns every registered webhook
+func (m *MemoryStore) GetWebhooks() ([]model.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]model.Webhook{}, m.inventory.Webhooks...), nil
+}
+
+// AddWebhook registers a new webhook
+func (m *MemoryStore) AddWebhook(createWebhook model.CreateWebhook) (model.Webhook, error) {
+	webhook, err := newWebhook(createWebhook)
+	if err != nil {
+		return model.Webhook{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.Webhooks = append(append([]model.Webhook{}, m.inventory.Webhooks...), webhook)
+	if err := m.commit(next); err != nil {
+		return model.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (m *MemoryStore) DeleteWebhook(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid webhook ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.Webhooks = []model.Webhook{}
+	for _, webhook := range m.inventory.Webhooks {
+		if webhook.ID != objectID {
+			next.Webhooks = append(next.Webhooks, webhook)
+		}
+	}
+	if len(next.Webhooks) == len(m.inventory.Webhooks) {
+		return errors.New("webhook not found")
+	}
+
+	next.WebhookDeliveries = []model.WebhookDelivery{}
+	for _, delivery := range m.inventory.WebhookDeliveries {
+		if delivery.WebhookID != objectID {
+			next.WebhookDeliveries = append(next.WebhookDeliveries, delivery)
+		}
+	}
+
+	return m.commit(next)
+}
+
+// AddWebhookDelivery records a delivery attempt, dropping the webhook's
+// oldest attempts beyond maxWebhookDeliveries
+func (m *MemoryStore) AddWebhookDelivery(delivery model.WebhookDelivery) error {
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Count from the newest so the oldest extra attempts are the ones dropped
+	kept := 1
+	deliveries := []model.WebhookDelivery{delivery}
+	for i := len(m.inventory.WebhookDeliveries) - 1; i >= 0; i-- {
+		existing := m.inventory.WebhookDeliveries[i]
+		if existing.WebhookID == delivery.WebhookID {
+			if kept >= maxWebhookDeliveries {
+				continue
+			}
+			kept++
+		}
+		deliveries = append(deliveries, existing)
+	}
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+
+	next := m.inventory
+	next.WebhookDeliveries = deliveries
+	return m.commit(next)
+}
+
+// GetWebhookDeliveries returns the recorded delivery attempts of a webhook, newest first
+func (m *MemoryStore) GetWebhookDeliveries(webhookID string) ([]model.WebhookDelivery, error) {
+	objectID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, errors.New("invalid webhook ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := false
+	for _, webhook := range m.inventory.Webhooks {
+		if webhook.ID == objectID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("webhook not found")
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	for i := len(m.inventory.WebhookDeliveries) - 1; i >= 0; i-- {
+		if m.inventory.WebhookDeliveries[i].WebhookID == objectID {
+			deliveries = append(deliveries, m.inventory.WebhookDeliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// AddAuditEntry appends an entry to the audit log
+func (m *MemoryStore) AddAuditEntry(entry model.AuditEntry) error {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.Audit = append(append([]model.AuditEntry{}, m.inventory.Audit...), entry)
+	return m.commit(next)
+}
+
+// GetAuditEntries returns the audit entries passing filter, newest first
+func (m *MemoryStore) GetAuditEntries(filter model.AuditFilter) ([]model.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []model.AuditEntry{}
+	for i := len(m.inventory.Audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		if filter.Matches(m.inventory.Audit[i]) {
+			entries = append(entries, m.inventory.Audit[i])
+		}
+	}
+	return entries, nil
+}
+
+// GetTrash returns the deleted items and locations, newest first
+func (m *MemoryStore) GetTrash() (model.Trash, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return sortTrash(m.trash()), nil
+}
+
+// RestoreFromTrash brings a deleted item or location back
+func (m *MemoryStore) RestoreFromTrash(id string) (model.Trash, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Trash{}, errors.New("invalid ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trash := m.trash()
+	restored, err := planRestore(trash, objectID, m.inventory.Locations, func(id primitive.ObjectID) bool {
+		return m.itemIndex(id) >= 0
+	})
+	if err != nil {
+		return model.Trash{}, err
+	}
+
+	next := m.inventory
+	next.Items = append(append([]model.Item{}, m.inventory.Items...), restored.Items...)
+	next.Locations = append(append([]model.Location{}, m.inventory.Locations...), restored.Locations...)
+	next.Trash = m.withoutTrash(trashIDs(restored))
+	if err := m.commit(next); err != nil {
+		return model.Trash{}, err
+	}
+
+	return restored, nil
+}
+
+// PurgeTrash permanently deletes everything deleted before the given time
+func (m *MemoryStore) PurgeTrash(deletedBefore time.Time) (model.Trash, error) {
+	return m.purge(purgeOlderThan(deletedBefore))
+}
+
+// DeleteFromTrash permanently deletes one deleted item or location
+func (m *MemoryStore) DeleteFromTrash(id string) (model.Trash, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.Trash{}, errors.New("invalid ID format")
+	}
+
+	purged, err := m.purge(purgeID(objectID))
+	if err != nil {
+		return model.Trash{}, err
+	}
+	if len(purged.Items) == 0 && len(purged.Locations) == 0 {
+		return model.Trash{}, ErrNotInTrash
+	}
+	return purged, nil
+}
+
+// purge permanently deletes the trashed records that match, and the ledger of purged items
+func (m *MemoryStore) purge(match func(primitive.ObjectID, time.Time) bool) (model.Trash, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := planPurge(m.trash(), match)
+	if len(purged.Items) == 0 && len(purged.Locations) == 0 {
+		return purged, nil
+	}
+	ids := trashIDs(purged)
+
+	next := m.inventory
+	next.Trash = m.withoutTrash(ids)
+	next.Movements = []model.Movement{}
+	for _, movement := range m.inventory.Movements {
+		if !ids[movement.ItemID] {
+			next.Movements = append(next.Movements, movement)
+		}
+	}
+	if err := m.commit(next); err != nil {
+		return model.Trash{}, err
+	}
+
+	return purged, nil
+}
+
+// withoutTrash returns a copy of the trash without the records with the given IDs
+func (m *MemoryStore) withoutTrash(ids map[primitive.ObjectID]bool) *model.Trash {
+	trash := model.Trash{Items: []model.Item{}, Locations: []model.Location{}}
+	for _, item := range m.trash().Items {
+		if !ids[item.ID] {
+			trash.Items = append(trash.Items, item)
+		}
+	}
+	for _, location := range m.trash().Locations {
+		if !ids[location.ID] {
+			trash.Locations = append(trash.Locations, location)
+		}
+	}
+	return &trash
+}
+
+// GetUsers returns every user
+func (m *MemoryStore) GetUsers() ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]model.User{}, m.inventory.Users...), nil
+}
+
+// GetUserByID returns a specific user by ID
+func (m *MemoryStore) GetUserByID(id string) (model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, errors.New("invalid user ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.inventory.Users {
+		if user.ID == objectID {
+			return user, nil
+		}
+	}
+	return model.User{}, errors.New("user not found")
+}
+
+// GetUserByUsername returns the user with the given user name
+func (m *MemoryStore) GetUserByUsername(username string) (model.User, error) {
+	username = model.NormalizeUsername(username)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.inventory.Users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return model.User{}, errors.New("user not found")
+}
+
+// AddUser creates a user with a unique user name
+func (m *MemoryStore) AddUser(createUser model.CreateUser) (model.User, error) {
+	createUser.Normalize()
+	user, err := newUser(createUser)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.inventory.Users {
+		if existing.Username == user.Username {
+			return model.User{}, errors.New("a user with this username already exists")
+		}
+	}
+
+	next := m.inventory
+	next.Users = append(append([]model.User{}, m.inventory.Users...), user)
+	if err := m.commit(next); err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+// DeleteUser removes a user, ends their sessions and revokes their API tokens
+func (m *MemoryStore) DeleteUser(id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid user ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.Users = []model.User{}
+	for _, user := range m.inventory.Users {
+		if user.ID != objectID {
+			next.Users = append(next.Users, user)
+		}
+	}
+	if len(next.Users) == len(m.inventory.Users) {
+		return errors.New("user not found")
+	}
+
+	next.Sessions = []model.Session{}
+	for _, session := range m.inventory.Sessions {
+		if session.UserID != objectID {
+			next.Sessions = append(next.Sessions, session)
+		}
+	}
+	next.APITokens = []model.APIToken{}
+	for _, token := range m.inventory.APITokens {
+		if token.UserID != objectID {
+			next.APITokens = append(next.APITokens, token)
+		}
+	}
+
+	return m.commit(next)
+}
+
+// AddSession stores a new login session
+func (m *MemoryStore) AddSession(session model.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.Sessions = append(append([]model.Session{}, m.inventory.Sessions...), session)
+	return m.commit(next)
+}
+
+// GetSession returns the session with the given ID
+func (m *MemoryStore) GetSession(id string) (model.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, session := range m.inventory.Sessions {
+		if session.ID == id {
+			return session, nil
+		}
+	}
+	return model.Session{}, errors.New("session not found")
+}
+
+// DeleteSession ends a session
+func (m *MemoryStore) DeleteSession(id string) error {
+	return m.deleteSessions(func(session model.Session) bool {
+		return session.ID == id
+	})
+}
+
+// DeleteExpiredSessions removes the sessions that expired before now
+func (m *MemoryStore) DeleteExpiredSessions(now time.Time) error {
+	return m.deleteSessions(func(session model.Session) bool {
+		return session.Expires.Before(now)
+	})
+}
+
+// deleteSessions removes the sessions that match, if there are any
+func (m *MemoryStore) deleteSessions(match func(model.Session) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.Sessions = []model.Session{}
+	for _, session := range m.inventory.Sessions {
+		if !match(session) {
+			next.Sessions = append(next.Sessions, session)
+		}
+	}
+	if len(next.Sessions) == len(m.inventory.Sessions) {
+		return nil
+	}
+	return m.commit(next)
+}
+
+// UpdateUser changes a user's role
+func (m *MemoryStore) UpdateUser(id string, updateUser model.UpdateUser) (model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, errors.New("invalid user ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, user := range m.inventory.Users {
+		if user.ID != objectID {
+			continue
+		}
+		user.Role = updateUser.Role
+
+		next := m.inventory
+		next.Users = append([]model.User{}, m.inventory.Users...)
+		next.Users[i] = user
+		if err := m.commit(next); err != nil {
+			return model.User{}, err
+		}
+		return user, nil
+	}
+	return model.User{}, errors.New("user not found")
+}
+
+// SetUserPassword replaces a user's password
+func (m *MemoryStore) SetUserPassword(id string, password string) (model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.User{}, errors.New("invalid user ID format")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, user := range m.inventory.Users {
+		if user.ID != objectID {
+			continue
+		}
+		now := time.Now()
+		user.PasswordHash = hash
+		user.PasswordSet = &now
+
+		next := m.inventory
+		next.Users = append([]model.User{}, m.inventory.Users...)
+		next.Users[i] = user
+		if err := m.commit(next); err != nil {
+			return model.User{}, err
+		}
+		return user, nil
+	}
+	return model.User{}, errors.New("user not found")
+}
+
+// GetAPITokens returns a user's API tokens
+func (m *MemoryStore) GetAPITokens(userID string) ([]model.APIToken, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errors.New("invalid user ID format")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := []model.APIToken{}
+	for _, token := range m.inventory.APITokens {
+		if token.UserID == objectID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// GetAPITokenByHash returns the API token with the given hash
+func (m *MemoryStore) GetAPITokenByHash(hash string) (model.APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, token := range m.inventory.APITokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return model.APIToken{}, errors.New("API token not found")
+}
+
+// AddAPIToken stores a new API token
+func (m *MemoryStore) AddAPIToken(token model.APIToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := m.inventory
+	next.APITokens = append(append([]model.APIToken{}, m.inventory.APITokens...), token)
+	return m.commit(next)
+}
+
+// TouchAPIToken records when an API token was last used
+func (m *MemoryStore) TouchAPIToken(id string, lastUsed time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.New("invalid API token ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, token := range m.inventory.APITokens {
+		if token.ID == objectID {
+			token.LastUsed = &lastUsed
+
+			next := m.inventory
+			next.APITokens = append([]model.APIToken{}, m.inventory.APITokens...)
+			next.APITokens[i] = token
+			return m.commit(next)
+		}
+	}
+	return errors.New("API token not found")
+}
+
+// DeleteAPIToken revokes an API token and returns it
+func (m *MemoryStore) DeleteAPIToken(id string) (model.APIToken, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return model.APIToken{}, errors.New("invalid API token ID format")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, token := range m.inventory.APITokens {
+		if token.ID == objectID {
+			next := m.inventory
+			next.APITokens = append(append([]model.APIToken{}, m.inventory.APITokens[:i]...), m.inventory.APITokens[i+1:]...)
+			return token, m.commit(next)
+		}
+	}
+	return model.APIToken{}, errors.New("API token not found")
+}
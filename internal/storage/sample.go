@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SampleInventory returns the starter locations and items used to seed an empty store
+func SampleInventory() model.Inventory {
+	now := time.Now()
+
+	// Create sample locations
+	storageRoom := model.Location{
+		ID:       primitive.NewObjectID(),
+		Name:     "Storage Room",
+		Modified: now,
+	}
+	assemblyRoom := model.Location{
+		ID:       primitive.NewObjectID(),
+		Name:     "Assembly Room",
+		Modified: now,
+	}
+	electronics := model.Location{
+		ID:       primitive.NewObjectID(),
+		Name:     "Electronics",
+		Modified: now,
+	}
+
+	locations := []model.Location{storageRoom, assemblyRoom, electronics}
+
+	// Create sample items using the location IDs
+	items := []model.Item{
+		{
+			ID:         primitive.NewObjectID(),
+			Name:       "Plywood 2mm 900x600mm Sheet",
+			LocationID: storageRoom.ID,
+			Price:      11.15,
+			Number:     25,
+			Modified:   now,
+		},
+		{
+			ID:         primitive.NewObjectID(),
+			Name:       "MDF 4mm 900x600mm Sheet",
+			LocationID: storageRoom.ID,
+			Price:      5.67,
+			Number:     18,
+			Modified:   now,
+		},
+		{
+			ID:              primitive.NewObjectID(),
+			Name:            "Acrylic 5mm 900x600mm Sheet",
+			LocationID:      storageRoom.ID,
+			Price:           19.34,
+			Number:          12,
+			MinQuantity:     15,
+			ReorderQuantity: 10,
+			Modified:        now,
+		},
+		{
+			ID:         primitive.NewObjectID(),
+			Name:       "Wood Glue",
+			LocationID: assemblyRoom.ID,
+			Price:      9.0,
+			Stock: []model.StockLevel{
+				{LocationID: assemblyRoom.ID, Number: 8},
+				{LocationID: storageRoom.ID, Number: 4},
+			},
+			MinQuantity:     10,
+			ReorderQuantity: 6,
+			Modified:        now,
+		},
+		{
+			ID:         primitive.NewObjectID(),
+			Name:       "Resistor SMT 200",
+			LocationID: electronics.ID,
+			Price:      0.2,
+			Number:     150,
+			Modified:   now,
+		},
+	}
+
+	return model.Inventory{Items: normalizeItems(items), Locations: locations}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseStock converts the per-location quantities of a create or update request
+func parseStock(createItem model.CreateItem) ([]model.StockLevel, error) {
+	levels := createItem.StockLevels()
+	stock := make([]model.StockLevel, 0, len(levels))
+	for _, level := range levels {
+		locationID, err := primitive.ObjectIDFromHex(level.LocationID)
+		if err != nil {
+			return nil, errors.New("invalid location ID format")
+		}
+		stock = append(stock, model.StockLevel{LocationID: locationID, Number: level.Number})
+	}
+	return stock, nil
+}
+
+// newItem builds the stored form of an item from a create or update request.
+// Callers updating an item must set the version to one past the stored one.
+func newItem(id primitive.ObjectID, createItem model.CreateItem, stock []model.StockLevel) model.Item {
+	item := model.Item{
+		ID:              id,
+		Name:            createItem.Name,
+		Price:           createItem.Price,
+		Stock:           stock,
+		MinQuantity:     createItem.MinQuantity,
+		ReorderQuantity: createItem.ReorderQuantity,
+		Modified:        time.Now(),
+		Version:         1,
+	}
+	item.Normalize()
+	return item
+}
+
+// normalizeItems fills in per-location stock for items stored before it existed
+func normalizeItems(items []model.Item) []model.Item {
+	normalized := make([]model.Item, len(items))
+	for i, item := range items {
+		item.Normalize()
+		normalized[i] = item
+	}
+	return normalized
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAdjustStock(t *testing.T) {
+	for _, backend := range localBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			shelf, item := fill(t, store)
+			bench, err := store.AddLocation(model.CreateLocation{Name: "Bench"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Each step runs on the stock the previous ones left: 40 on the shelf
+			steps := []struct {
+				name     string
+				adjust   model.AdjustStock
+				number   int    // Quantity at the location afterwards
+				total    int    // Quantity across all locations afterwards
+				rejected string // Part of the error; empty when the adjustment is accepted
+			}{
+				{"take some", model.AdjustStock{Delta: -15}, 25, 25, ""},
+				{"take too many", model.AdjustStock{Delta: -26, LocationID: shelf.ID.Hex()}, 25, 25, "insufficient stock"},
+				{"take from elsewhere", model.AdjustStock{Delta: -1, LocationID: bench.ID.Hex()}, 25, 25, "not stocked at location"},
+				{"add elsewhere", model.AdjustStock{Delta: 3, LocationID: bench.ID.Hex()}, 3, 28, ""},
+				{"take the rest", model.AdjustStock{Delta: -25, LocationID: shelf.ID.Hex()}, 0, 3, ""},
+				{"take from empty", model.AdjustStock{Delta: -1, LocationID: shelf.ID.Hex()}, 0, 3, "insufficient stock"},
+				{"bad location", model.AdjustStock{Delta: -1, LocationID: "shelf"}, 0, 3, "invalid location ID"},
+			}
+			for _, step := range steps {
+				result, err := store.AdjustStock(item.ID.Hex(), step.adjust)
+				if step.rejected != "" {
+					if err == nil || !strings.Contains(err.Error(), step.rejected) {
+						t.Fatalf("%s: got %v, want an error mentioning %q", step.name, err, step.rejected)
+					}
+				} else if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				} else if result.Number != step.number || result.Total != step.total {
+					t.Fatalf("%s: got %+v, want %d at the location and %d in total", step.name, result, step.number, step.total)
+				}
+
+				stored, err := store.GetItemByID(item.ID.Hex())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.Number != step.total {
+					t.Fatalf("%s: stored total %d, want %d", step.name, stored.Number, step.total)
+				}
+				for _, level := range stored.Stock {
+					if level.Number < 0 {
+						t.Fatalf("%s: negative stock %+v", step.name, stored.Stock)
+					}
+				}
+			}
+
+			// Rejected adjustments leave nothing in the ledger
+			ledger, err := store.GetMovements(item.ID.Hex())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ledger) != 4 { // The created stock and three accepted adjustments
+				t.Errorf("ledger has %d entries, want 4: %+v", len(ledger), ledger)
+			}
+			if !balanced(ledger, mustItem(t, store, item.ID).Stock) {
+				t.Errorf("ledger does not add up to the stock")
+			}
+
+			if _, err := store.AdjustStock(primitive.NewObjectID().Hex(), model.AdjustStock{Delta: -1}); err == nil {
+				t.Error("adjusted an unknown item")
+			}
+		})
+	}
+}
+
+// mustItem returns the stored item with the given ID
+func mustItem(t *testing.T, store Store, id primitive.ObjectID) model.Item {
+	t.Helper()
+
+	item, err := store.GetItemByID(id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+// AnyVersion makes an update or delete unconditional
+const AnyVersion int64 = -1
+
+// ErrVersionConflict is returned by a conditional update or delete when the
+// record no longer has the version the caller expected
+var ErrVersionConflict = errors.New("the record was changed by someone else")
+
+// ErrNotInTrash is returned when restoring or purging a record that is not in the trash
+var ErrNotInTrash = errors.New("not found in trash")
+
+// Store is the contract every inventory backend implements.
+// The HTTP handlers depend only on this interface, so backends can be
+// swapped without touching the API layer.
+// Updates and deletes take the version the caller last saw, or AnyVersion,
+// and fail with ErrVersionConflict if the record has changed since.
+// Deletes move records to the trash, out of every listing and lookup.
+type Store interface {
+	// Items
+	GetAllItems() ([]model.Item, error)
+	GetItemByID(id string) (model.Item, error)
+	AddItem(createItem model.CreateItem) (model.Item, error)
+	UpdateItem(id string, updateItem model.CreateItem, version int64) (model.Item, error)
+	DeleteItem(id string, version int64, deletedBy string) error
+	SearchItems(query string) ([]model.Item, error)
+
+	// Locations
+	GetAllLocations() ([]model.Location, error)
+	GetLocationByID(id string) (model.Location, error)
+	AddLocation(createLocation model.CreateLocation) (model.Location, error)
+	UpdateLocation(id string, updateLocation model.CreateLocation, version int64) (model.Location, error)
+	MoveLocation(id string, move model.MoveLocation, version int64) (model.Location, error)
+	DeleteLocation(id string, cascade bool, version int64, deletedBy string) error
+	GetItemsInLocation(id string, includeSublocations bool) ([]model.Item, error)
+
+	// Stock movements; the ledger is append-only and item creates and
+	// updates are recorded in it as adjustments
+	AddMovement(itemID string, movement model.CreateMovement) (model.MovementResult, error)
+	GetMovements(itemID string) ([]model.Movement, error)
+
+	// AdjustStock atomically changes an item's quantity at one location,
+	// refusing to go below zero, and records the change in the ledger
+	AdjustStock(itemID string, adjust model.AdjustStock) (model.AdjustResult, error)
+
+	// Outgoing webhooks, and the log of attempts to deliver events to them
+	GetWebhooks() ([]model.Webhook, error)
+	AddWebhook(createWebhook model.CreateWebhook) (model.Webhook, error)
+	DeleteWebhook(id string) error
+	AddWebhookDelivery(delivery model.WebhookDelivery) error
+	GetWebhookDeliveries(webhookID string) ([]model.WebhookDelivery, error)
+
+	// Trash of deleted records, newest first. Restoring or purging a location
+	// also restores or purges the locations deleted along with it.
+	GetTrash() (model.Trash, error)
+	RestoreFromTrash(id string) (model.Trash, error)
+	PurgeTrash(deletedBefore time.Time) (model.Trash, error)
+	DeleteFromTrash(id string) (model.Trash, error)
+
+	// Users, their login sessions and their API tokens; user names are looked
+	// up normalized, and deleting a user ends their sessions and tokens
+	GetUsers() ([]model.User, error)
+	GetUserByID(id string) (model.User, error)
+	GetUserByUsername(username string) (model.User, error)
+	AddUser(createUser model.CreateUser) (model.User, error)
+	UpdateUser(id string, updateUser model.UpdateUser) (model.User, error)
+	SetUserPassword(id string, password string) (model.User, error)
+	DeleteUser(id string) error
+	AddSession(session model.Session) error
+	GetSession(id string) (model.Session, error)
+	DeleteSession(id string) error
+	DeleteExpiredSessions(now time.Time) error
+	GetAPITokens(userID string) ([]model.APIToken, error)
+	GetAPITokenByHash(hash string) (model.APIToken, error)
+	AddAPIToken(token model.APIToken) error
+	TouchAPIToken(id string, lastUsed time.Time) error
+	DeleteAPIToken(id string) (model.APIToken, error)
+
+	// Audit log of changes, newest first
+	AddAuditEntry(entry model.AuditEntry) error
+	GetAuditEntries(filter model.AuditFilter) ([]model.AuditEntry, error)
+
+	// Joined views
+	GetItemsWithLocations() ([]model.ItemWithLocation, error)
+	EachItemWithLocation(fn func(model.ItemWithLocation) error) error
+
+	// Bulk import of a whole inventory in ImportMerge or ImportReplace mode
+	ImportInventory(inventory model.Inventory, mode string) (model.ImportSummary, error)
+
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Ensure every backend satisfies the Store interface
+var (
+	_ Store = (*MongoStore)(nil)
+	_ Store = (*FileStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*BoltStore)(nil)
+	_ Store = (*EventStore)(nil)
+	_ Store = (*AuditStore)(nil)
+)
+
+// checkVersion fails with ErrVersionConflict unless version is AnyVersion or current
+func checkVersion(current, version int64) error {
+	if version != AnyVersion && version != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
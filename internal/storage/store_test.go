@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// localBackends opens an empty store of each kind that runs without a server
+var localBackends = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore(model.Inventory{}) }},
+	{"file", func(t *testing.T) Store {
+		store, _ := newTestFileStore(t)
+		return store
+	}},
+	{"bolt", func(t *testing.T) Store {
+		store := newTestBoltStore(t, t.TempDir())
+		t.Cleanup(func() { store.Close() })
+		return store
+	}},
+}
+
+// fill puts a small inventory into store through the Store API: a lab with
+// a shelf, an item on the shelf and a user, and returns the shelf and item
+func fill(t *testing.T, store Store) (model.Location, model.Item) {
+	t.Helper()
+
+	lab, err := store.AddLocation(model.CreateLocation{Name: "Test lab"})
+	if err != nil {
+		t.Fatalf("adding lab: %v", err)
+	}
+	shelf, err := store.AddLocation(model.CreateLocation{Name: "Shelf A", ParentID: lab.ID.Hex()})
+	if err != nil {
+		t.Fatalf("adding shelf: %v", err)
+	}
+	item, err := store.AddItem(model.CreateItem{Name: "Pipette tips", LocationID: shelf.ID.Hex(), Price: 12.5, Number: 40})
+	if err != nil {
+		t.Fatalf("adding item: %v", err)
+	}
+	if _, err := store.AddUser(model.CreateUser{Username: "alice", Password: "correct horse", Role: model.RoleMember}); err != nil {
+		t.Fatalf("adding user: %v", err)
+	}
+	return shelf, item
+}
+
+// testStoreCRUD checks the item and location operations every backend has
+// to support the same way
+func testStoreCRUD(t *testing.T, store Store) {
+	shelf, item := fill(t, store)
+
+	got, err := store.GetItemByID(item.ID.Hex())
+	if err != nil || got.Name != "Pipette tips" || got.Number != 40 || got.Version != 1 {
+		t.Fatalf("GetItemByID = %+v, %v", got, err)
+	}
+
+	// Updates bump the version and refuse stale ones
+	updated, err := store.UpdateItem(item.ID.Hex(), model.CreateItem{Name: "Filter tips", LocationID: shelf.ID.Hex(), Price: 14, Number: 35}, item.Version)
+	if err != nil || updated.Name != "Filter tips" || updated.Version != 2 {
+		t.Fatalf("UpdateItem = %+v, %v", updated, err)
+	}
+	if _, err := store.UpdateItem(item.ID.Hex(), model.CreateItem{Name: "Stale", LocationID: shelf.ID.Hex()}, item.Version); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale update: %v", err)
+	}
+	renamed, err := store.UpdateLocation(shelf.ID.Hex(), model.CreateLocation{Name: "Shelf B"}, shelf.Version)
+	if err != nil || renamed.Name != "Shelf B" || renamed.Version != shelf.Version+1 {
+		t.Fatalf("UpdateLocation = %+v, %v", renamed, err)
+	}
+
+	found, err := store.SearchItems("filter")
+	if err != nil || len(found) != 1 || found[0].ID != item.ID {
+		t.Fatalf("SearchItems = %+v, %v", found, err)
+	}
+	parent := *shelf.ParentID
+	below, err := store.GetItemsInLocation(parent.Hex(), true)
+	if err != nil || len(below) != 1 {
+		t.Fatalf("GetItemsInLocation with sub-locations = %+v, %v", below, err)
+	}
+	direct, err := store.GetItemsInLocation(parent.Hex(), false)
+	if err != nil || len(direct) != 0 {
+		t.Fatalf("GetItemsInLocation = %+v, %v", direct, err)
+	}
+
+	missing := primitive.NewObjectID().Hex()
+	refused := []struct {
+		name string
+		err  error
+	}{
+		{"duplicate sibling", func() error {
+			_, err := store.AddLocation(model.CreateLocation{Name: "shelf b", ParentID: parent.Hex()})
+			return err
+		}()},
+		{"item in unknown location", func() error {
+			_, err := store.AddItem(model.CreateItem{Name: "Lost", LocationID: missing, Number: 1})
+			return err
+		}()},
+		{"unknown item", func() error {
+			_, err := store.GetItemByID(missing)
+			return err
+		}()},
+		{"invalid item ID", func() error {
+			_, err := store.GetItemByID("not-an-id")
+			return err
+		}()},
+		{"delete location in use", store.DeleteLocation(shelf.ID.Hex(), false, AnyVersion, "alice")},
+		{"delete stale item", store.DeleteItem(item.ID.Hex(), item.Version, "alice")},
+	}
+	for _, tt := range refused {
+		if tt.err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+
+	// Deleting moves the item to the trash
+	if err := store.DeleteItem(item.ID.Hex(), updated.Version, "alice"); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	if _, err := store.GetItemByID(item.ID.Hex()); err == nil {
+		t.Fatal("deleted item still found")
+	}
+	trash, err := store.GetTrash()
+	if err != nil || len(trash.Items) != 1 || trash.Items[0].ID != item.ID || trash.Items[0].DeletedBy != "alice" {
+		t.Fatalf("GetTrash = %+v, %v", trash, err)
+	}
+	if err := store.DeleteLocation(parent.Hex(), true, AnyVersion, "alice"); err != nil {
+		t.Fatalf("DeleteLocation: %v", err)
+	}
+	if locations, _ := store.GetAllLocations(); len(locations) != 0 {
+		t.Fatalf("locations left after cascade delete: %+v", locations)
+	}
+}
+
+// snapshot returns everything store holds, as JSON, for comparing stores
+func snapshot(t *testing.T, store Store) string {
+	t.Helper()
+
+	items, err := store.GetAllItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations, err := store.GetAllLocations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trash, err := store.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := store.GetUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var movements []model.Movement
+	for _, item := range items {
+		ledger, err := store.GetMovements(item.ID.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		movements = append(movements, ledger...)
+	}
+
+	data, err := json.Marshal([]interface{}{items, locations, trash, users, movements})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// trashItem marks an item as deleted by deletedBy
+func trashItem(item model.Item, deletedBy string, now time.Time) model.Item {
+	item.Deletion = model.Deletion{DeletedAt: &now, DeletedBy: deletedBy}
+	return item
+}
+
+// trashLocations marks the locations deleted by deletedBy, all but root
+// as deleted along with it
+func trashLocations(locations []model.Location, root primitive.ObjectID, deletedBy string, now time.Time) []model.Location {
+	trashed := make([]model.Location, len(locations))
+	for i, location := range locations {
+		location.Deletion = model.Deletion{DeletedAt: &now, DeletedBy: deletedBy}
+		if location.ID != root {
+			location.DeletedWith = &root
+		}
+		trashed[i] = location
+	}
+	return trashed
+}
+
+// sortTrash orders the trash newest deletion first
+func sortTrash(trash model.Trash) model.Trash {
+	sort.SliceStable(trash.Items, func(i, j int) bool {
+		return trash.Items[i].DeletedAt.After(*trash.Items[j].DeletedAt)
+	})
+	sort.SliceStable(trash.Locations, func(i, j int) bool {
+		return trash.Locations[i].DeletedAt.After(*trash.Locations[j].DeletedAt)
+	})
+	return trash
+}
+
+// planRestore works out what restoring the trashed record id brings back:
+// an item, or a location together with the locations deleted along with it.
+// locations are the live locations, and itemExists reports whether a live
+// item has the given ID. The records returned are ready to store.
+func planRestore(trash model.Trash, id primitive.ObjectID, locations []model.Location, itemExists func(primitive.ObjectID) bool) (model.Trash, error) {
+	live := make(map[primitive.ObjectID]bool, len(locations))
+	for _, location := range locations {
+		live[location.ID] = true
+	}
+	now := time.Now()
+
+	for _, item := range trash.Items {
+		if item.ID != id {
+			continue
+		}
+		if itemExists(item.ID) {
+			return model.Trash{}, errors.New("an item with this ID already exists")
+		}
+		for _, level := range item.Stock {
+			if !live[level.LocationID] {
+				return model.Trash{}, errors.New("cannot restore item: one of its locations no longer exists")
+			}
+		}
+		item.Deletion = model.Deletion{}
+		item.Modified = now
+		item.Version++
+		return model.Trash{Items: []model.Item{item}, Locations: []model.Location{}}, nil
+	}
+
+	for _, root := range trash.Locations {
+		if root.ID != id {
+			continue
+		}
+		if root.DeletedWith != nil {
+			return model.Trash{}, errors.New("cannot restore location: it was deleted along with another location; restore that one")
+		}
+		if live[root.ID] {
+			return model.Trash{}, errors.New("a location with this ID already exists")
+		}
+		if root.ParentID != nil && !live[*root.ParentID] {
+			return model.Trash{}, errors.New("cannot restore location: its parent location no longer exists")
+		}
+		if err := checkSiblingName(locations, root.ParentID, root.Name, root.ID); err != nil {
+			return model.Trash{}, err
+		}
+
+		restored := model.Trash{Items: []model.Item{}}
+		for _, location := range trash.Locations {
+			if location.ID == id || (location.DeletedWith != nil && *location.DeletedWith == id) {
+				location.Deletion = model.Deletion{}
+				location.Modified = now
+				location.Version++
+				restored.Locations = append(restored.Locations, location)
+			}
+		}
+		return restored, nil
+	}
+
+	return model.Trash{}, ErrNotInTrash
+}
+
+// planPurge selects the trashed records that match, with a location taking
+// along the locations deleted with it
+func planPurge(trash model.Trash, match func(id primitive.ObjectID, deletedAt time.Time) bool) model.Trash {
+	purged := model.Trash{Items: []model.Item{}, Locations: []model.Location{}}
+	for _, item := range trash.Items {
+		if match(item.ID, *item.DeletedAt) {
+			purged.Items = append(purged.Items, item)
+		}
+	}
+
+	roots := make(map[primitive.ObjectID]bool)
+	for _, location := range trash.Locations {
+		if location.DeletedWith == nil && match(location.ID, *location.DeletedAt) {
+			roots[location.ID] = true
+		}
+	}
+	for _, location := range trash.Locations {
+		if roots[location.ID] || (location.DeletedWith != nil && roots[*location.DeletedWith]) {
+			purged.Locations = append(purged.Locations, location)
+		}
+	}
+	return purged
+}
+
+// purgeOlderThan matches records deleted before cutoff
+func purgeOlderThan(cutoff time.Time) func(primitive.ObjectID, time.Time) bool {
+	return func(_ primitive.ObjectID, deletedAt time.Time) bool {
+		return deletedAt.Before(cutoff)
+	}
+}
+
+// purgeID matches the record with the given ID
+func purgeID(id primitive.ObjectID) func(primitive.ObjectID, time.Time) bool {
+	return func(recordID primitive.ObjectID, _ time.Time) bool {
+		return recordID == id
+	}
+}
+
+// trashIDs returns the IDs of the records in a trash selection
+func trashIDs(trash model.Trash) map[primitive.ObjectID]bool {
+	ids := make(map[primitive.ObjectID]bool, len(trash.Items)+len(trash.Locations))
+	for _, item := range trash.Items {
+		ids[item.ID] = true
+	}
+	for _, location := range trash.Locations {
+		ids[location.ID] = true
+	}
+	return ids
+}
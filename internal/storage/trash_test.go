@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTrashRestore(t *testing.T) {
+	for _, backend := range localBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			shelf, item := fill(t, store)
+			lab := *shelf.ParentID
+			freezer, err := store.AddLocation(model.CreateLocation{Name: "Freezer"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rack, err := store.AddLocation(model.CreateLocation{Name: "Rack", ParentID: freezer.ID.Hex()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Each step runs on what the previous ones left
+			steps := []struct {
+				name    string
+				do      func() error
+				restore primitive.ObjectID
+				items   int    // Live items afterwards
+				locs    int    // Live locations afterwards
+				refused string // Part of the error; empty when the restore is accepted
+			}{
+				{"item", func() error { return store.DeleteItem(item.ID.Hex(), AnyVersion, "alice") }, item.ID, 1, 4, ""},
+				{"item twice", nil, item.ID, 1, 4, ErrNotInTrash.Error()},
+				{"unknown record", nil, primitive.NewObjectID(), 1, 4, ErrNotInTrash.Error()},
+				{"child of a cascade", func() error { return store.DeleteLocation(freezer.ID.Hex(), true, AnyVersion, "alice") }, rack.ID, 1, 2, "restore that one"},
+				{"root of a cascade", nil, freezer.ID, 1, 4, ""},
+				{"name taken again", func() error {
+					if err := store.DeleteLocation(freezer.ID.Hex(), true, AnyVersion, "alice"); err != nil {
+						return err
+					}
+					_, err := store.AddLocation(model.CreateLocation{Name: "freezer"})
+					return err
+				}, freezer.ID, 1, 3, "already exists"},
+				{"item whose location is gone", func() error {
+					if err := store.DeleteItem(item.ID.Hex(), AnyVersion, "alice"); err != nil {
+						return err
+					}
+					return store.DeleteLocation(lab.Hex(), true, AnyVersion, "alice")
+				}, item.ID, 0, 1, "no longer exists"},
+				{"its location first", nil, lab, 0, 3, ""},
+				{"then the item", nil, item.ID, 1, 3, ""},
+			}
+			for _, step := range steps {
+				if step.do != nil {
+					if err := step.do(); err != nil {
+						t.Fatalf("%s: %v", step.name, err)
+					}
+				}
+
+				restored, err := store.RestoreFromTrash(step.restore.Hex())
+				if step.refused != "" {
+					if err == nil || !strings.Contains(err.Error(), step.refused) {
+						t.Fatalf("%s: got %v, want an error mentioning %q", step.name, err, step.refused)
+					}
+				} else if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				} else {
+					for _, location := range restored.Locations {
+						if location.DeletedAt != nil || location.DeletedWith != nil {
+							t.Errorf("%s: restored location still marked deleted: %+v", step.name, location)
+						}
+					}
+					for _, restoredItem := range restored.Items {
+						if restoredItem.DeletedAt != nil {
+							t.Errorf("%s: restored item still marked deleted: %+v", step.name, restoredItem)
+						}
+					}
+				}
+
+				items, _ := store.GetAllItems()
+				locations, _ := store.GetAllLocations()
+				if len(items) != step.items || len(locations) != step.locs {
+					t.Fatalf("%s: %d items and %d locations live, want %d and %d", step.name, len(items), len(locations), step.items, step.locs)
+				}
+			}
+
+			// Restoring bumps the version, so stale copies cannot overwrite it
+			restoredItem := mustItem(t, store, item.ID)
+			if restoredItem.Version <= item.Version {
+				t.Errorf("restored item has version %d, was %d", restoredItem.Version, item.Version)
+			}
+			if _, err := store.UpdateItem(item.ID.Hex(), model.CreateItem{Name: "Stale", LocationID: shelf.ID.Hex()}, item.Version); !errors.Is(err, ErrVersionConflict) {
+				t.Errorf("update with the pre-delete version: %v", err)
+			}
+		})
+	}
+}
+
+func TestTrashPurge(t *testing.T) {
+	for _, backend := range localBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			shelf, item := fill(t, store)
+			lab := *shelf.ParentID
+			old, err := store.AddItem(model.CreateItem{Name: "Old buffer", LocationID: shelf.ID.Hex(), Number: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := store.DeleteItem(old.ID.Hex(), AnyVersion, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			cutoff := time.Now()
+			time.Sleep(10 * time.Millisecond)
+			if err := store.DeleteItem(item.ID.Hex(), AnyVersion, "alice"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.DeleteLocation(lab.Hex(), true, AnyVersion, "alice"); err != nil {
+				t.Fatal(err)
+			}
+
+			steps := []struct {
+				name      string
+				purge     func() (model.Trash, error)
+				items     int // Purged
+				locations int
+				left      int // Records left in the trash
+			}{
+				{"nothing old enough", func() (model.Trash, error) { return store.PurgeTrash(cutoff.Add(-time.Hour)) }, 0, 0, 4},
+				{"older than the cutoff", func() (model.Trash, error) { return store.PurgeTrash(cutoff) }, 1, 0, 3},
+				{"one location with its cascade", func() (model.Trash, error) { return store.DeleteFromTrash(lab.Hex()) }, 0, 2, 1},
+				{"everything", func() (model.Trash, error) { return store.PurgeTrash(time.Now().Add(time.Hour)) }, 1, 0, 0},
+			}
+			for _, step := range steps {
+				purged, err := step.purge()
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if len(purged.Items) != step.items || len(purged.Locations) != step.locations {
+					t.Errorf("%s: purged %d items and %d locations, want %d and %d", step.name, len(purged.Items), len(purged.Locations), step.items, step.locations)
+				}
+				trash, err := store.GetTrash()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if left := len(trash.Items) + len(trash.Locations); left != step.left {
+					t.Errorf("%s: %d records left in the trash, want %d", step.name, left, step.left)
+				}
+			}
+
+			// Purged records are gone for good
+			for _, id := range []primitive.ObjectID{old.ID, item.ID, lab} {
+				if _, err := store.RestoreFromTrash(id.Hex()); !errors.Is(err, ErrNotInTrash) {
+					t.Errorf("restoring purged %s: %v", id.Hex(), err)
+				}
+			}
+			if _, err := store.DeleteFromTrash(shelf.ID.Hex()); !errors.Is(err, ErrNotInTrash) {
+				t.Errorf("purging a purged location: %v", err)
+			}
+		})
+	}
+}
+
+func TestPlanPurge(t *testing.T) {
+	root, child, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	item := primitive.NewObjectID()
+	earlier, later := time.Now().Add(-2*time.Hour), time.Now()
+	trash := model.Trash{
+		Items: []model.Item{{ID: item, Deletion: model.Deletion{DeletedAt: &earlier}}},
+		Locations: []model.Location{
+			{ID: root, Deletion: model.Deletion{DeletedAt: &earlier}},
+			{ID: child, Deletion: model.Deletion{DeletedAt: &earlier, DeletedWith: &root}},
+			{ID: other, Deletion: model.Deletion{DeletedAt: &later}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		match func(primitive.ObjectID, time.Time) bool
+		want  []primitive.ObjectID
+	}{
+		{"by age", purgeOlderThan(time.Now().Add(-time.Hour)), []primitive.ObjectID{item, root, child}},
+		{"nothing that old", purgeOlderThan(earlier), nil},
+		{"root takes its cascade", purgeID(root), []primitive.ObjectID{root, child}},
+		{"cascade child alone", purgeID(child), nil},
+		{"single item", purgeID(item), []primitive.ObjectID{item}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purged := trashIDs(planPurge(trash, tt.match))
+			if len(purged) != len(tt.want) {
+				t.Fatalf("purged %v, want %v", purged, tt.want)
+			}
+			for _, id := range tt.want {
+				if !purged[id] {
+					t.Errorf("%s not purged", id.Hex())
+				}
+			}
+		})
+	}
+}
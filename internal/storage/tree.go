@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseParentID converts an optional parent location ID from the API
+func parseParentID(id string) (*primitive.ObjectID, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid parent location ID format")
+	}
+
+	return &objectID, nil
+}
+
+// sameParent reports whether two optional parent IDs refer to the same parent
+func sameParent(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// subtree returns the IDs of root and every location below it
+func subtree(locations []model.Location, root primitive.ObjectID) map[primitive.ObjectID]bool {
+	children := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, location := range locations {
+		if location.ParentID != nil {
+			children[*location.ParentID] = append(children[*location.ParentID], location.ID)
+		}
+	}
+
+	ids := map[primitive.ObjectID]bool{root: true}
+	queue := []primitive.ObjectID{root}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			if !ids[child] {
+				ids[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	return ids
+}
+
+// checkSiblingName rejects name if another location under the same parent already uses it
+func checkSiblingName(locations []model.Location, parentID *primitive.ObjectID, name string, self primitive.ObjectID) error {
+	for _, location := range locations {
+		if location.ID != self && sameParent(location.ParentID, parentID) && strings.EqualFold(location.Name, name) {
+			return errors.New("a location with this name already exists")
+		}
+	}
+	return nil
+}
+
+// checkMove validates moving location id under parentID (nil for the top level)
+func checkMove(locations []model.Location, id primitive.ObjectID, parentID *primitive.ObjectID) error {
+	if parentID == nil {
+		return nil
+	}
+
+	parentExists := false
+	for _, location := range locations {
+		if location.ID == *parentID {
+			parentExists = true
+			break
+		}
+	}
+	if !parentExists {
+		return errors.New("parent location does not exist")
+	}
+
+	if subtree(locations, id)[*parentID] {
+		return errors.New("cannot move a location into its own subtree")
+	}
+
+	return nil
+}
+
+// checkDelete works out which locations deleting id removes.
+// Without cascade a location with children is refused.
+func checkDelete(locations []model.Location, id primitive.ObjectID, cascade bool) (map[primitive.ObjectID]bool, error) {
+	ids := subtree(locations, id)
+	if len(ids) > 1 && !cascade {
+		return nil, errors.New("cannot delete location: it has child locations")
+	}
+	return ids, nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newUser builds the stored form of a user, hashing the password. Single
+// sign-on users get no password hash, so no password logs them in.
+func newUser(createUser model.CreateUser) (model.User, error) {
+	user := model.User{
+		ID:          primitive.NewObjectID(),
+		Username:    createUser.Username,
+		Role:        createUser.Role,
+		OIDCSubject: createUser.OIDCSubject,
+		Created:     time.Now(),
+	}
+	if createUser.OIDCSubject != "" {
+		return user, nil
+	}
+
+	hash, err := hashPassword(createUser.Password)
+	if err != nil {
+		return model.User{}, err
+	}
+	user.PasswordHash = hash
+	return user, nil
+}
+
+// hashPassword returns the bcrypt hash stored for password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxWebhookDeliveries is how many delivery attempts are kept per webhook;
+// older ones are dropped as new ones are recorded
+const maxWebhookDeliveries = 100
+
+// newWebhook builds the stored form of a webhook, generating a secret if none was given
+func newWebhook(createWebhook model.CreateWebhook) (model.Webhook, error) {
+	secret := createWebhook.Secret
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return model.Webhook{}, err
+		}
+		secret = hex.EncodeToString(key)
+	}
+
+	return model.Webhook{
+		ID:      primitive.NewObjectID(),
+		URL:     createWebhook.URL,
+		Events:  createWebhook.Events,
+		Secret:  secret,
+		Created: time.Now(),
+	}, nil
+}
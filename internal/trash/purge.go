@@ -0,0 +1,70 @@
+// Package trash permanently deletes records that have been in the trash
+// longer than the configured retention
+package trash
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+// purgeInterval is how often the trash is checked for expired records
+const purgeInterval = time.Hour
+
+// Purger is the part of the store the purge job works on
+type Purger interface {
+	PurgeTrash(deletedBefore time.Time) (model.Trash, error)
+}
+
+// Job purges records deleted more than retention ago, once at start and then hourly
+type Job struct {
+	store     Purger
+	retention time.Duration
+}
+
+// New creates a purge job from the configured retention, such as "720h".
+// A retention of zero disables purging.
+func New(store Purger, retention string) (*Job, error) {
+	d, err := time.ParseDuration(retention)
+	if err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid trash retention %q", retention)
+	}
+	return &Job{store: store, retention: d}, nil
+}
+
+// Start runs the job in the background until the returned function is called
+func (j *Job) Start() (stop func()) {
+	if j.retention == 0 {
+		log.Println("Trash retention is 0; deleted records are kept until purged by hand")
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for {
+			j.purge()
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// purge deletes the expired records and logs how many there were
+func (j *Job) purge() {
+	purged, err := j.store.PurgeTrash(time.Now().Add(-j.retention))
+	if err != nil {
+		log.Printf("Failed to purge trash: %v", err)
+		return
+	}
+	if len(purged.Items) > 0 || len(purged.Locations) > 0 {
+		log.Printf("Purged %d items and %d locations from the trash", len(purged.Items), len(purged.Locations))
+	}
+}
@@ -0,0 +1,123 @@
+package trash
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"lab-inv/internal/model"
+)
+
+// purger records the cutoffs the job purges with
+type purger struct {
+	mu      sync.Mutex
+	cutoffs []time.Time
+	err     error
+}
+
+func (p *purger) PurgeTrash(deletedBefore time.Time) (model.Trash, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cutoffs = append(p.cutoffs, deletedBefore)
+	return model.Trash{}, p.err
+}
+
+func (p *purger) calls() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]time.Time(nil), p.cutoffs...)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		retention string
+		want      time.Duration
+		valid     bool
+	}{
+		{"720h", 720 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"0", 0, true},
+		{"0s", 0, true},
+		{"-1h", 0, false},
+		{"a month", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		job, err := New(&purger{}, tt.retention)
+		if (err == nil) != tt.valid {
+			t.Errorf("New(%q) = %v, want valid %v", tt.retention, err, tt.valid)
+			continue
+		}
+		if tt.valid && job.retention != tt.want {
+			t.Errorf("New(%q) retention = %v, want %v", tt.retention, job.retention, tt.want)
+		}
+	}
+}
+
+func TestPurgeCutoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention string
+		err       error
+	}{
+		{"one day", "24h", nil},
+		{"thirty days", "720h", nil},
+		{"store fails", "1h", errors.New("disk full")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &purger{err: tt.err}
+			job, err := New(store, tt.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			before := time.Now()
+			job.purge()
+			after := time.Now()
+
+			calls := store.calls()
+			if len(calls) != 1 {
+				t.Fatalf("purged %d times, want once", len(calls))
+			}
+			if calls[0].Before(before.Add(-job.retention)) || calls[0].After(after.Add(-job.retention)) {
+				t.Errorf("cutoff %v, want %v before now", calls[0], job.retention)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		retention string
+		purges    int // Purges right after starting
+	}{
+		{"720h", 1},
+		{"0", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.retention, func(t *testing.T) {
+			store := &purger{}
+			job, err := New(store, tt.retention)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stop := job.Start()
+			deadline := time.Now().Add(time.Second)
+			for len(store.calls()) < tt.purges && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			stop()
+
+			// The next purge is an hour away, so nothing else happens
+			time.Sleep(10 * time.Millisecond)
+			if got := len(store.calls()); got != tt.purges {
+				t.Errorf("purged %d times, want %d", got, tt.purges)
+			}
+		})
+	}
+}
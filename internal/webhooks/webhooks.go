@@ -0,0 +1,264 @@
+// Package webhooks delivers inventory events to the webhook URLs registered
+// through the API. Every payload is signed with the webhook's secret, and
+// every attempt is recorded in the webhook's delivery log.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Lab-Inv-Signature" // "sha256=" and the hex HMAC-SHA256 of the body
+	EventHeader     = "X-Lab-Inv-Event"     // Event type
+	DeliveryHeader  = "X-Lab-Inv-Delivery"  // Event ID, the same for every attempt
+)
+
+const (
+	// Deliveries waiting to be attempted before new ones are dropped
+	queueSize = 1000
+
+	// Deliveries attempted at the same time
+	workers = 4
+
+	// Longest wait before a retry, however many attempts have failed
+	maxBackoff = time.Hour
+)
+
+// Store is the part of the store the dispatcher reads webhooks from and logs deliveries to
+type Store interface {
+	GetWebhooks() ([]model.Webhook, error)
+	AddWebhookDelivery(delivery model.WebhookDelivery) error
+}
+
+// delivery is one event on its way to one webhook
+type delivery struct {
+	webhook   model.Webhook
+	eventID   string
+	eventType string
+	body      []byte
+	attempt   int
+}
+
+// Dispatcher posts every event published on a bus to the webhooks subscribed to it,
+// retrying failed deliveries with exponential backoff
+type Dispatcher struct {
+	bus     *events.Bus
+	store   Store
+	client  *http.Client
+	retries int
+	backoff time.Duration
+
+	mu      sync.Mutex
+	queue   chan delivery
+	stopped bool
+}
+
+// New creates a dispatcher for the webhooks in store
+func New(bus *events.Bus, store Store, cfg model.WebhookConfig) (*Dispatcher, error) {
+	backoff, err := time.ParseDuration(cfg.RetryBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry backoff: %w", err)
+	}
+
+	return &Dispatcher{
+		bus:     bus,
+		store:   store,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		retries: cfg.Retries,
+		backoff: backoff,
+		queue:   make(chan delivery, queueSize),
+	}, nil
+}
+
+// Sign returns the signature header value for body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start delivers events in the background until the returned function is called.
+// Retries still waiting when it stops are given up.
+func (d *Dispatcher) Start() (stop func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range d.queue {
+				d.attempt(job)
+			}
+		}()
+	}
+
+	ch, cancel := d.bus.Subscribe("webhooks", 256)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range ch {
+			d.dispatch(event)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+
+		d.mu.Lock()
+		d.stopped = true
+		close(d.queue)
+		d.mu.Unlock()
+		wg.Wait()
+	}
+}
+
+// enqueue queues a delivery unless the dispatcher has stopped or is full
+func (d *Dispatcher) enqueue(job delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return
+	}
+	select {
+	case d.queue <- job:
+	default:
+		log.Printf("Webhook queue is full, dropping %s for %s", job.eventType, job.webhook.URL)
+	}
+}
+
+// dispatch queues an event for every webhook subscribed to it
+func (d *Dispatcher) dispatch(event events.Event) {
+	webhooks, err := d.store.GetWebhooks()
+	if err != nil {
+		log.Printf("Failed to load webhooks for %s: %v", event.Type, err)
+		return
+	}
+
+	var body []byte
+	eventID := primitive.NewObjectID().Hex()
+	for _, webhook := range webhooks {
+		if !events.Match(webhook.Events, event.Type) {
+			continue
+		}
+		if body == nil {
+			if body, err = json.Marshal(payload(eventID, event)); err != nil {
+				log.Printf("Failed to encode %s for webhooks: %v", event.Type, err)
+				return
+			}
+		}
+		d.enqueue(delivery{webhook: webhook, eventID: eventID, eventType: event.Type, body: body, attempt: 1})
+	}
+}
+
+// payload builds the body posted for an event
+func payload(eventID string, event events.Event) model.WebhookPayload {
+	var data interface{}
+	switch {
+	case event.Alert != nil:
+		data = event.Alert
+	case event.Item != nil:
+		data = event.Item
+	case event.Location != nil:
+		data = event.Location
+	case event.Import != nil:
+		data = event.Import
+	}
+	return model.WebhookPayload{ID: eventID, Type: event.Type, Time: event.Time, Data: data}
+}
+
+// attempt posts a delivery once, logs the outcome and schedules a retry if it failed
+func (d *Dispatcher) attempt(job delivery) {
+	// Do not keep retrying for a webhook that has been deleted since
+	if job.attempt > 1 && !d.registered(job.webhook.ID) {
+		return
+	}
+
+	record := model.WebhookDelivery{
+		WebhookID: job.webhook.ID,
+		EventID:   job.eventID,
+		EventType: job.eventType,
+		Attempt:   job.attempt,
+		Payload:   json.RawMessage(job.body),
+		Created:   time.Now(),
+	}
+
+	record.StatusCode, record.Success, record.Error = d.post(job)
+	record.Duration = time.Since(record.Created).Milliseconds()
+
+	if err := d.store.AddWebhookDelivery(record); err != nil {
+		log.Printf("Failed to log webhook delivery to %s: %v", job.webhook.URL, err)
+	}
+
+	if record.Success {
+		return
+	}
+	if job.attempt > d.retries {
+		log.Printf("Giving up on %s delivery to %s after %d attempts: %s", job.eventType, job.webhook.URL, job.attempt, record.Error)
+		return
+	}
+
+	wait := d.backoff
+	for i := 1; i < job.attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	job.attempt++
+	time.AfterFunc(wait, func() { d.enqueue(job) })
+}
+
+// post sends a delivery, returning the response status, whether it was a
+// success (2xx) and the error if not
+func (d *Dispatcher) post(job delivery) (int, bool, string) {
+	req, err := http.NewRequest(http.MethodPost, job.webhook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, false, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lab-inv-webhooks")
+	req.Header.Set(SignatureHeader, Sign(job.webhook.Secret, job.body))
+	req.Header.Set(EventHeader, job.eventType)
+	req.Header.Set(DeliveryHeader, job.eventID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, false, err.Error()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, false, "webhook answered " + resp.Status
+	}
+	return resp.StatusCode, true, ""
+}
+
+// registered reports whether the webhook still exists
+func (d *Dispatcher) registered(id primitive.ObjectID) bool {
+	webhooks, err := d.store.GetWebhooks()
+	if err != nil {
+		return true
+	}
+	for _, webhook := range webhooks {
+		if webhook.ID == id {
+			return true
+		}
+	}
+	return false
+}
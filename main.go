@@ -1,61 +1,328 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
+	"lab-inv/internal/alerts"
+	"lab-inv/internal/auth"
+	"lab-inv/internal/config"
+	"lab-inv/internal/events"
+	"lab-inv/internal/export"
+	"lab-inv/internal/importer"
 	"lab-inv/internal/model"
+	"lab-inv/internal/notify"
 	"lab-inv/internal/storage"
+	"lab-inv/internal/trash"
+	"lab-inv/internal/webhooks"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var store *storage.MongoStore
+// eventHeartbeat is how often an idle event stream is sent a keep-alive comment
+const eventHeartbeat = 25 * time.Second
+
+// server holds the dependencies shared by all HTTP handlers
+type server struct {
+	store    storage.Store
+	bus      *events.Bus // Changes made through store are published here
+	sessions *auth.Manager
+	oidc     *auth.OIDC // nil unless single sign-on is configured
+}
+
+// newServer creates a server backed by the given store and event bus,
+// logging users in through sessions and, if it is not nil, oidc
+func newServer(store storage.Store, bus *events.Bus, sessions *auth.Manager, oidc *auth.OIDC) *server {
+	return &server{store: store, bus: bus, sessions: sessions, oidc: oidc}
+}
 
 func main() {
-	// Initialize MongoDB store
-	var err error
-	store, err = storage.NewMongoStore()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		}
+	}
+
+	cfg, err := config.Load(flag.NewFlagSet("lab-inv", flag.ContinueOnError), os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Initialize the storage backend
+	backend, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open %s store: %v", cfg.Store, err)
+	}
+	defer backend.Close()
+
+	// Publish every change so background jobs can react to it
+	bus := events.NewBus()
+	store := storage.NewEventStore(backend, bus)
+
+	checker, err := alerts.NewChecker(bus, store)
+	if err != nil {
+		log.Fatalf("Failed to start low-stock checker: %v", err)
+	}
+	stopChecker := checker.Start()
+	defer stopChecker()
+
+	notifier, err := notify.New(bus, cfg.Notify)
+	if err != nil {
+		log.Fatalf("Failed to set up notifications: %v", err)
+	}
+	stopNotifier := notifier.Start()
+	defer stopNotifier()
+
+	dispatcher, err := webhooks.New(bus, store, cfg.Webhooks)
+	if err != nil {
+		log.Fatalf("Failed to set up webhooks: %v", err)
+	}
+	stopDispatcher := dispatcher.Start()
+	defer stopDispatcher()
+
+	purger, err := trash.New(storage.NewAuditStore(store, storage.Actor{User: "system"}), cfg.TrashRetention)
+	if err != nil {
+		log.Fatalf("Failed to set up trash purging: %v", err)
+	}
+	stopPurger := purger.Start()
+	defer stopPurger()
+
+	// Make sure someone can log in to a fresh install
+	if err := auth.EnsureAdmin(storage.NewAuditStore(store, storage.Actor{User: "system"}), cfg.Auth.AdminPassword, cfg.DataDir); err != nil {
+		log.Fatalf("Failed to create the admin user: %v", err)
+	}
+	sessions, err := auth.New(store, cfg.Auth)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		log.Fatalf("Failed to set up logins: %v", err)
+	}
+	var oidc *auth.OIDC
+	if cfg.Auth.OIDC.Issuer != "" {
+		oidc = auth.NewOIDC(cfg.Auth)
+		log.Printf("Single sign-on through %s", cfg.Auth.OIDC.Issuer)
 	}
-	defer store.Close()
 
 	log.Println("Lab Inventory System starting...")
 
 	// Set up HTTP routes
-	setupRoutes()
+	srv := newServer(store, bus, sessions, oidc)
 
 	// Start server
-	port := ":8080"
-	log.Printf("Server starting on http://localhost%s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	log.Printf("Server starting on http://localhost%s", cfg.Port)
+	log.Fatal(http.ListenAndServe(cfg.Port, srv.routes()))
+}
+
+// openStore creates the storage backend selected by the configuration
+func openStore(cfg model.Config) (storage.Store, error) {
+	switch cfg.Store {
+	case "mongo":
+		return storage.NewMongoStore(cfg.MongoURI, cfg.DatabaseName)
+	case "bolt":
+		return storage.NewBoltStore(cfg.DataDir)
+	case "file":
+		return storage.NewFileStore(cfg.DataDir)
+	case "memory":
+		log.Println("Using in-memory store; changes are lost on exit")
+		return storage.NewMemoryStore(storage.SampleInventory()), nil
+	default:
+		return nil, fmt.Errorf("unknown store %q", cfg.Store)
+	}
 }
 
-// setupRoutes configures all HTTP routes
-func setupRoutes() {
+// routes configures all HTTP routes
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
 	// Serve static files from /static directory
 	fs := http.FileServer(http.Dir("./static/"))
-	http.Handle("/", fs)
+	mux.Handle("/", fs)
 
 	// API routes
-	http.HandleFunc("/api/items", handleItems)
-	http.HandleFunc("/api/items/", handleItemByID)
-	http.HandleFunc("/api/locations", handleLocations)
-	http.HandleFunc("/api/locations/", handleLocationByID)
-	http.HandleFunc("/api/search", handleSearch)
-	http.HandleFunc("/api/items-with-locations", handleItemsWithLocations)
+	mux.HandleFunc("/api/items", s.handleItems)
+	mux.HandleFunc("/api/items/", s.handleItemByID)
+	mux.HandleFunc("/api/items/import", s.handleItemsImport)
+	mux.HandleFunc("/api/locations", s.handleLocations)
+	mux.HandleFunc("/api/locations/", s.handleLocationByID)
+	mux.HandleFunc("/api/search", s.handleSearch)
+	mux.HandleFunc("/api/items-with-locations", s.handleItemsWithLocations)
+	mux.HandleFunc("/api/export", s.handleExport)
+	mux.HandleFunc("/api/import", s.handleImport)
+	mux.HandleFunc("/api/alerts/low-stock", s.handleLowStockAlerts)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	mux.HandleFunc("/api/audit", s.handleAudit)
+	mux.HandleFunc("/api/trash", s.handleTrash)
+	mux.HandleFunc("/api/trash/", s.handleTrashByID)
+	mux.HandleFunc("/api/webhooks", s.handleWebhooks)
+	mux.HandleFunc("/api/webhooks/", s.handleWebhookByID)
+	mux.HandleFunc("/api/login", s.handleLogin)
+	mux.HandleFunc("/api/logout", s.handleLogout)
+	mux.HandleFunc("/api/oidc/login", s.handleOIDCLogin)
+	mux.HandleFunc("/api/oidc/callback", s.handleOIDCCallback)
+	mux.HandleFunc("/api/me", s.handleMe)
+	mux.HandleFunc("/api/me/password", s.handleMePassword)
+	mux.HandleFunc("/api/users", s.handleUsers)
+	mux.HandleFunc("/api/users/", s.handleUserByID)
+	mux.HandleFunc("/api/tokens", s.handleTokens)
+	mux.HandleFunc("/api/tokens/", s.handleTokenByID)
+
+	return withRequestID(s.sessions.Middleware(authorize(mux)))
+}
+
+// routeRole is the least role allowed to call the API paths matching pattern
+// with method ("" for any). Patterns are matched with path.Match, so * stands
+// for one path segment such as an ID.
+type routeRole struct {
+	method  string
+	pattern string
+	role    string
+}
+
+// routeRoles lists the roles needed by API routes; the first match applies.
+// Routes not listed can be read by viewers and changed by managers.
+var routeRoles = []routeRole{
+	{"", "/api/users", model.RoleAdmin},
+	{"", "/api/users/*", model.RoleAdmin},
+	{"", "/api/webhooks", model.RoleAdmin},
+	{"", "/api/webhooks/*", model.RoleAdmin},
+	{"", "/api/webhooks/*/deliveries", model.RoleAdmin},
+	{"", "/api/me/password", model.RoleViewer},
+	{"", "/api/tokens", model.RoleViewer},
+	{"", "/api/tokens/*", model.RoleViewer},
+	{"", "/api/audit", model.RoleManager},
+	{"", "/api/trash", model.RoleManager},
+	{"", "/api/trash/*", model.RoleManager},
+	{"", "/api/trash/*/restore", model.RoleManager},
+	{http.MethodPost, "/api/items", model.RoleMember},         // Setting a price needs a manager, see handleItems
+	{http.MethodPost, "/api/items/import", model.RoleManager}, // Imported items come with prices
+	{http.MethodPut, "/api/items/*", model.RoleMember},        // Price changes need a manager, see handleItemByID
+	{http.MethodPost, "/api/items/*/adjust", model.RoleMember},
+	{http.MethodPost, "/api/items/*/movements", model.RoleMember},
+}
+
+// requiredRole returns the least role allowed to make request r
+func requiredRole(r *http.Request) string {
+	for _, route := range routeRoles {
+		if route.method != "" && route.method != r.Method {
+			continue
+		}
+		if ok, _ := path.Match(route.pattern, r.URL.Path); ok {
+			return route.role
+		}
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return model.RoleViewer
+	}
+	return model.RoleManager
+}
+
+// requiredScope returns the least API token scope allowed to make request r.
+// Tokens can read everything their user can, but only change stock unless
+// they have the full scope.
+func requiredScope(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return model.ScopeReadOnly
+	}
+	if r.Method == http.MethodPost {
+		for _, pattern := range []string{"/api/items/*/adjust", "/api/items/*/movements"} {
+			if ok, _ := path.Match(pattern, r.URL.Path); ok {
+				return model.ScopeStockAdjust
+			}
+		}
+	}
+	return model.ScopeFull
+}
+
+// authorize rejects API requests from logged-in users whose role is not
+// allowed the route and method, and requests made with an API token whose
+// scope is not, with a JSON error naming the role or scope needed. Tokens
+// cannot create or revoke tokens or change passwords; that needs logging in.
+func authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := auth.UserFrom(r.Context())
+		if !ok || r.Method == http.MethodOptions {
+			// Not an API request, or one that needs no login
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if role := requiredRole(r); !user.HasRole(role) {
+			sendForbidden(w, forbiddenError{
+				Error:        fmt.Sprintf("This needs the %s role; you are a %s", role, userRole(user)),
+				RequiredRole: role,
+			})
+			return
+		}
+
+		if token, ok := auth.TokenFrom(r.Context()); ok {
+			if strings.HasPrefix(r.URL.Path, "/api/tokens") && r.Method != http.MethodGet {
+				sendForbidden(w, forbiddenError{Error: "API tokens cannot manage API tokens; log in to do that"})
+				return
+			}
+			if r.URL.Path == "/api/me/password" {
+				sendForbidden(w, forbiddenError{Error: "API tokens cannot change passwords; log in to do that"})
+				return
+			}
+			if scope := requiredScope(r); !token.Allows(scope) {
+				sendForbidden(w, forbiddenError{
+					Error:         fmt.Sprintf("This needs a token with the %s scope; this one is %s", scope, token.Scope),
+					RequiredScope: scope,
+				})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// userRole names a user's role, counting users without one as viewers
+func userRole(user model.User) string {
+	if user.Role == "" {
+		return model.RoleViewer
+	}
+	return user.Role
+}
+
+// forbiddenError is the JSON body of a 403 response
+type forbiddenError struct {
+	Error         string `json:"error"`
+	RequiredRole  string `json:"required_role,omitempty"`
+	RequiredScope string `json:"required_scope,omitempty"`
+}
+
+// sendForbidden refuses a request the user's role or token does not allow
+func sendForbidden(w http.ResponseWriter, body forbiddenError) {
+	enableCORS(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(body)
 }
 
 // handleItems handles GET (list all) and POST (create) for items
-func handleItems(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleItems(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
 	switch r.Method {
 	case http.MethodGet:
-		items, err := store.GetAllItems()
+		items, err := s.store.GetAllItems()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -70,20 +337,18 @@ func handleItems(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Validate input
-		if createItem.Name == "" {
-			http.Error(w, "Item name is required", http.StatusBadRequest)
-			return
-		}
-		if createItem.LocationID == "" {
-			http.Error(w, "Location ID is required", http.StatusBadRequest)
+		if err := createItem.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if createItem.Price < 0 {
-			http.Error(w, "Price must be non-negative", http.StatusBadRequest)
+
+		// Only managers may set prices; members create items without one
+		if user, _ := auth.UserFrom(r.Context()); createItem.Price != 0 && !user.HasRole(model.RoleManager) {
+			sendForbidden(w, forbiddenError{Error: "Only managers may set prices", RequiredRole: model.RoleManager})
 			return
 		}
 
-		item, err := store.AddItem(createItem)
+		item, err := s.storeFor(r).AddItem(createItem)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -100,23 +365,40 @@ func handleItems(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleItemByID handles GET, PUT, DELETE for individual items
-func handleItemByID(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleItemByID(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
-	// Extract ID from URL path
+	// Extract ID (and optional sub-resource) from URL path
 	path := strings.TrimPrefix(r.URL.Path, "/api/items/")
+	path, action, _ := strings.Cut(path, "/")
 	if path == "" {
 		http.Error(w, "Item ID is required", http.StatusBadRequest)
 		return
 	}
 
+	switch action {
+	case "":
+	case "movements":
+		s.handleItemMovements(w, r, path)
+		return
+	case "adjust":
+		s.handleItemAdjust(w, r, path)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		item, err := store.GetItemByID(path)
+		item, err := s.store.GetItemByID(path)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if notModified(w, r, item.Version) {
+			return
+		}
 		sendJSON(w, item)
 
 	case http.MethodPut:
@@ -127,30 +409,50 @@ func handleItemByID(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Validate input
-		if updateItem.Name == "" {
-			http.Error(w, "Item name is required", http.StatusBadRequest)
+		if err := updateItem.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if updateItem.LocationID == "" {
-			http.Error(w, "Location ID is required", http.StatusBadRequest)
+
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
 			return
 		}
-		if updateItem.Price < 0 {
-			http.Error(w, "Price must be non-negative", http.StatusBadRequest)
-			return
+
+		// Only managers may change prices. Pinning the version makes sure the
+		// price a member leaves alone is still the stored one when the update lands.
+		if user, _ := auth.UserFrom(r.Context()); !user.HasRole(model.RoleManager) {
+			current, err := s.store.GetItemByID(path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if updateItem.Price != current.Price {
+				sendForbidden(w, forbiddenError{Error: "Only managers may change prices", RequiredRole: model.RoleManager})
+				return
+			}
+			if version == storage.AnyVersion {
+				version = current.Version
+			}
 		}
 
-		item, err := store.UpdateItem(path, updateItem)
+		item, err := s.storeFor(r).UpdateItem(path, updateItem, version)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			sendStoreError(w, err, http.StatusBadRequest)
 			return
 		}
+		setETag(w, item.Version)
 		sendJSON(w, item)
 
 	case http.MethodDelete:
-		err := store.DeleteItem(path)
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+
+		err := s.storeFor(r).DeleteItem(path, version, requestUser(r))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			sendStoreError(w, err, http.StatusNotFound)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -164,13 +466,154 @@ func handleItemByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleItemMovements handles GET (ledger) and POST (record a movement) for an item's stock
+func (s *server) handleItemMovements(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		movements, err := s.store.GetMovements(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sendJSON(w, movements)
+
+	case http.MethodPost:
+		var createMovement model.CreateMovement
+		if err := json.NewDecoder(r.Body).Decode(&createMovement); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if err := createMovement.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The ledger names the logged-in user, not whoever the client claims to be
+		createMovement.User = requestUser(r)
+
+		result, err := s.storeFor(r).AddMovement(id, createMovement)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendJSON(w, result)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleItemAdjust atomically changes an item's quantity, e.g. {"delta": -3},
+// and returns the new quantity. Going below zero is rejected.
+func (s *server) handleItemAdjust(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodPost:
+		var adjust model.AdjustStock
+		if err := json.NewDecoder(r.Body).Decode(&adjust); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if err := adjust.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The ledger names the logged-in user, not whoever the client claims to be
+		adjust.User = requestUser(r)
+
+		result, err := s.storeFor(r).AdjustStock(id, adjust)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendJSON(w, result)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleItemsImport creates items in bulk from a CSV upload, either as the raw
+// request body or as the "file" field of a multipart form.
+// ?create_locations=true creates locations named in the file that do not exist yet.
+// The batch is all-or-nothing: if any row is invalid nothing is written and
+// the per-row errors are returned with 400.
+func (s *server) handleItemsImport(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodPost:
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				http.Error(w, "CSV file is required", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+
+		locations, err := s.store.GetAllLocations()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		createLocations := r.URL.Query().Get("create_locations") == "true"
+		inventory, rowErrors, err := importer.ParseItemsCSV(body, locations, createLocations)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := model.ItemImportResult{Errors: rowErrors}
+		if len(rowErrors) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(result)
+			return
+		}
+
+		summary, err := s.storeFor(r).ImportInventory(inventory, storage.ImportMerge)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result.ItemsCreated = summary.Items.Created
+		result.LocationsCreated = summary.Locations.Created
+		result.Errors = []model.RowError{}
+		sendJSON(w, result)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 // handleLocations handles GET (list all) and POST (create) for locations
-func handleLocations(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleLocations(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
 	switch r.Method {
 	case http.MethodGet:
-		locations, err := store.GetAllLocations()
+		locations, err := s.store.GetAllLocations()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -190,7 +633,7 @@ func handleLocations(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		location, err := store.AddLocation(createLocation)
+		location, err := s.storeFor(r).AddLocation(createLocation)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -206,30 +649,82 @@ func handleLocations(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleLocationByID handles GET, PUT, DELETE for individual locations
-func handleLocationByID(w http.ResponseWriter, r *http.Request) {
+// handleLocationByID handles GET, PUT, DELETE for individual locations,
+// plus the /items and /move sub-resources
+func (s *server) handleLocationByID(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
-	// Extract ID from URL path
+	// Extract ID (and optional sub-resource) from URL path
 	path := strings.TrimPrefix(r.URL.Path, "/api/locations/")
+	path, action, _ := strings.Cut(path, "/")
 	if path == "" {
 		http.Error(w, "Location ID is required", http.StatusBadRequest)
 		return
 	}
 
+	switch action {
+	case "":
+	case "items":
+		s.handleLocationItems(w, r, path)
+		return
+	case "move":
+		s.handleLocationMove(w, r, path)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		location, err := store.GetLocationByID(path)
+		location, err := s.store.GetLocationByID(path)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
+		if notModified(w, r, location.Version) {
+			return
+		}
+		sendJSON(w, location)
+
+	case http.MethodPut:
+		// Renames only; the parent is changed through /move
+		var updateLocation model.CreateLocation
+		if err := json.NewDecoder(r.Body).Decode(&updateLocation); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if updateLocation.Name == "" {
+			http.Error(w, "Location name is required", http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+
+		location, err := s.storeFor(r).UpdateLocation(path, updateLocation, version)
+		if err != nil {
+			sendStoreError(w, err, http.StatusBadRequest)
+			return
+		}
+		setETag(w, location.Version)
 		sendJSON(w, location)
 
 	case http.MethodDelete:
-		err := store.DeleteLocation(path)
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+
+		// ?cascade=true also deletes child locations
+		cascade := r.URL.Query().Get("cascade") == "true"
+		err := s.storeFor(r).DeleteLocation(path, cascade, version, requestUser(r))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			sendStoreError(w, err, http.StatusBadRequest)
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -243,8 +738,57 @@ func handleLocationByID(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleLocationItems lists the items in a location;
+// ?recursive=true includes items in all of its sub-locations
+func (s *server) handleLocationItems(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	recursive := r.URL.Query().Get("recursive") == "true"
+	items, err := s.store.GetItemsInLocation(id, recursive)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	sendJSON(w, items)
+}
+
+// handleLocationMove moves a location and its subtree under a new parent
+func (s *server) handleLocationMove(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodPost:
+		var move model.MoveLocation
+		if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		version, ok := ifMatchVersion(w, r)
+		if !ok {
+			return
+		}
+
+		location, err := s.storeFor(r).MoveLocation(id, move, version)
+		if err != nil {
+			sendStoreError(w, err, http.StatusBadRequest)
+			return
+		}
+		setETag(w, location.Version)
+		sendJSON(w, location)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 // handleSearch handles item search requests
-func handleSearch(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
 	if r.Method != http.MethodGet {
@@ -253,7 +797,7 @@ func handleSearch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	query := r.URL.Query().Get("q")
-	items, err := store.SearchItems(query)
+	items, err := s.store.SearchItems(query)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -261,8 +805,10 @@ func handleSearch(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, items)
 }
 
-// handleItemsWithLocations returns items with location names joined
-func handleItemsWithLocations(w http.ResponseWriter, r *http.Request) {
+// handleItemsWithLocations returns items with location names joined.
+// ?format=csv or ?format=xlsx streams a spreadsheet instead of JSON,
+// with the columns chosen by ?columns=name,location,...
+func (s *server) handleItemsWithLocations(w http.ResponseWriter, r *http.Request) {
 	enableCORS(w)
 
 	if r.Method != http.MethodGet {
@@ -270,7 +816,13 @@ func handleItemsWithLocations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	itemsWithLocations, err := store.GetItemsWithLocations()
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" {
+		s.exportItemsWithLocations(w, format, r.URL.Query().Get("columns"))
+		return
+	}
+
+	itemsWithLocations, err := s.store.GetItemsWithLocations()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -278,11 +830,869 @@ func handleItemsWithLocations(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, itemsWithLocations)
 }
 
-// enableCORS sets CORS headers for frontend requests
-func enableCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// exportItemsWithLocations streams items with locations as CSV or XLSX
+func (s *server) exportItemsWithLocations(w http.ResponseWriter, format, columnSpec string) {
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		http.Error(w, "Format must be json, csv or xlsx", http.StatusBadRequest)
+		return
+	}
+	columns, err := export.ParseColumns(columnSpec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("lab-inventory-items-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Headers are already sent once rows start flowing, so errors can only be logged
+	if err := export.WriteItems(w, format, columns, s.store.EachItemWithLocation); err != nil {
+		log.Printf("Failed to export items as %s: %v", format, err)
+	}
+}
+
+// handleExport returns the whole inventory as a downloadable JSON document
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	locations, err := s.store.GetAllLocations()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	items, err := s.store.GetAllItems()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("lab-inventory-%s.json", time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	sendJSON(w, model.Inventory{Items: items, Locations: locations})
+}
+
+// handleImport loads an exported inventory; ?mode=merge (default) or ?mode=replace
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodPost:
+		var inventory model.Inventory
+		if err := json.NewDecoder(r.Body).Decode(&inventory); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		summary, err := s.storeFor(r).ImportInventory(inventory, r.URL.Query().Get("mode"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendJSON(w, summary)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleLowStockAlerts handles GET for the items below their minimum quantity
+func (s *server) handleLowStockAlerts(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		items, err := s.store.GetAllItems()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, alerts.LowStock(items))
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Limits on the number of audit entries returned at once
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// handleAudit handles GET for the audit log, newest first.
+// Filters: ?entity=item|location|inventory, ?id=, ?user=, ?since= and
+// ?until= (RFC 3339 times), ?limit=
+func (s *server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		filter := model.AuditFilter{
+			Entity:   query.Get("entity"),
+			EntityID: query.Get("id"),
+			Actor:    query.Get("user"),
+			Limit:    defaultAuditLimit,
+		}
+
+		var err error
+		for name, field := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if value := query.Get(name); value != "" {
+				if *field, err = time.Parse(time.RFC3339, value); err != nil {
+					http.Error(w, fmt.Sprintf("Invalid %s time, expected RFC 3339", name), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		if value := query.Get("limit"); value != "" {
+			limit, err := parseInt(value)
+			if err != nil || limit < 1 || limit > maxAuditLimit {
+				http.Error(w, fmt.Sprintf("Limit must be between 1 and %d", maxAuditLimit), http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := s.store.GetAuditEntries(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, entries)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTrash handles GET for the deleted items and locations, newest first
+func (s *server) handleTrash(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		deleted, err := s.store.GetTrash()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, deleted)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTrashByID handles POST /api/trash/{id}/restore, which brings a deleted
+// record back, and DELETE /api/trash/{id}, which deletes it for good.
+// Both act on a location together with the locations deleted along with it,
+// and return the records affected.
+func (s *server) handleTrashByID(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/trash/")
+	path, action, _ := strings.Cut(path, "/")
+	if path == "" {
+		http.Error(w, "ID is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := primitive.ObjectIDFromHex(path); err != nil {
+		http.Error(w, "invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		affected model.Trash
+		err      error
+	)
+	switch {
+	case action == "restore" && r.Method == http.MethodPost:
+		affected, err = s.storeFor(r).RestoreFromTrash(path)
+
+	case action == "" && r.Method == http.MethodDelete:
+		affected, err = s.storeFor(r).DeleteFromTrash(path)
+
+	case r.Method == http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	case action != "" && action != "restore":
+		http.NotFound(w, r)
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if errors.Is(err, storage.ErrNotInTrash) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	sendJSON(w, affected)
+}
+
+// handleEvents streams inventory changes to the client as Server-Sent Events,
+// one "event: <type>" with the JSON event as data per change.
+// ?types=item.*,location.* limits the stream to matching event types.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		var types []string
+		if spec := r.URL.Query().Get("types"); spec != "" {
+			types = strings.Split(spec, ",")
+		}
+
+		ch, cancel := s.bus.Subscribe("event stream from "+r.RemoteAddr, 64)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		// Comment lines keep proxies from closing an idle stream
+		heartbeat := time.NewTicker(eventHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				if !events.Match(types, event.Type) {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Printf("Failed to encode %s event: %v", event.Type, err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				flusher.Flush()
+			}
+		}
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhooks handles GET (list all) and POST (register) for webhooks.
+// The secret used to sign deliveries is only returned when a webhook is registered.
+func (s *server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		registered, err := s.store.GetWebhooks()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range registered {
+			registered[i].Secret = ""
+		}
+		sendJSON(w, registered)
+
+	case http.MethodPost:
+		var createWebhook model.CreateWebhook
+		if err := json.NewDecoder(r.Body).Decode(&createWebhook); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if err := createWebhook.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := s.store.AddWebhook(createWebhook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendJSON(w, webhook)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleWebhookByID handles DELETE for a webhook and GET for its delivery log
+// (/api/webhooks/{id}/deliveries, newest first)
+func (s *server) handleWebhookByID(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/webhooks/")
+	path, action, _ := strings.Cut(path, "/")
+	if path == "" {
+		http.Error(w, "Webhook ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		if err := s.store.DeleteWebhook(path); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case action == "deliveries" && r.Method == http.MethodGet:
+		deliveries, err := s.store.GetWebhookDeliveries(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sendJSON(w, deliveries)
+
+	case r.Method == http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	case action != "" && action != "deliveries":
+		http.NotFound(w, r)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// loginOptions tells the login page which ways of logging in there are
+type loginOptions struct {
+	SSO bool `json:"sso"`
+}
+
+// handleLogin handles GET for the ways of logging in and POST with a
+// username and password, starting a session
+func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		sendJSON(w, loginOptions{SSO: s.oidc != nil})
+
+	case http.MethodPost:
+		var login model.Login
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		user, err := s.sessions.Login(w, r, login)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			log.Printf("Failed login for %q from %s", login.Username, r.RemoteAddr)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, user.WithoutSecrets())
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOIDCLogin handles GET, sending the browser to the identity provider
+func (s *server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.oidc.Redirect(w, r); err != nil {
+		log.Printf("Failed to start single sign-on: %v", err)
+		loginFailed(w, r, "Single sign-on is unavailable")
+	}
+}
+
+// handleOIDCCallback handles GET when the identity provider sends the
+// browser back, creating or updating the user and starting a session
+func (s *server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, err := s.oidc.Callback(w, r)
+	if err != nil {
+		log.Printf("Failed single sign-on from %s: %v", r.RemoteAddr, err)
+		loginFailed(w, r, "Single sign-on failed: "+err.Error())
+		return
+	}
+
+	// Users created or given a new role here are audited as themselves
+	store := storage.NewAuditStore(s.store, storage.Actor{User: identity.Username, RequestID: requestID(r)})
+	user, err := s.oidc.Provision(store, identity)
+	if err != nil {
+		log.Printf("Refused single sign-on for %q: %v", identity.Username, err)
+		loginFailed(w, r, "Single sign-on failed: "+err.Error())
+		return
+	}
+
+	if err := s.sessions.StartSession(w, r, user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// loginFailed sends the browser back to the login page to show message
+func loginFailed(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/login.html?error="+url.QueryEscape(message), http.StatusFound)
+}
+
+// handleLogout handles POST, ending the request's session
+func (s *server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodPost:
+		if err := s.sessions.Logout(w, r); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleMe handles GET for the logged-in user
+func (s *server) handleMe(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		user, _ := auth.UserFrom(r.Context())
+		sendJSON(w, user.WithoutSecrets())
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleMePassword handles PUT for the logged-in user changing their own
+// password, which needs the current one
+func (s *server) handleMePassword(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodPut:
+		var change model.ChangePassword
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if err := change.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user, _ := auth.UserFrom(r.Context())
+		if user.PasswordHash == "" {
+			http.Error(w, "You sign on through single sign-on; change your password there", http.StatusBadRequest)
+			return
+		}
+		if !auth.CheckPassword(user, change.CurrentPassword) {
+			http.Error(w, "Current password is wrong", http.StatusForbidden)
+			return
+		}
+
+		user, err := s.storeFor(r).SetUserPassword(user.ID.Hex(), change.NewPassword)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sendJSON(w, user.WithoutSecrets())
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUsers handles GET (list all) and POST (create) for users
+func (s *server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	switch r.Method {
+	case http.MethodGet:
+		users, err := s.store.GetUsers()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range users {
+			users[i] = users[i].WithoutSecrets()
+		}
+		sendJSON(w, users)
+
+	case http.MethodPost:
+		var createUser model.CreateUser
+		if err := json.NewDecoder(r.Body).Decode(&createUser); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		createUser.Normalize()
+		if err := createUser.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		user, err := s.storeFor(r).AddUser(createUser)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sendJSON(w, user.WithoutSecrets())
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUserByID handles PUT (change role) and DELETE for a user.
+// Users cannot change their own role or delete themselves, so there is
+// always an admin left.
+func (s *server) handleUserByID(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	if path == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var updateUser model.UpdateUser
+		if err := json.NewDecoder(r.Body).Decode(&updateUser); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if err := updateUser.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if user, _ := auth.UserFrom(r.Context()); user.ID.Hex() == path {
+			http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+			return
+		}
+
+		user, err := s.storeFor(r).UpdateUser(path, updateUser)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		sendJSON(w, user.WithoutSecrets())
+
+	case http.MethodDelete:
+		if user, _ := auth.UserFrom(r.Context()); user.ID.Hex() == path {
+			http.Error(w, "You cannot delete your own account", http.StatusBadRequest)
+			return
+		}
+		if err := s.storeFor(r).DeleteUser(path); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTokens handles GET (list) and POST (create) for the logged-in user's
+// API tokens. A created token is returned this once.
+func (s *server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	user, _ := auth.UserFrom(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := s.store.GetAPITokens(user.ID.Hex())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range tokens {
+			tokens[i] = tokens[i].WithoutSecrets()
+		}
+		sendJSON(w, tokens)
+
+	case http.MethodPost:
+		var createToken model.CreateAPIToken
+		if err := json.NewDecoder(r.Body).Decode(&createToken); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// Validate input
+		if err := createToken.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := auth.NewAPIToken(user, createToken)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := s.storeFor(r).AddAPIToken(result.APIToken); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.APIToken = result.APIToken.WithoutSecrets()
+		sendJSON(w, result)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTokenByID handles DELETE, revoking one of the logged-in user's API tokens
+func (s *server) handleTokenByID(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/tokens/")
+	if id == "" {
+		http.Error(w, "Token ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		// Only the user's own tokens can be revoked; others are not found
+		user, _ := auth.UserFrom(r.Context())
+		tokens, err := s.store.GetAPITokens(user.ID.Hex())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		owned := false
+		for _, token := range tokens {
+			owned = owned || token.ID.Hex() == id
+		}
+		if !owned {
+			http.Error(w, "API token not found", http.StatusNotFound)
+			return
+		}
+
+		if _, err := s.storeFor(r).DeleteAPIToken(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodOptions:
+		// Handle preflight CORS requests
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// enableCORS sets CORS headers for frontend requests
+func enableCORS(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Request-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
+}
+
+// contextKey keys the values handlers share through the request context
+type contextKey string
+
+// requestIDKey holds the ID given to a request by withRequestID
+const requestIDKey contextKey = "request-id"
+
+// withRequestID gives every request an ID, the client's X-Request-ID if it
+// sent a usable one, and returns it in the response so it can be traced in the audit log
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 64 {
+			id = primitive.NewObjectID().Hex()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// requestID returns the ID withRequestID gave the request
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// requestUser names the logged-in user making a request
+func requestUser(r *http.Request) string {
+	if user, ok := auth.UserFrom(r.Context()); ok {
+		return user.Username
+	}
+	return "anonymous"
+}
+
+// storeFor returns the store to make a request's changes through, so that
+// they are audited as made by the request's user
+func (s *server) storeFor(r *http.Request) storage.Store {
+	return storage.NewAuditStore(s.store, storage.Actor{User: requestUser(r), RequestID: requestID(r)})
+}
+
+// etag formats a record version as an entity tag
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// setETag sets the ETag header for a record at version
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// notModified sets the ETag header and answers 304 Not Modified
+// if the client's If-None-Match already names this version
+func notModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	setETag(w, version)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag(version) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion returns the version an update or delete is conditional on,
+// taken from the If-Match header, or storage.AnyVersion without one.
+// A tag that is not one of ours can never match, so it is answered with 412.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return storage.AnyVersion, true
+	}
+
+	unquoted, err := strconv.Unquote(strings.TrimPrefix(tag, "W/"))
+	if err == nil {
+		var version int64
+		if version, err = strconv.ParseInt(unquoted, 10, 64); err == nil && version >= 0 {
+			return version, true
+		}
+	}
+
+	http.Error(w, "If-Match does not match the current version", http.StatusPreconditionFailed)
+	return 0, false
+}
+
+// sendStoreError sends a store error with status,
+// or with 412 Precondition Failed if the record changed since the client read it
+func sendStoreError(w http.ResponseWriter, err error, status int) {
+	if errors.Is(err, storage.ErrVersionConflict) {
+		status = http.StatusPreconditionFailed
+	}
+	http.Error(w, err.Error(), status)
 }
 
 // sendJSON sends a JSON response
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"lab-inv/internal/auth"
+	"lab-inv/internal/events"
+	"lab-inv/internal/model"
+	"lab-inv/internal/storage"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testPassword is the password of every user the tests create
+const testPassword = "correct horse"
+
+// testAPI runs the API over httptest against a MemoryStore
+type testAPI struct {
+	t      *testing.T
+	store  storage.Store
+	server *httptest.Server
+	admin  *http.Client // Logged in as "admin"
+}
+
+// newTestAPI starts the API on a MemoryStore holding inventory, with an
+// "admin" user logged in
+func newTestAPI(t *testing.T, inventory model.Inventory) *testAPI {
+	t.Helper()
+
+	bus := events.NewBus()
+	store := storage.NewEventStore(storage.NewMemoryStore(inventory), bus)
+	if err := auth.EnsureAdmin(store, testPassword, t.TempDir()); err != nil {
+		t.Fatalf("creating admin: %v", err)
+	}
+	sessions, err := auth.New(store, model.AuthConfig{SessionTTL: "1h"})
+	if err != nil {
+		t.Fatalf("creating session manager: %v", err)
+	}
+
+	server := httptest.NewServer(newServer(store, bus, sessions, nil).routes())
+	t.Cleanup(server.Close)
+
+	api := &testAPI{t: t, store: store, server: server}
+	api.admin = api.login("admin")
+	return api
+}
+
+// login returns a client with a session for username
+func (a *testAPI) login(username string) *http.Client {
+	a.t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	resp := a.do(client, http.MethodPost, "/api/login", model.Login{Username: username, Password: testPassword})
+	expectStatus(a.t, resp, http.StatusOK)
+	return client
+}
+
+// userWithRole creates a user with role and returns a client logged in as them
+func (a *testAPI) userWithRole(role string) *http.Client {
+	a.t.Helper()
+
+	username := role + "-" + primitive.NewObjectID().Hex()
+	if _, err := a.store.AddUser(model.CreateUser{Username: username, Password: testPassword, Role: role}); err != nil {
+		a.t.Fatalf("creating %s: %v", role, err)
+	}
+	return a.login(username)
+}
+
+// do sends a request with body, if not nil, encoded as JSON. Headers are
+// given as name and value pairs.
+func (a *testAPI) do(client *http.Client, method, path string, body interface{}, headers ...string) *http.Response {
+	a.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, a.server.URL+path, reader)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	a.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// addLocation creates a location as the admin
+func (a *testAPI) addLocation(name, parentID string) model.Location {
+	a.t.Helper()
+
+	var location model.Location
+	resp := a.do(a.admin, http.MethodPost, "/api/locations", model.CreateLocation{Name: name, ParentID: parentID})
+	decodeJSON(a.t, resp, http.StatusOK, &location)
+	return location
+}
+
+// addItem creates an item as the admin
+func (a *testAPI) addItem(createItem model.CreateItem) model.Item {
+	a.t.Helper()
+
+	var item model.Item
+	resp := a.do(a.admin, http.MethodPost, "/api/items", createItem)
+	decodeJSON(a.t, resp, http.StatusOK, &item)
+	return item
+}
+
+// expectStatus fails the test unless resp has status
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: got %d, want %d: %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+	}
+}
+
+// decodeJSON checks that resp has status and decodes its body into v
+func decodeJSON(t *testing.T, resp *http.Response, status int, v interface{}) {
+	t.Helper()
+
+	expectStatus(t, resp, status)
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("%s %s: decoding response: %v", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+}
+
+func TestItemCRUD(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	shelf := api.addLocation("Shelf", "")
+
+	item := api.addItem(model.CreateItem{Name: "Pipette tips", LocationID: shelf.ID.Hex(), Price: 12.5, Number: 4})
+	if item.ID.IsZero() || item.Number != 4 || len(item.Stock) != 1 || item.Stock[0].LocationID != shelf.ID {
+		t.Fatalf("created item = %+v", item)
+	}
+
+	var got model.Item
+	resp := api.do(api.admin, http.MethodGet, "/api/items/"+item.ID.Hex(), nil)
+	decodeJSON(t, resp, http.StatusOK, &got)
+	if got.Name != "Pipette tips" || resp.Header.Get("ETag") != etag(got.Version) {
+		t.Fatalf("got %+v with ETag %q", got, resp.Header.Get("ETag"))
+	}
+	resp = api.do(api.admin, http.MethodGet, "/api/items/"+item.ID.Hex(), nil, "If-None-Match", etag(got.Version))
+	expectStatus(t, resp, http.StatusNotModified)
+
+	var items []model.Item
+	decodeJSON(t, api.do(api.admin, http.MethodGet, "/api/items", nil), http.StatusOK, &items)
+	if len(items) != 1 || items[0].ID != item.ID {
+		t.Fatalf("listed %+v", items)
+	}
+
+	var found []model.Item
+	decodeJSON(t, api.do(api.admin, http.MethodGet, "/api/search?q=PIPETTE", nil), http.StatusOK, &found)
+	if len(found) != 1 {
+		t.Fatalf("search found %+v", found)
+	}
+
+	var updated model.Item
+	update := model.CreateItem{Name: "Filter tips", LocationID: shelf.ID.Hex(), Price: 14, Number: 6}
+	resp = api.do(api.admin, http.MethodPut, "/api/items/"+item.ID.Hex(), update, "If-Match", etag(got.Version))
+	decodeJSON(t, resp, http.StatusOK, &updated)
+	if updated.Name != "Filter tips" || updated.Number != 6 || updated.Version != got.Version+1 {
+		t.Fatalf("updated item = %+v", updated)
+	}
+	if resp.Header.Get("ETag") != etag(updated.Version) {
+		t.Fatalf("update ETag = %q", resp.Header.Get("ETag"))
+	}
+
+	resp = api.do(api.admin, http.MethodDelete, "/api/items/"+item.ID.Hex(), nil, "If-Match", etag(updated.Version))
+	expectStatus(t, resp, http.StatusNoContent)
+	resp = api.do(api.admin, http.MethodGet, "/api/items/"+item.ID.Hex(), nil)
+	expectStatus(t, resp, http.StatusNotFound)
+
+	var trash model.Trash
+	decodeJSON(t, api.do(api.admin, http.MethodGet, "/api/trash", nil), http.StatusOK, &trash)
+	if len(trash.Items) != 1 || trash.Items[0].ID != item.ID || trash.Items[0].DeletedBy != "admin" {
+		t.Fatalf("trash = %+v", trash)
+	}
+}
+
+func TestItemValidation(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	shelf := api.addLocation("Shelf", "")
+
+	tests := []struct {
+		name string
+		item model.CreateItem
+	}{
+		{"no name", model.CreateItem{LocationID: shelf.ID.Hex(), Number: 1}},
+		{"negative number", model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Number: -1}},
+		{"unknown location", model.CreateItem{Name: "Gloves", LocationID: primitive.NewObjectID().Hex(), Number: 1}},
+		{"malformed location", model.CreateItem{Name: "Gloves", LocationID: "shelf", Number: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, api.do(api.admin, http.MethodPost, "/api/items", tt.item), http.StatusBadRequest)
+		})
+	}
+
+	var items []model.Item
+	decodeJSON(t, api.do(api.admin, http.MethodGet, "/api/items", nil), http.StatusOK, &items)
+	if len(items) != 0 {
+		t.Fatalf("invalid items were stored: %+v", items)
+	}
+}
+
+func TestLocationCRUD(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	lab := api.addLocation("Lab", "")
+	shelf := api.addLocation("Shelf A", lab.ID.Hex())
+	freezer := api.addLocation("Freezer", "")
+
+	if shelf.ParentID == nil || *shelf.ParentID != lab.ID {
+		t.Fatalf("shelf parent = %v, want %s", shelf.ParentID, lab.ID.Hex())
+	}
+	resp := api.do(api.admin, http.MethodPost, "/api/locations", model.CreateLocation{Name: "shelf a", ParentID: lab.ID.Hex()})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	var renamed model.Location
+	resp = api.do(api.admin, http.MethodPut, "/api/locations/"+shelf.ID.Hex(), model.CreateLocation{Name: "Shelf B"})
+	decodeJSON(t, resp, http.StatusOK, &renamed)
+	if renamed.Name != "Shelf B" || renamed.Version != shelf.Version+1 {
+		t.Fatalf("renamed = %+v", renamed)
+	}
+
+	var moved model.Location
+	resp = api.do(api.admin, http.MethodPost, "/api/locations/"+shelf.ID.Hex()+"/move", model.MoveLocation{ParentID: freezer.ID.Hex()})
+	decodeJSON(t, resp, http.StatusOK, &moved)
+	if moved.ParentID == nil || *moved.ParentID != freezer.ID {
+		t.Fatalf("moved = %+v", moved)
+	}
+	resp = api.do(api.admin, http.MethodPost, "/api/locations/"+freezer.ID.Hex()+"/move", model.MoveLocation{ParentID: shelf.ID.Hex()})
+	expectStatus(t, resp, http.StatusBadRequest)
+
+	// Locations holding stock, or with children unless cascading, stay
+	api.addItem(model.CreateItem{Name: "Enzyme", LocationID: shelf.ID.Hex(), Number: 1})
+	expectStatus(t, api.do(api.admin, http.MethodDelete, "/api/locations/"+shelf.ID.Hex(), nil), http.StatusBadRequest)
+	expectStatus(t, api.do(api.admin, http.MethodDelete, "/api/locations/"+freezer.ID.Hex(), nil), http.StatusBadRequest)
+
+	expectStatus(t, api.do(api.admin, http.MethodDelete, "/api/locations/"+lab.ID.Hex(), nil), http.StatusNoContent)
+	expectStatus(t, api.do(api.admin, http.MethodGet, "/api/locations/"+lab.ID.Hex(), nil), http.StatusNotFound)
+
+	var locations []model.Location
+	decodeJSON(t, api.do(api.admin, http.MethodGet, "/api/locations", nil), http.StatusOK, &locations)
+	if len(locations) != 2 {
+		t.Fatalf("locations = %+v", locations)
+	}
+}
+
+func TestVersionConflicts(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	shelf := api.addLocation("Shelf", "")
+	other := api.addLocation("Other", "")
+	item := api.addItem(model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10})
+
+	itemPath := "/api/items/" + item.ID.Hex()
+	shelfPath := "/api/locations/" + shelf.ID.Hex()
+	stale := etag(item.Version + 1)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		tag    string
+	}{
+		{"update item", http.MethodPut, itemPath, model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10}, stale},
+		{"delete item", http.MethodDelete, itemPath, nil, stale},
+		{"update location", http.MethodPut, shelfPath, model.CreateLocation{Name: "Top shelf"}, stale},
+		{"move location", http.MethodPost, shelfPath + "/move", model.MoveLocation{ParentID: other.ID.Hex()}, stale},
+		{"delete location", http.MethodDelete, "/api/locations/" + other.ID.Hex(), nil, stale},
+		{"foreign tag", http.MethodPut, itemPath, model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10}, `"abc"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, api.do(api.admin, tt.method, tt.path, tt.body, "If-Match", tt.tag), http.StatusPreconditionFailed)
+		})
+	}
+
+	// Nothing changed, and the current version still goes through
+	var current model.Item
+	decodeJSON(t, api.do(api.admin, http.MethodGet, itemPath, nil), http.StatusOK, &current)
+	if current.Name != "Gloves" || current.Version != item.Version {
+		t.Fatalf("item changed by refused requests: %+v", current)
+	}
+	var location model.Location
+	decodeJSON(t, api.do(api.admin, http.MethodGet, shelfPath, nil), http.StatusOK, &location)
+	if location.Name != "Shelf" || location.ParentID != nil {
+		t.Fatalf("location changed by refused requests: %+v", location)
+	}
+	resp := api.do(api.admin, http.MethodDelete, itemPath, nil, "If-Match", etag(item.Version))
+	expectStatus(t, resp, http.StatusNoContent)
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		version int64
+		ok      bool
+	}{
+		{"", storage.AnyVersion, true},
+		{"*", storage.AnyVersion, true},
+		{`"7"`, 7, true},
+		{` W/"7" `, 7, true},
+		{`"0"`, 0, true},
+		{`7`, 0, false},
+		{`"-1"`, 0, false},
+		{`"seven"`, 0, false},
+		{`"7", "8"`, 0, false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/items/x", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+
+		version, ok := ifMatchVersion(w, r)
+		if ok != tt.ok || (ok && version != tt.version) {
+			t.Errorf("If-Match %s: got %d, %v; want %d, %v", tt.header, version, ok, tt.version, tt.ok)
+		}
+		if !ok && w.Code != http.StatusPreconditionFailed {
+			t.Errorf("If-Match %s: answered %d, want 412", tt.header, w.Code)
+		}
+	}
+}
+
+func TestStaleIfMatch(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	shelf := api.addLocation("Shelf", "")
+	item := api.addItem(model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10})
+	itemPath := "/api/items/" + item.ID.Hex()
+	shelfPath := "/api/locations/" + shelf.ID.Hex()
+
+	// Two clients read the same versions; the second to write has lost the race
+	resp := api.do(api.admin, http.MethodGet, itemPath, nil)
+	expectStatus(t, resp, http.StatusOK)
+	itemTag := resp.Header.Get("ETag")
+	resp = api.do(api.admin, http.MethodGet, shelfPath, nil)
+	expectStatus(t, resp, http.StatusOK)
+	shelfTag := resp.Header.Get("ETag")
+	if itemTag != etag(item.Version) || shelfTag != etag(shelf.Version) {
+		t.Fatalf("ETags %s and %s, want %s and %s", itemTag, shelfTag, etag(item.Version), etag(shelf.Version))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		first  interface{}
+		second interface{}
+	}{
+		{"item update", http.MethodPut, itemPath,
+			model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10},
+			model.CreateItem{Name: "Latex gloves", LocationID: shelf.ID.Hex(), Price: 3, Number: 10}},
+		{"location rename", http.MethodPut, shelfPath,
+			model.CreateLocation{Name: "Top shelf"},
+			model.CreateLocation{Name: "Bottom shelf"}},
+	}
+	tags := map[string]string{itemPath: itemTag, shelfPath: shelfTag}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.do(api.admin, tt.method, tt.path, tt.first, "If-Match", tags[tt.path])
+			expectStatus(t, resp, http.StatusOK)
+			fresh := resp.Header.Get("ETag")
+			if fresh == tags[tt.path] {
+				t.Fatalf("ETag %s unchanged by the update", fresh)
+			}
+
+			expectStatus(t, api.do(api.admin, tt.method, tt.path, tt.second, "If-Match", tags[tt.path]), http.StatusPreconditionFailed)
+			expectStatus(t, api.do(api.admin, http.MethodDelete, tt.path, nil, "If-Match", tags[tt.path]), http.StatusPreconditionFailed)
+
+			// Re-reading gives the winner's version, which can be built on
+			resp = api.do(api.admin, http.MethodGet, tt.path, nil, "If-None-Match", fresh)
+			expectStatus(t, resp, http.StatusNotModified)
+			expectStatus(t, api.do(api.admin, tt.method, tt.path, tt.second, "If-Match", fresh), http.StatusOK)
+		})
+	}
+
+	var current model.Item
+	decodeJSON(t, api.do(api.admin, http.MethodGet, itemPath, nil), http.StatusOK, &current)
+	if current.Name != "Latex gloves" || current.Version != item.Version+2 {
+		t.Fatalf("item after the race: %+v", current)
+	}
+}
+
+func TestStockReconciliation(t *testing.T) {
+	// An item whose stock predates the ledger
+	bench := model.Location{ID: primitive.NewObjectID(), Name: "Bench"}
+	cabinet := model.Location{ID: primitive.NewObjectID(), Name: "Cabinet"}
+	item := model.Item{
+		ID:    primitive.NewObjectID(),
+		Name:  "Ethanol",
+		Stock: []model.StockLevel{{LocationID: bench.ID, Number: 5}},
+	}
+	api := newTestAPI(t, model.Inventory{Items: []model.Item{item}, Locations: []model.Location{bench, cabinet}})
+	itemPath := "/api/items/" + item.ID.Hex()
+
+	var moved model.MovementResult
+	transfer := model.CreateMovement{Type: model.MovementTransfer, FromLocationID: bench.ID.Hex(), ToLocationID: cabinet.ID.Hex(), Quantity: 2}
+	decodeJSON(t, api.do(api.admin, http.MethodPost, itemPath+"/movements", transfer), http.StatusOK, &moved)
+	if moved.Item.Number != 5 || stockAt(moved.Item, bench.ID) != 3 || stockAt(moved.Item, cabinet.ID) != 2 {
+		t.Fatalf("after transfer: %+v", moved.Item)
+	}
+	if moved.Movement.User != "admin" {
+		t.Fatalf("movement user = %q, want the logged-in user", moved.Movement.User)
+	}
+
+	var adjusted model.AdjustResult
+	resp := api.do(api.admin, http.MethodPost, itemPath+"/adjust", model.AdjustStock{Delta: -3, LocationID: cabinet.ID.Hex()})
+	expectStatus(t, resp, http.StatusBadRequest)
+	resp = api.do(api.admin, http.MethodPost, itemPath+"/adjust", model.AdjustStock{Delta: -1, LocationID: cabinet.ID.Hex()})
+	decodeJSON(t, resp, http.StatusOK, &adjusted)
+	if adjusted.Number != 1 || adjusted.Total != 4 {
+		t.Fatalf("after adjust: %+v", adjusted)
+	}
+
+	// Editing the stock directly is recorded as adjustments too
+	var updated model.Item
+	update := model.CreateItem{Name: "Ethanol", Stock: []model.CreateStock{{LocationID: cabinet.ID.Hex(), Number: 7}}}
+	decodeJSON(t, api.do(api.admin, http.MethodPut, itemPath, update), http.StatusOK, &updated)
+	if updated.Number != 7 || stockAt(updated, bench.ID) != 0 {
+		t.Fatalf("after update: %+v", updated)
+	}
+
+	var ledger []model.Movement
+	decodeJSON(t, api.do(api.admin, http.MethodGet, itemPath+"/movements", nil), http.StatusOK, &ledger)
+	if len(ledger) == 0 || ledger[0].Reason != "reconciliation" || ledger[0].Delta != 5 {
+		t.Fatalf("ledger does not start by reconciling the existing stock: %+v", ledger)
+	}
+	total := 0
+	for _, movement := range ledger {
+		total += movement.Delta
+	}
+	if total != updated.Number {
+		t.Fatalf("ledger adds up to %d, item has %d", total, updated.Number)
+	}
+	balance := model.LedgerBalance(ledger)
+	if balance[cabinet.ID] != 7 || balance[bench.ID] != 0 {
+		t.Fatalf("ledger balance = %v", balance)
+	}
+}
+
+// stockAt returns the quantity of item at a location
+func stockAt(item model.Item, locationID primitive.ObjectID) int {
+	for _, level := range item.Stock {
+		if level.LocationID == locationID {
+			return level.Number
+		}
+	}
+	return 0
+}
+
+func TestRequiresLogin(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+
+	resp := api.do(http.DefaultClient, http.MethodGet, "/api/items", nil)
+	expectStatus(t, resp, http.StatusUnauthorized)
+
+	login := model.Login{Username: "admin", Password: "wrong password"}
+	expectStatus(t, api.do(http.DefaultClient, http.MethodPost, "/api/login", login), http.StatusUnauthorized)
+
+	expectStatus(t, api.do(api.admin, http.MethodPost, "/api/logout", nil), http.StatusNoContent)
+	expectStatus(t, api.do(api.admin, http.MethodGet, "/api/items", nil), http.StatusUnauthorized)
+}
+
+// openEvents opens the event stream as client and returns a reader
+// positioned after the initial comment
+func (a *testAPI) openEvents(client *http.Client, query string) *bufio.Reader {
+	a.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	a.t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.server.URL+"/api/events"+query, nil)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.t.Cleanup(func() { resp.Body.Close() })
+	expectStatus(a.t, resp, http.StatusOK)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		a.t.Fatalf("Content-Type %q, want text/event-stream", contentType)
+	}
+
+	stream := bufio.NewReader(resp.Body)
+	if name, _ := readEvent(a.t, stream); name != "" {
+		a.t.Fatalf("stream starts with event %q, want the connected comment", name)
+	}
+	return stream
+}
+
+// readEvent reads the next frame from an event stream and returns its event
+// name and data; comment frames have neither
+func readEvent(t *testing.T, stream *bufio.Reader) (string, events.Event) {
+	t.Helper()
+
+	var name string
+	var event events.Event
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return name, event
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("decoding event data %q: %v", line, err)
+			}
+		case strings.HasPrefix(line, ":"):
+		default:
+			t.Fatalf("unexpected line in event stream: %q", line)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string // Event types received, in order
+	}{
+		{"everything", "", []string{events.LocationCreated, events.ItemCreated, events.ItemUpdated, events.ItemDeleted}},
+		{"items only", "?types=item.*", []string{events.ItemCreated, events.ItemUpdated, events.ItemDeleted}},
+		{"listed types", "?types=location.created,item.deleted", []string{events.LocationCreated, events.ItemDeleted}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, model.Inventory{})
+			stream := api.openEvents(api.userWithRole(model.RoleViewer), tt.query)
+
+			shelf := api.addLocation("Shelf", "")
+			item := api.addItem(model.CreateItem{Name: "Gloves", LocationID: shelf.ID.Hex(), Number: 10})
+			itemPath := "/api/items/" + item.ID.Hex()
+			expectStatus(t, api.do(api.admin, http.MethodPut, itemPath, model.CreateItem{Name: "Nitrile gloves", LocationID: shelf.ID.Hex(), Number: 10}), http.StatusOK)
+			expectStatus(t, api.do(api.admin, http.MethodDelete, itemPath, nil), http.StatusNoContent)
+
+			for _, want := range tt.want {
+				name, event := readEvent(t, stream)
+				if name != want || event.Type != want {
+					t.Fatalf("got event %q with type %q, want %q", name, event.Type, want)
+				}
+				switch {
+				case strings.HasPrefix(want, "item."):
+					if event.Item == nil || event.Item.ID != item.ID {
+						t.Errorf("%s event carries item %+v", want, event.Item)
+					}
+				case strings.HasPrefix(want, "location."):
+					if event.Location == nil || event.Location.ID != shelf.ID {
+						t.Errorf("%s event carries location %+v", want, event.Location)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEventStreamRequiresLogin(t *testing.T) {
+	api := newTestAPI(t, model.Inventory{})
+	expectStatus(t, api.do(http.DefaultClient, http.MethodGet, "/api/events", nil), http.StatusUnauthorized)
+	expectStatus(t, api.do(api.admin, http.MethodPost, "/api/events", nil), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lab-inv/internal/config"
+	"lab-inv/internal/migrate"
+	"lab-inv/internal/model"
+	"lab-inv/internal/storage"
+)
+
+// legacySuffix is added to a legacy inventory.json that is in the way of the
+// file store it is migrated into
+const legacySuffix = ".legacy"
+
+// runMigrate implements "lab-inv migrate": it copies a legacy integer-ID
+// inventory.json into the configured store
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("lab-inv migrate", flag.ContinueOnError)
+	from := fs.String("from", "./data/inventory.json", "legacy inventory file to migrate")
+	dryRun := fs.Bool("dry-run", false, "report what would be migrated without writing anything")
+
+	cfg, err := config.Load(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	legacy, err := migrate.ReadLegacy(*from)
+	if err != nil {
+		log.Fatalf("Failed to read legacy inventory: %v", err)
+	}
+
+	var store storage.Store
+	switch {
+	case cfg.Store == "file" && samePath(*from, storage.InventoryPath(cfg.DataDir)) && *dryRun:
+		// The file store would start out empty once the legacy file is moved aside
+		store = storage.NewMemoryStore(model.Inventory{})
+	case cfg.Store == "file" && samePath(*from, storage.InventoryPath(cfg.DataDir)):
+		if *from, err = moveLegacyAside(*from); err != nil {
+			log.Fatalf("Failed to move the legacy inventory aside: %v", err)
+		}
+		if err := storage.InitFileStore(cfg.DataDir); err != nil {
+			log.Fatalf("Failed to create the file store: %v", err)
+		}
+		fallthrough
+	default:
+		if store, err = openStore(cfg); err != nil {
+			log.Fatalf("Failed to open %s store: %v", cfg.Store, err)
+		}
+	}
+	defer store.Close()
+
+	log.Printf("Migrating %s into the %s store", *from, cfg.Store)
+
+	// Migrated records are audited like any other change
+	report, err := migrate.Run(storage.NewAuditStore(store, storage.Actor{User: "system"}), legacy, *dryRun)
+	fmt.Print(report)
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+// moveLegacyAside renames the legacy file at path, which is where the file
+// store keeps its own data, and returns its new path
+func moveLegacyAside(path string) (string, error) {
+	aside := strings.TrimSuffix(path, filepath.Ext(path)) + legacySuffix + filepath.Ext(path)
+	if _, err := os.Stat(aside); err == nil {
+		return "", fmt.Errorf("%s already exists", aside)
+	}
+	if err := os.Rename(path, aside); err != nil {
+		return "", err
+	}
+	log.Printf("Moved %s to %s to make room for the file store", path, aside)
+	return aside, nil
+}
+
+// samePath reports whether a and b name the same file
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
@@ -7,13 +7,35 @@ let inventory = {
 // API configuration
 const API_BASE = '/api';
 
+// The logged-in user, and how the roles rank; each role may do everything
+// the ones below it may
+let currentUser = null;
+const ROLE_RANKS = { viewer: 0, member: 1, manager: 2, admin: 3 };
+
+// Any API request refused for lack of a session sends the browser to the login page
+const fetchWithSession = window.fetch.bind(window);
+window.fetch = async (...args) => {
+    const response = await fetchWithSession(...args);
+    if (response.status === 401 && !window.location.pathname.endsWith('/login.html')) {
+        window.location.href = '/login.html';
+    }
+    return response;
+};
+
+// Thrown when an update or delete is refused because someone else changed the record
+class ConflictError extends Error {}
+
 // Application initialization
 document.addEventListener('DOMContentLoaded', function() {
     initializeApplication();
 });
 
 // Initialize the entire application
-function initializeApplication() {
+async function initializeApplication() {
+    // Show who is logged in, and only what they may do
+    await loadCurrentUser();
+    applyRoleVisibility();
+    
     // Load data from MongoDB
     loadInventoryData();
     
@@ -23,6 +45,9 @@ function initializeApplication() {
     // Initialize UI components
     initializeUI();
     
+    // Follow changes made by other users
+    connectEvents();
+    
     console.log('Lab Inventory System initialized');
 }
 
@@ -37,6 +62,9 @@ function setupEventListeners() {
     // Modal controls
     document.getElementById('add-item-button').addEventListener('click', openAddItemModal);
     document.getElementById('add-location-button').addEventListener('click', openAddLocationModal);
+    document.getElementById('logout-button').addEventListener('click', logout);
+    document.getElementById('change-password-button').addEventListener('click', openChangePasswordModal);
+    document.getElementById('add-token-button').addEventListener('click', openAddTokenModal);
     
     // Close modal buttons
     document.querySelectorAll('.close-btn, .close-modal').forEach(btn => {
@@ -48,17 +76,77 @@ function setupEventListeners() {
     document.getElementById('add-location-form').addEventListener('submit', handleAddLocation);
     document.getElementById('edit-item-form').addEventListener('submit', handleEditItem);
     document.getElementById('edit-location-form').addEventListener('submit', handleEditLocation);
+    document.getElementById('add-token-form').addEventListener('submit', handleAddToken);
+    document.getElementById('change-password-form').addEventListener('submit', handleChangePassword);
     
     // Search functionality
     document.getElementById('search-input').addEventListener('input', handleSearch);
     
     // Sedat button
-    document.getElementById('sedat-button').addEventListener('click', handleSedatClick);
+    const sedatButton = document.getElementById('sedat-button');
+    if (sedatButton) {
+        sedatButton.addEventListener('click', handleSedatClick);
+    }
 
     // Close modal when clicking outside
     window.addEventListener('click', handleModalOutsideClick);
 }
 
+// ===== SESSION =====
+
+async function loadCurrentUser() {
+    const response = await fetch(`${API_BASE}/me`);
+    if (response.ok) {
+        currentUser = await response.json();
+        document.getElementById('current-user').textContent = `${currentUser.username} (${currentUser.role || 'viewer'})`;
+        // Single sign-on users change their password with the identity provider
+        document.getElementById('change-password-button').style.display = currentUser.oidc_subject ? 'none' : '';
+    }
+}
+
+// Whether the logged-in user has at least the given role
+function can(role) {
+    return currentUser !== null && (ROLE_RANKS[currentUser.role] || 0) >= ROLE_RANKS[role];
+}
+
+// Hides the controls marked with a data-role the user does not have
+function applyRoleVisibility() {
+    document.querySelectorAll('[data-role]').forEach(element => {
+        element.style.display = can(element.dataset.role) ? '' : 'none';
+    });
+}
+
+async function logout() {
+    await fetch(`${API_BASE}/logout`, { method: 'POST' });
+    window.location.href = '/login.html';
+}
+
+function openChangePasswordModal() {
+    document.getElementById('change-password-form').reset();
+    document.getElementById('change-password-modal').style.display = 'block';
+}
+
+async function handleChangePassword(event) {
+    event.preventDefault();
+
+    const newPassword = document.getElementById('new-password').value;
+    if (newPassword !== document.getElementById('repeat-password').value) {
+        showError('The new passwords do not match');
+        return;
+    }
+
+    try {
+        await changePasswordAPI({
+            current_password: document.getElementById('current-password').value,
+            new_password: newPassword
+        });
+        closeAllModals();
+        showSuccess('Password changed');
+    } catch (error) {
+        showError(`Failed to change password: ${error.message}`);
+    }
+}
+
 // ===== TAB FUNCTIONALITY =====
 
 function handleTabSwitch(event) {
@@ -73,6 +161,13 @@ function handleTabSwitch(event) {
     clickedTab.classList.add('active');
     document.getElementById(tabName + '-section').classList.add('active');
     
+    if (tabName === 'trash') {
+        loadTrash();
+    }
+    if (tabName === 'tokens') {
+        loadTokens();
+    }
+    
     console.log('Switched to tab:', tabName);
 }
 
@@ -81,10 +176,12 @@ function handleTabSwitch(event) {
 function openAddItemModal() {
     populateLocationDropdown();
     document.getElementById('add-item-form').reset();
+    document.getElementById('item-price').disabled = !can('manager');
     document.getElementById('add-item-modal').style.display = 'block';
 }
 
 function openAddLocationModal() {
+    populateParentDropdown();
     document.getElementById('add-location-form').reset();
     document.getElementById('add-location-modal').style.display = 'block';
 }
@@ -94,7 +191,9 @@ function closeAllModals() {
         'add-item-modal',
         'add-location-modal', 
         'edit-item-modal',
-        'edit-location-modal'
+        'edit-location-modal',
+        'add-token-modal',
+        'change-password-modal'
     ];
     
     modals.forEach(modalId => {
@@ -178,7 +277,7 @@ function renderItems(items) {
             itemsTable.style.display = 'table';
             
             items.forEach(item => {
-                const locationName = getLocationNameById(item.location_id);
+                const locationName = getStockSummary(item);
                 const row = createItemRow(item, locationName);
                 itemsList.appendChild(row);
             });
@@ -220,28 +319,40 @@ function renderLocations(locations) {
 
 function createItemRow(item, locationName) {
     const row = document.createElement('tr');
+    row.dataset.itemId = item.id;
     row.innerHTML = `
         <td>${escapeHtml(item.name)}</td>
         <td>${escapeHtml(locationName)}</td>
-        <td>${item.number || 0}</td>
+        <td>${item.number || 0}${lowStockBadge(item)}</td>
         <td class="price">$${parseFloat(item.price || 0).toFixed(2)}</td>
         <td>
-            <button class="action-btn" onclick="editItem('${item.id}')">EDIT</button>
-            <button class="action-btn delete" onclick="confirmDeleteItem('${item.id}', '${escapeHtml(item.name)}')">DELETE</button>
+            ${can('member') ? `<button class="action-btn" onclick="promptAdjustItem('${item.id}', '${escapeHtml(item.name)}')">TAKE</button>` : ''}
+            ${can('member') ? `<button class="action-btn" onclick="editItem('${item.id}')">EDIT</button>` : ''}
+            ${can('manager') ? `<button class="action-btn delete" onclick="confirmDeleteItem('${item.id}', '${escapeHtml(item.name)}')">DELETE</button>` : ''}
         </td>
     `;
     
     return row;
 }
 
+// Marks items below their minimum quantity
+function lowStockBadge(item) {
+    if (!(item.number < item.min_quantity)) {
+        return '';
+    }
+    const reorder = item.reorder_quantity ? `, reorder ${item.reorder_quantity}` : '';
+    return ` <span class="badge low-stock" title="Minimum ${item.min_quantity}${reorder}">LOW</span>`;
+}
+
 function createLocationRow(location, itemCount) {
     const row = document.createElement('tr');
+    row.dataset.locationId = location.id;
     row.innerHTML = `
-        <td>${escapeHtml(location.name)}</td>
-        <td>${itemCount}</td>
+        <td>${escapeHtml(getLocationNameById(location.id))}</td>
+        <td class="item-count">${itemCount}</td>
         <td>
-            <button class="action-btn" onclick="editLocation('${location.id}')">EDIT</button>
-            <button class="action-btn delete" onclick="confirmDeleteLocation('${location.id}', '${escapeHtml(location.name)}')">DELETE</button>
+            ${can('manager') ? `<button class="action-btn" onclick="editLocation('${location.id}')">EDIT</button>` : ''}
+            ${can('manager') ? `<button class="action-btn delete" onclick="confirmDeleteLocation('${location.id}', '${escapeHtml(location.name)}')">DELETE</button>` : ''}
         </td>
     `;
     
@@ -299,13 +410,16 @@ function getItemFormData() {
         name: document.getElementById('item-name').value.trim(),
         location_id: document.getElementById('item-location').value,
         number: parseInt(document.getElementById('item-number').value) || 0,
-        price: parseFloat(document.getElementById('item-price').value) || 0
+        price: parseFloat(document.getElementById('item-price').value) || 0,
+        min_quantity: parseInt(document.getElementById('item-min-quantity').value) || 0,
+        reorder_quantity: parseInt(document.getElementById('item-reorder-quantity').value) || 0
     };
 }
 
 function getLocationFormData() {
     return {
-        name: document.getElementById('location-name').value.trim()
+        name: document.getElementById('location-name').value.trim(),
+        parent_id: document.getElementById('location-parent').value
     };
 }
 
@@ -347,20 +461,42 @@ function validateLocationForm(data) {
 // ===== DELETE OPERATIONS =====
 
 function confirmDeleteItem(itemId, itemName) {
-    if (confirm(`Are you sure you want to delete "${itemName}"?`)) {
+    if (confirm(`Are you sure you want to delete "${itemName}"? It can be restored from the trash.`)) {
         deleteItem(itemId);
     }
 }
 
+// Asks what to do when someone else saved a record first.
+// Returns true to overwrite their changes, false to reload and start over.
+function confirmOverwrite(what) {
+    return confirm(
+        `Someone else changed this ${what} while you were editing it.\n\n` +
+        `OK: save your changes anyway and overwrite theirs\n` +
+        `Cancel: discard your changes and load theirs`
+    );
+}
+
 function confirmDeleteLocation(locationId, locationName) {
-    if (confirm(`Are you sure you want to delete "${locationName}"?`)) {
+    if (confirm(`Are you sure you want to delete "${locationName}"? It can be restored from the trash.`)) {
         deleteLocation(locationId);
     }
 }
 
 async function deleteItem(itemId) {
+    const item = inventory.items.find(item => item.id === itemId);
     try {
-        await deleteItemAPI(itemId);
+        try {
+            await deleteItemAPI(itemId, item && item.version);
+        } catch (error) {
+            if (!(error instanceof ConflictError)) {
+                throw error;
+            }
+            if (!confirm('Someone else changed this item since you loaded it. Delete it anyway?')) {
+                await loadInventoryData();
+                return;
+            }
+            await deleteItemAPI(itemId);
+        }
         await loadInventoryData();
         showSuccess('Item deleted successfully!');
     } catch (error) {
@@ -369,8 +505,20 @@ async function deleteItem(itemId) {
 }
 
 async function deleteLocation(locationId) {
+    const location = inventory.locations.find(loc => loc.id === locationId);
     try {
-        await deleteLocationAPI(locationId);
+        try {
+            await deleteLocationAPI(locationId, location && location.version);
+        } catch (error) {
+            if (!(error instanceof ConflictError)) {
+                throw error;
+            }
+            if (!confirm('Someone else changed this location since you loaded it. Delete it anyway?')) {
+                await loadInventoryData();
+                return;
+            }
+            await deleteLocationAPI(locationId);
+        }
         await loadInventoryData();
         showSuccess('Location deleted successfully!');
     } catch (error) {
@@ -378,6 +526,175 @@ async function deleteLocation(locationId) {
     }
 }
 
+// ===== TRASH =====
+
+async function loadTrash() {
+    try {
+        renderTrash(await getTrashAPI());
+    } catch (error) {
+        showError(`Failed to load the trash: ${error.message}`);
+    }
+}
+
+// Lists deleted items and locations; locations deleted along with another
+// one are restored or purged with it, so they are counted on its row instead
+function renderTrash(trash) {
+    const trashList = document.getElementById('trash-list');
+    trashList.innerHTML = '';
+    
+    const locations = trash.locations.filter(location => !location.deleted_with);
+    const records = [
+        ...trash.items.map(item => ({ record: item, type: 'ITEM' })),
+        ...locations.map(location => ({ record: location, type: 'LOCATION' }))
+    ].sort((a, b) => new Date(b.record.deleted_at) - new Date(a.record.deleted_at));
+    
+    document.getElementById('trash-empty').style.display = records.length ? 'none' : 'flex';
+    document.getElementById('trash-table').style.display = records.length ? 'table' : 'none';
+    
+    records.forEach(({ record, type }) => {
+        const along = trash.locations.filter(location => location.deleted_with === record.id).length;
+        trashList.appendChild(createTrashRow(record, type, along));
+    });
+}
+
+function createTrashRow(record, type, along) {
+    const row = document.createElement('tr');
+    const extra = along ? ` (+${along} sub-location${along === 1 ? '' : 's'})` : '';
+    row.innerHTML = `
+        <td>${escapeHtml(record.name)}${extra}</td>
+        <td>${type}</td>
+        <td>${new Date(record.deleted_at).toLocaleString()}</td>
+        <td>${escapeHtml(record.deleted_by || '')}</td>
+        <td>
+            <button class="action-btn" onclick="restoreFromTrash('${record.id}')">RESTORE</button>
+            <button class="action-btn delete" onclick="confirmDeleteForever('${record.id}', '${escapeHtml(record.name)}')">DELETE FOREVER</button>
+        </td>
+    `;
+    
+    return row;
+}
+
+async function restoreFromTrash(id) {
+    try {
+        await restoreFromTrashAPI(id);
+        await Promise.all([loadTrash(), loadInventoryData()]);
+        showSuccess('Restored successfully!');
+    } catch (error) {
+        showError(`Failed to restore: ${error.message}`);
+    }
+}
+
+function confirmDeleteForever(id, name) {
+    if (!confirm(`Permanently delete "${name}"? This cannot be undone.`)) {
+        return;
+    }
+    deleteFromTrashAPI(id)
+        .then(() => {
+            loadTrash();
+            showSuccess('Deleted permanently');
+        })
+        .catch(error => showError(`Failed to delete: ${error.message}`));
+}
+
+// ===== API TOKENS =====
+
+function openAddTokenModal() {
+    document.getElementById('add-token-form').reset();
+    document.getElementById('add-token-modal').style.display = 'block';
+}
+
+async function loadTokens() {
+    try {
+        renderTokens(await getTokensAPI());
+    } catch (error) {
+        showError(`Failed to load API tokens: ${error.message}`);
+    }
+}
+
+function renderTokens(tokens) {
+    const tokensList = document.getElementById('tokens-list');
+    tokensList.innerHTML = '';
+    
+    document.getElementById('tokens-empty').style.display = tokens.length ? 'none' : 'flex';
+    document.getElementById('tokens-table').style.display = tokens.length ? 'table' : 'none';
+    
+    tokens.forEach(token => tokensList.appendChild(createTokenRow(token)));
+}
+
+function createTokenRow(token) {
+    const row = document.createElement('tr');
+    const date = value => value ? new Date(value).toLocaleString() : 'Never';
+    row.innerHTML = `
+        <td>${escapeHtml(token.name)}</td>
+        <td>${escapeHtml(token.prefix)}…</td>
+        <td>${escapeHtml(token.scope)}</td>
+        <td>${date(token.created)}</td>
+        <td>${date(token.expires)}</td>
+        <td>${date(token.last_used)}</td>
+        <td>
+            <button class="action-btn delete" onclick="confirmRevokeToken('${token.id}', '${escapeHtml(token.name)}')">REVOKE</button>
+        </td>
+    `;
+    
+    return row;
+}
+
+async function handleAddToken(event) {
+    event.preventDefault();
+    
+    const tokenData = {
+        name: document.getElementById('token-name').value.trim(),
+        scope: document.getElementById('token-scope').value,
+        expires_in_days: parseInt(document.getElementById('token-expires').value) || 0
+    };
+    
+    try {
+        const created = await createTokenAPI(tokenData);
+        closeAllModals();
+        
+        // The token is only ever shown here
+        document.getElementById('new-token-value').value = created.token;
+        document.getElementById('new-token').style.display = 'flex';
+        document.getElementById('new-token-value').select();
+        
+        await loadTokens();
+        showSuccess('API token created');
+    } catch (error) {
+        showError(`Failed to create API token: ${error.message}`);
+    }
+}
+
+function confirmRevokeToken(id, name) {
+    if (!confirm(`Revoke the API token "${name}"? Scripts using it will stop working.`)) {
+        return;
+    }
+    revokeTokenAPI(id)
+        .then(() => {
+            loadTokens();
+            showSuccess('API token revoked');
+        })
+        .catch(error => showError(`Failed to revoke API token: ${error.message}`));
+}
+
+function promptAdjustItem(itemId, itemName) {
+    const answer = prompt(`How many "${itemName}" are you taking out?`, '1');
+    const quantity = parseInt(answer);
+    if (!quantity || quantity <= 0) {
+        return;
+    }
+    adjustItem(itemId, -quantity);
+}
+
+async function adjustItem(itemId, delta) {
+    try {
+        const result = await adjustItemAPI(itemId, delta);
+        await loadInventoryData();
+        showSuccess(`Quantity is now ${result.total}`);
+    } catch (error) {
+        showError(`Failed to adjust quantity: ${error.message}`);
+    }
+}
+
 // ===== SEARCH FUNCTIONALITY =====
 
 function handleSearch(event) {
@@ -395,6 +712,129 @@ function handleSearch(event) {
     renderItems(filteredItems);
 }
 
+// Whether an item is shown under the current search
+function matchesSearch(item) {
+    const searchTerm = document.getElementById('search-input').value.toLowerCase().trim();
+    return !searchTerm || item.name.toLowerCase().includes(searchTerm);
+}
+
+// ===== LIVE UPDATES =====
+
+// Follows changes made by anyone through the server and patches the tables in place
+function connectEvents() {
+    if (!window.EventSource) {
+        return;
+    }
+    
+    const source = new EventSource(`${API_BASE}/events`);
+    const on = (type, handler) =>
+        source.addEventListener(type, event => handler(JSON.parse(event.data)));
+    
+    on('item.created', event => upsertItem(event.item));
+    on('item.updated', event => upsertItem(event.item));
+    on('item.deleted', event => removeItem(event.item.id));
+    on('item.restored', event => upsertItem(event.item));
+    on('location.created', event => upsertLocation(event.location));
+    on('location.updated', event => upsertLocation(event.location));
+    on('location.deleted', event => removeLocation(event.location.id));
+    on('location.restored', event => upsertLocation(event.location));
+    on('inventory.imported', () => loadInventoryData());
+    
+    // EventSource reconnects by itself; reload to catch up on what was missed meanwhile
+    let disconnected = false;
+    source.onerror = () => {
+        disconnected = true;
+    };
+    source.onopen = () => {
+        if (disconnected) {
+            disconnected = false;
+            loadInventoryData();
+        }
+    };
+}
+
+function upsertItem(item) {
+    const i = inventory.items.findIndex(existing => existing.id === item.id);
+    if (i >= 0) {
+        // Events can arrive after a reload that already has a newer version
+        if (inventory.items[i].version > item.version) {
+            return;
+        }
+        inventory.items[i] = item;
+    } else {
+        inventory.items.push(item);
+    }
+    
+    patchItemRow(item);
+    patchLocationCounts();
+}
+
+function removeItem(itemId) {
+    inventory.items = inventory.items.filter(item => item.id !== itemId);
+    
+    const row = findRow('items-list', 'itemId', itemId);
+    if (row) {
+        row.remove();
+    }
+    patchLocationCounts();
+}
+
+function upsertLocation(location) {
+    const i = inventory.locations.findIndex(existing => existing.id === location.id);
+    if (i >= 0) {
+        inventory.locations[i] = location;
+    } else {
+        inventory.locations.push(location);
+    }
+    
+    // A rename or move changes the path shown for everything below the location
+    renderLocations(inventory.locations);
+    renderItems(inventory.items.filter(matchesSearch));
+}
+
+function removeLocation(locationId) {
+    inventory.locations = inventory.locations.filter(location => location.id !== locationId);
+    
+    const row = findRow('locations-list', 'locationId', locationId);
+    if (row) {
+        row.remove();
+    }
+}
+
+function findRow(listId, key, id) {
+    return Array.from(document.getElementById(listId).rows)
+        .find(row => row.dataset[key] === id);
+}
+
+// Replaces or adds an item's row, keeping the current search applied
+function patchItemRow(item) {
+    const row = findRow('items-list', 'itemId', item.id);
+    if (!matchesSearch(item)) {
+        if (row) {
+            row.remove();
+        }
+        return;
+    }
+    
+    const newRow = createItemRow(item, getStockSummary(item));
+    if (row) {
+        row.replaceWith(newRow);
+    } else {
+        document.getElementById('items-list').appendChild(newRow);
+        document.getElementById('items-empty').style.display = 'none';
+        document.getElementById('items-table').style.display = 'table';
+    }
+}
+
+function patchLocationCounts() {
+    Array.from(document.getElementById('locations-list').rows).forEach(row => {
+        const cell = row.querySelector('.item-count');
+        if (cell) {
+            cell.textContent = getItemCountForLocation(row.dataset.locationId);
+        }
+    });
+}
+
 // ===== API FUNCTIONS =====
 
 async function createItemAPI(itemData) {
@@ -405,7 +845,7 @@ async function createItemAPI(itemData) {
     });
 
     if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         throw new Error(errorText);
     }
 
@@ -420,44 +860,212 @@ async function createLocationAPI(locationData) {
     });
 
     if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
+async function adjustItemAPI(itemId, delta) {
+    const response = await fetch(`${API_BASE}/items/${itemId}/adjust`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ delta: delta })
+    });
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
         throw new Error(errorText);
     }
 
     return await response.json();
 }
 
-async function deleteItemAPI(itemId) {
+async function deleteItemAPI(itemId, version) {
     const response = await fetch(`${API_BASE}/items/${itemId}`, {
-        method: 'DELETE'
+        method: 'DELETE',
+        headers: ifMatchHeaders(version)
     });
 
+    if (response.status === 412) {
+        throw new ConflictError(await response.text());
+    }
     if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         throw new Error(errorText);
     }
 }
 
-async function deleteLocationAPI(locationId) {
+async function deleteLocationAPI(locationId, version) {
     const response = await fetch(`${API_BASE}/locations/${locationId}`, {
+        method: 'DELETE',
+        headers: ifMatchHeaders(version)
+    });
+
+    if (response.status === 412) {
+        throw new ConflictError(await response.text());
+    }
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+}
+
+async function changePasswordAPI(change) {
+    const response = await fetch(`${API_BASE}/me/password`, {
+        method: 'PUT',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify(change)
+    });
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
+async function getTokensAPI() {
+    const response = await fetch(`${API_BASE}/tokens`);
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
+async function createTokenAPI(tokenData) {
+    const response = await fetch(`${API_BASE}/tokens`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify(tokenData)
+    });
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
+async function revokeTokenAPI(id) {
+    const response = await fetch(`${API_BASE}/tokens/${id}`, {
         method: 'DELETE'
     });
 
     if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         throw new Error(errorText);
     }
 }
 
+async function getTrashAPI() {
+    const response = await fetch(`${API_BASE}/trash`);
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
+async function restoreFromTrashAPI(id) {
+    const response = await fetch(`${API_BASE}/trash/${id}/restore`, {
+        method: 'POST'
+    });
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
+async function deleteFromTrashAPI(id) {
+    const response = await fetch(`${API_BASE}/trash/${id}`, {
+        method: 'DELETE'
+    });
+
+    if (!response.ok) {
+        const errorText = await errorMessage(response);
+        throw new Error(errorText);
+    }
+
+    return await response.json();
+}
+
 // ===== UTILITY FUNCTIONS =====
 
+// Reads the message out of an error response, which is JSON for refused permissions
+async function errorMessage(response) {
+    const text = await response.text();
+    if ((response.headers.get('Content-Type') || '').includes('application/json')) {
+        try {
+            return JSON.parse(text).error || text;
+        } catch (error) {
+            return text;
+        }
+    }
+    return text;
+}
+
+// Makes a request conditional on the record still being at version;
+// without a version the request overwrites unconditionally
+function ifMatchHeaders(version, headers = {}) {
+    if (version !== undefined && version !== null) {
+        headers['If-Match'] = `"${version}"`;
+    }
+    return headers;
+}
+
+// Returns the full path of a location, e.g. "Storage Room / Shelf B / Bin 12"
 function getLocationNameById(locationId) {
-    const location = inventory.locations.find(loc => loc.id === locationId);
-    return location ? location.name : 'Unknown';
+    const names = [];
+    const seen = new Set();
+    let location = inventory.locations.find(loc => loc.id === locationId);
+    if (!location) {
+        return 'Unknown';
+    }
+    while (location && !seen.has(location.id)) {
+        seen.add(location.id);
+        names.unshift(location.name);
+        location = location.parent_id
+            ? inventory.locations.find(loc => loc.id === location.parent_id)
+            : null;
+    }
+    return names.join(' / ');
+}
+
+// Lists where an item is stocked, e.g. "Storage Room (4), Assembly Room (8)"
+function getStockSummary(item) {
+    const stock = item.stock && item.stock.length > 0
+        ? item.stock
+        : [{ location_id: item.location_id, number: item.number }];
+    if (stock.length === 1) {
+        return getLocationNameById(stock[0].location_id);
+    }
+    return stock
+        .map(level => `${getLocationNameById(level.location_id)} (${level.number})`)
+        .join(', ');
 }
 
 function getItemCountForLocation(locationId) {
-    return inventory.items.filter(item => item.location_id === locationId).length;
+    return inventory.items.filter(item =>
+        item.stock && item.stock.length > 0
+            ? item.stock.some(level => level.location_id === locationId)
+            : item.location_id === locationId
+    ).length;
 }
 
 function populateLocationDropdown() {
@@ -467,7 +1075,19 @@ function populateLocationDropdown() {
     inventory.locations.forEach(location => {
         const option = document.createElement('option');
         option.value = location.id;
-        option.textContent = location.name;
+        option.textContent = getLocationNameById(location.id);
+        dropdown.appendChild(option);
+    });
+}
+
+function populateParentDropdown() {
+    const dropdown = document.getElementById('location-parent');
+    dropdown.innerHTML = '<option value="">None (top level)</option>';
+    
+    inventory.locations.forEach(location => {
+        const option = document.createElement('option');
+        option.value = location.id;
+        option.textContent = getLocationNameById(location.id);
         dropdown.appendChild(option);
     });
 }
@@ -535,17 +1155,28 @@ function editItem(itemId) {
         return;
     }
     
+    // Populate location dropdown before selecting the current location
+    populateEditLocationDropdown();
+    
     // Populate edit form with current data
     document.getElementById('edit-item-name').value = item.name;
     document.getElementById('edit-item-location').value = item.location_id;
     document.getElementById('edit-item-number').value = item.number || 0;
     document.getElementById('edit-item-price').value = item.price || 0;
+    document.getElementById('edit-item-price').disabled = !can('manager');
+    document.getElementById('edit-item-min-quantity').value = item.min_quantity || 0;
+    document.getElementById('edit-item-reorder-quantity').value = item.reorder_quantity || 0;
     
-    // Store item ID for update
-    document.getElementById('edit-item-form').dataset.itemId = itemId;
+    // Items stocked in several places keep their stock; use TAKE to change it
+    const multiLocation = item.stock && item.stock.length > 1;
+    document.getElementById('edit-item-location').disabled = multiLocation;
+    document.getElementById('edit-item-number').disabled = multiLocation;
+    
+    // Store item ID and the version being edited for update
+    const form = document.getElementById('edit-item-form');
+    form.dataset.itemId = itemId;
+    form.dataset.version = item.version;
     
-    // Populate location dropdown and show modal
-    populateEditLocationDropdown();
     document.getElementById('edit-item-modal').style.display = 'block';
 }
 
@@ -559,8 +1190,10 @@ function editLocation(locationId) {
     // Populate edit form with current data
     document.getElementById('edit-location-name').value = location.name;
     
-    // Store location ID for update
-    document.getElementById('edit-location-form').dataset.locationId = locationId;
+    // Store location ID and the version being edited for update
+    const form = document.getElementById('edit-location-form');
+    form.dataset.locationId = locationId;
+    form.dataset.version = location.version;
     
     // Show modal
     document.getElementById('edit-location-modal').style.display = 'block';
@@ -579,7 +1212,20 @@ async function handleEditItem(event) {
     }
     
     try {
-        const updatedItem = await updateItemAPI(itemId, formData);
+        let updatedItem;
+        try {
+            updatedItem = await updateItemAPI(itemId, formData, form.dataset.version);
+        } catch (error) {
+            if (!(error instanceof ConflictError)) {
+                throw error;
+            }
+            if (!confirmOverwrite('item')) {
+                await loadInventoryData();
+                editItem(itemId);
+                return;
+            }
+            updatedItem = await updateItemAPI(itemId, formData);
+        }
         
         await loadInventoryData();
         closeAllModals();
@@ -603,7 +1249,20 @@ async function handleEditLocation(event) {
     }
     
     try {
-        const updatedLocation = await updateLocationAPI(locationId, formData);
+        let updatedLocation;
+        try {
+            updatedLocation = await updateLocationAPI(locationId, formData, form.dataset.version);
+        } catch (error) {
+            if (!(error instanceof ConflictError)) {
+                throw error;
+            }
+            if (!confirmOverwrite('location')) {
+                await loadInventoryData();
+                editLocation(locationId);
+                return;
+            }
+            updatedLocation = await updateLocationAPI(locationId, formData);
+        }
         
         await loadInventoryData();
         closeAllModals();
@@ -615,12 +1274,21 @@ async function handleEditLocation(event) {
 }
 
 function getEditItemFormData() {
-    return {
+    const itemId = document.getElementById('edit-item-form').dataset.itemId;
+    const item = inventory.items.find(item => item.id === itemId);
+    
+    const data = {
         name: document.getElementById('edit-item-name').value.trim(),
         location_id: document.getElementById('edit-item-location').value,
         number: parseInt(document.getElementById('edit-item-number').value) || 0,
-        price: parseFloat(document.getElementById('edit-item-price').value) || 0
+        price: parseFloat(document.getElementById('edit-item-price').value) || 0,
+        min_quantity: parseInt(document.getElementById('edit-item-min-quantity').value) || 0,
+        reorder_quantity: parseInt(document.getElementById('edit-item-reorder-quantity').value) || 0
     };
+    if (item && item.stock && item.stock.length > 1) {
+        data.stock = item.stock;
+    }
+    return data;
 }
 
 function getEditLocationFormData() {
@@ -636,35 +1304,53 @@ function populateEditLocationDropdown() {
     inventory.locations.forEach(location => {
         const option = document.createElement('option');
         option.value = location.id;
-        option.textContent = location.name;
+        option.textContent = getLocationNameById(location.id);
         dropdown.appendChild(option);
     });
 }
 
-async function updateItemAPI(itemId, itemData) {
+function populateParentDropdown() {
+    const dropdown = document.getElementById('location-parent');
+    dropdown.innerHTML = '<option value="">None (top level)</option>';
+    
+    inventory.locations.forEach(location => {
+        const option = document.createElement('option');
+        option.value = location.id;
+        option.textContent = getLocationNameById(location.id);
+        dropdown.appendChild(option);
+    });
+}
+
+async function updateItemAPI(itemId, itemData, version) {
     const response = await fetch(`${API_BASE}/items/${itemId}`, {
         method: 'PUT',
-        headers: { 'Content-Type': 'application/json' },
+        headers: ifMatchHeaders(version, { 'Content-Type': 'application/json' }),
         body: JSON.stringify(itemData)
     });
 
+    if (response.status === 412) {
+        throw new ConflictError(await response.text());
+    }
     if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         throw new Error(errorText);
     }
 
     return await response.json();
 }
 
-async function updateLocationAPI(locationId, locationData) {
+async function updateLocationAPI(locationId, locationData, version) {
     const response = await fetch(`${API_BASE}/locations/${locationId}`, {
         method: 'PUT',
-        headers: { 'Content-Type': 'application/json' },
+        headers: ifMatchHeaders(version, { 'Content-Type': 'application/json' }),
         body: JSON.stringify(locationData)
     });
 
+    if (response.status === 412) {
+        throw new ConflictError(await response.text());
+    }
     if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         throw new Error(errorText);
     }
 